@@ -0,0 +1,83 @@
+// Command migrate inspects and applies database schema migrations.
+//
+// Usage:
+//
+//	migrate status   list migrations and whether they are applied
+//	migrate up       apply all pending migrations
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"rag-therapist/internal/config"
+	"rag-therapist/internal/storage"
+)
+
+func main() {
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelWarn,
+	})))
+
+	if len(os.Args) != 2 || (os.Args[1] != "status" && os.Args[1] != "up") {
+		fmt.Fprintln(os.Stderr, "usage: migrate status|up")
+		os.Exit(2)
+	}
+
+	cfg := config.Load()
+
+	database, err := storage.OpenDatabase(cfg.DataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	switch os.Args[1] {
+	case "status":
+		err = printStatus(database)
+	case "up":
+		err = migrateUp(database)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		database.Close()
+		os.Exit(1)
+	}
+}
+
+func printStatus(database *storage.Database) error {
+	states, err := database.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, state := range states {
+		appliedAt := "pending"
+		if state.AppliedAt != nil {
+			appliedAt = state.AppliedAt.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", state.Version, state.Name, appliedAt)
+	}
+	return w.Flush()
+}
+
+func migrateUp(database *storage.Database) error {
+	applied, err := database.Migrate()
+	for _, m := range applied {
+		fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		fmt.Println("database is up to date")
+	}
+	return nil
+}
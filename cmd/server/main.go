@@ -1,11 +1,27 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"rag-therapist/internal/api"
 	"rag-therapist/internal/config"
+	"rag-therapist/internal/embeddings"
+	"rag-therapist/internal/health"
+	"rag-therapist/internal/ingest"
+	"rag-therapist/internal/knowledge"
+	"rag-therapist/internal/llm"
+	"rag-therapist/internal/rag"
+	"rag-therapist/internal/storage"
 )
 
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	// Set up structured logging
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
@@ -13,12 +29,161 @@ func main() {
 	}))
 	slog.SetDefault(logger)
 
+	if err := run(); err != nil {
+		slog.Error("Server failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run starts the server and blocks until it is stopped. Everything it
+// opens is closed again by its defers, whichever way it returns.
+func run() error {
 	slog.Info("RAG Therapist server starting...")
-	
+
 	// Load configuration
 	cfg := config.Load()
-	
+
+	maxUploadSize := int64(cfg.MaxUploadSizeMB) << 20
+	storageService, err := storage.NewStorageService(cfg.DataDir,
+		storage.WithRetryPolicy(storage.RetryPolicy{
+			MaxAttempts: cfg.IngestMaxAttempts,
+			BaseDelay:   cfg.IngestRetryDelay,
+			MaxDelay:    storage.DefaultRetryPolicy.MaxDelay,
+		}),
+		storage.WithQueryTimeout(cfg.StorageTimeout),
+		storage.WithMaxDocumentSize(maxUploadSize),
+		storage.WithDocumentCheck(ingest.CheckPDF))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	defer storageService.Close()
+
+	llmClient, err := llm.NewClient(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize LLM provider %s: %w", cfg.LLMProvider, err)
+	}
+
+	weights := storage.HybridWeights{Vector: cfg.HybridVectorWeight, Keyword: cfg.HybridKeywordWeight}
+	if err := weights.Validate(); err != nil {
+		return fmt.Errorf("invalid hybrid search weights: %w", err)
+	}
+
+	if err := storage.ValidateMMRLambda(cfg.MMRLambda); err != nil {
+		return fmt.Errorf("invalid MMR lambda: %w", err)
+	}
+
+	agentBudget := rag.AgentBudget{MaxSteps: cfg.AgentMaxSteps, MaxTokens: cfg.AgentMaxTokens}
+	if err := agentBudget.Validate(); err != nil {
+		return fmt.Errorf("invalid agent budget: %w", err)
+	}
+
+	contextOptions := rag.ContextOptions{Neighbors: cfg.ContextNeighbors, MaxTokens: cfg.ContextMaxTokens}
+	if err := contextOptions.Validate(); err != nil {
+		return fmt.Errorf("invalid context options: %w", err)
+	}
+
+	// Opening the default knowledge base checks the embedding, chunking
+	// and vector store configuration before anything is served.
+	knowledgeBases := knowledge.NewRegistry(cfg, storageService)
+	defer knowledgeBases.Close()
+
+	defaultKB, err := knowledgeBases.EnsureDefault(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to open the default knowledge base (vector store %s): %w", cfg.VectorStore, err)
+	}
+	slog.Info("Default knowledge base ready", "knowledge_base_id", defaultKB.ID, "collection", defaultKB.CollectionName,
+		"embedding_model", defaultKB.EmbeddingModel)
+
+	processor := ingest.NewProcessor(knowledgeBases)
+	workers := ingest.NewWorkerPool(processor, storageService, cfg.IngestWorkers, cfg.IngestPollInterval)
+	if err := workers.Start(context.Background()); err != nil {
+		return fmt.Errorf("failed to start ingestion workers: %w", err)
+	}
+
+	pipeline := rag.NewPipeline(knowledgeBases, llmClient, rag.WithHybridWeights(weights),
+		rag.WithMMRLambda(cfg.MMRLambda), rag.WithContextOptions(contextOptions), rag.WithDocumentStore(storageService))
+	agent := rag.NewAgent(pipeline, storageService, rag.WithAgentBudget(agentBudget))
+	server := api.NewServer(cfg.Port, api.Dependencies{
+		Storage:        storageService,
+		KnowledgeBases: knowledgeBases,
+		Pipeline:       pipeline,
+		Agent:          agent,
+		Workers:        workers,
+		Health:         health.NewChecker(healthChecks(cfg, storageService, knowledgeBases, llmClient)...),
+		CheckTimeout:   cfg.HealthCheckTimeout,
+		MaxUploadSize:  maxUploadSize,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Start()
+	}()
+
 	slog.Info("Server initialized", "port", cfg.Port)
-	
-	// TODO: Initialize server
-}
\ No newline at end of file
+
+	var runErr error
+	select {
+	case err := <-serverErr:
+		if err != nil {
+			runErr = fmt.Errorf("HTTP server failed: %w", err)
+		}
+	case <-ctx.Done():
+		slog.Info("Shutdown signal received, draining in-flight requests")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Graceful shutdown failed", "error", err)
+	}
+
+	// Stop ingestion after HTTP so no upload is left waiting for a worker.
+	// Documents still in flight when the deadline hits are requeued.
+	if err := workers.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Ingestion workers did not finish in time", "error", err)
+	}
+
+	if runErr != nil {
+		return runErr
+	}
+	slog.Info("Server stopped")
+	return nil
+}
+
+// healthChecks are the dependencies /readyz and /status check: the
+// database, the upload directory, the vector store and embedder of the
+// default knowledge base, and the LLM provider if it can be pinged.
+func healthChecks(cfg *config.Config, storageService *storage.StorageService, knowledgeBases *knowledge.Registry, llmClient llm.Client) []health.Check {
+	checks := []health.Check{
+		{Name: "database", Timeout: cfg.HealthCheckTimeout, Run: storageService.Ping},
+		{Name: "upload_dir", Timeout: cfg.HealthCheckTimeout, Run: func(ctx context.Context) error {
+			return storageService.CheckUploadDir()
+		}},
+		{Name: "vector_store", Timeout: cfg.HealthCheckTimeout, Run: func(ctx context.Context) error {
+			base, err := knowledgeBases.Default(ctx)
+			if err != nil {
+				return err
+			}
+			return base.Vectors.Heartbeat(ctx)
+		}},
+		{Name: "embeddings", Timeout: cfg.HealthCheckTimeout, Run: func(ctx context.Context) error {
+			base, err := knowledgeBases.Default(ctx)
+			if err != nil {
+				return err
+			}
+			if pinger, ok := base.Embedder.(embeddings.Pinger); ok {
+				return pinger.Ping(ctx)
+			}
+			return nil
+		}},
+	}
+
+	if pinger, ok := llmClient.(llm.Pinger); ok {
+		checks = append(checks, health.Check{Name: "llm", Timeout: cfg.HealthCheckTimeout, Run: pinger.Ping})
+	}
+	return checks
+}
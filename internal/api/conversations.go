@@ -0,0 +1,236 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"rag-therapist/internal/llm"
+	"rag-therapist/internal/rag"
+	"rag-therapist/internal/storage"
+	"rag-therapist/pkg/models"
+)
+
+const (
+	// historyMessages is how many earlier messages, i.e. the last ten
+	// exchanges, are sent to the LLM with a follow-up question.
+	historyMessages = 20
+	// Titles of new conversations are the first message, cut to this many
+	// characters.
+	maxTitleLength = 80
+)
+
+type listConversationsResponse struct {
+	Conversations []*models.Conversation `json:"conversations"`
+	Total         int                    `json:"total"`
+	Limit         int                    `json:"limit"`
+	Offset        int                    `json:"offset"`
+}
+
+type conversationResponse struct {
+	*models.Conversation
+	Messages []*models.Message `json:"messages"`
+}
+
+type renameConversationRequest struct {
+	Title string `json:"title"`
+}
+
+func (s *Server) handleListConversations(c *gin.Context) {
+	limit, err := queryInt(c, "limit", defaultPageLimit)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		badRequest(c, "limit must be between 1 and 100")
+		return
+	}
+
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		badRequest(c, "offset must be a non-negative integer")
+		return
+	}
+
+	conversations, err := s.storage.ListConversations(c.Request.Context(), limit, offset)
+	if err != nil {
+		writeFailure(c, err, "failed to list conversations")
+		return
+	}
+
+	total, err := s.storage.CountConversations(c.Request.Context())
+	if err != nil {
+		writeFailure(c, err, "failed to list conversations")
+		return
+	}
+
+	if conversations == nil {
+		conversations = []*models.Conversation{}
+	}
+
+	c.JSON(http.StatusOK, listConversationsResponse{
+		Conversations: conversations,
+		Total:         total,
+		Limit:         limit,
+		Offset:        offset,
+	})
+}
+
+// handleGetConversation returns a conversation with all of its messages.
+func (s *Server) handleGetConversation(c *gin.Context) {
+	conv, ok := s.lookupConversation(c)
+	if !ok {
+		return
+	}
+
+	messages, err := s.storage.ListMessages(c.Request.Context(), conv.ID, 0)
+	if err != nil {
+		writeFailure(c, err, "failed to get conversation")
+		return
+	}
+
+	if messages == nil {
+		messages = []*models.Message{}
+	}
+
+	c.JSON(http.StatusOK, conversationResponse{Conversation: conv, Messages: messages})
+}
+
+func (s *Server) handleRenameConversation(c *gin.Context) {
+	conv, ok := s.lookupConversation(c)
+	if !ok {
+		return
+	}
+
+	var req renameConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, "invalid JSON body")
+		return
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		badRequest(c, "title is required")
+		return
+	}
+
+	if err := s.storage.RenameConversation(c.Request.Context(), conv.ID, title); err != nil {
+		writeFailure(c, err, "failed to rename conversation")
+		return
+	}
+
+	renamed, err := s.storage.GetConversation(c.Request.Context(), conv.ID)
+	if err != nil {
+		writeFailure(c, err, "failed to rename conversation")
+		return
+	}
+
+	c.JSON(http.StatusOK, renamed)
+}
+
+func (s *Server) handleDeleteConversation(c *gin.Context) {
+	conv, ok := s.lookupConversation(c)
+	if !ok {
+		return
+	}
+
+	if err := s.storage.DeleteConversation(c.Request.Context(), conv.ID); err != nil && !errors.Is(err, storage.ErrConversationNotFound) {
+		writeFailure(c, err, "failed to delete conversation")
+		return
+	}
+
+	slog.Info("Conversation deleted", "conversation_id", conv.ID)
+	c.Status(http.StatusNoContent)
+}
+
+// lookupConversation resolves the :id path parameter, writing the error
+// response itself when the conversation cannot be returned.
+func (s *Server) lookupConversation(c *gin.Context) (*models.Conversation, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id < 1 {
+		badRequest(c, "invalid conversation id")
+		return nil, false
+	}
+
+	conv, err := s.storage.GetConversation(c.Request.Context(), id)
+	if err != nil {
+		writeFailure(c, err, "failed to get conversation")
+		return nil, false
+	}
+
+	return conv, true
+}
+
+// loadHistory returns the recent messages of a conversation as LLM
+// history, or ErrConversationNotFound.
+func (s *Server) loadHistory(ctx context.Context, conversationID int) ([]llm.Message, error) {
+	if _, err := s.storage.GetConversation(ctx, conversationID); err != nil {
+		return nil, err
+	}
+
+	messages, err := s.storage.ListMessages(ctx, conversationID, historyMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	// Providers expect the conversation to open with a user turn.
+	for len(messages) > 0 && messages[0].Role != models.MessageRoleUser {
+		messages = messages[1:]
+	}
+
+	history := make([]llm.Message, 0, len(messages))
+	for _, msg := range messages {
+		history = append(history, llm.Message{Role: msg.Role, Content: msg.Content})
+	}
+	return history, nil
+}
+
+// saveExchange stores the question and its answer, starting a new
+// conversation when the request did not name one, and returns the
+// conversation ID.
+func (s *Server) saveExchange(ctx context.Context, req chatRequest, answer *rag.Answer) (int, error) {
+	conversationID := req.ConversationID
+	if conversationID == 0 {
+		conv, err := s.storage.CreateConversation(ctx, conversationTitle(req.Message))
+		if err != nil {
+			return 0, err
+		}
+		conversationID = conv.ID
+	}
+
+	question := &models.Message{Role: models.MessageRoleUser, Content: req.Message}
+	if answer.Question != req.Message {
+		question.StandaloneQuestion = answer.Question
+	}
+	reply := &models.Message{
+		Role:      models.MessageRoleAssistant,
+		Content:   answer.Response,
+		Sources:   toChatSources(answer.Sources, answer.Cited),
+		Citations: answer.Citations,
+	}
+
+	if err := s.storage.AddMessages(ctx, conversationID, question, reply); err != nil {
+		return 0, err
+	}
+	return conversationID, nil
+}
+
+// conversationTitle names a new conversation after the first line of its
+// first message.
+func conversationTitle(message string) string {
+	title, _, _ := strings.Cut(message, "\n")
+	title = strings.TrimSpace(title)
+	if utf8.RuneCountInString(title) <= maxTitleLength {
+		return title
+	}
+
+	// Cut at the last word boundary unless that loses too much.
+	title = string([]rune(title)[:maxTitleLength])
+	if i := strings.LastIndex(title, " "); i > len(title)/2 {
+		title = title[:i]
+	}
+	return title + "..."
+}
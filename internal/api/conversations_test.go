@@ -0,0 +1,90 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"rag-therapist/internal/llm"
+)
+
+func TestConversationEndpoints(t *testing.T) {
+	s := newTestServer(t, &fakeLLM{reply: "Keep a regular bedtime."}, 1<<20)
+
+	rec := serve(s, jsonRequest(t, http.MethodPost, "/chat", chatRequest{Message: "How can I sleep better?"}))
+	var answer chatResponse
+	decodeBody(t, rec, &answer)
+	if rec.Code != http.StatusOK || answer.ConversationID == 0 {
+		t.Fatalf("chat failed with %d: %s", rec.Code, rec.Body)
+	}
+	path := fmt.Sprintf("/conversations/%d", answer.ConversationID)
+
+	rec = serve(s, jsonRequest(t, http.MethodPost, "/chat", chatRequest{Message: "And on weekends?", ConversationID: answer.ConversationID}))
+	var followUp chatResponse
+	decodeBody(t, rec, &followUp)
+	if rec.Code != http.StatusOK || followUp.ConversationID != answer.ConversationID {
+		t.Fatalf("expected the follow-up in the same conversation, got %d %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(s, jsonRequest(t, http.MethodGet, path, nil))
+	var conv conversationResponse
+	decodeBody(t, rec, &conv)
+	if rec.Code != http.StatusOK || conv.MessageCount != 4 || len(conv.Messages) != 4 {
+		t.Fatalf("expected both exchanges in the conversation, got %d %s", rec.Code, rec.Body)
+	}
+	if conv.Messages[0].Role != llm.RoleUser || conv.Messages[0].Content != "How can I sleep better?" ||
+		conv.Messages[3].Role != llm.RoleAssistant || conv.Messages[3].Content != "Keep a regular bedtime." {
+		t.Errorf("expected the messages in order, got %+v", conv.Messages)
+	}
+
+	rec = serve(s, jsonRequest(t, http.MethodPatch, path, renameConversationRequest{Title: "  Sleep  "}))
+	var renamed conversationResponse
+	decodeBody(t, rec, &renamed)
+	if rec.Code != http.StatusOK || renamed.Title != "Sleep" {
+		t.Errorf("expected the conversation to be renamed, got %d %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(s, jsonRequest(t, http.MethodGet, "/conversations", nil))
+	var list listConversationsResponse
+	decodeBody(t, rec, &list)
+	if rec.Code != http.StatusOK || list.Total != 1 || len(list.Conversations) != 1 || list.Conversations[0].Title != "Sleep" {
+		t.Errorf("expected the renamed conversation in the list, got %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := serve(s, jsonRequest(t, http.MethodDelete, path, nil)); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 from the delete, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serve(s, jsonRequest(t, http.MethodGet, path, nil)); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after the delete, got %d", rec.Code)
+	}
+}
+
+func TestConversationErrors(t *testing.T) {
+	s := newTestServer(t, &fakeLLM{reply: "Keep a regular bedtime."}, 1<<20)
+
+	rec := serve(s, jsonRequest(t, http.MethodPost, "/chat", chatRequest{Message: "How can I sleep better?"}))
+	var answer chatResponse
+	decodeBody(t, rec, &answer)
+	path := fmt.Sprintf("/conversations/%d", answer.ConversationID)
+
+	tests := map[string]struct {
+		method, path string
+		body         interface{}
+		status       int
+		code         string
+	}{
+		"empty title":    {http.MethodPatch, path, renameConversationRequest{Title: " "}, http.StatusBadRequest, CodeInvalidRequest},
+		"unknown":        {http.MethodGet, "/conversations/999", nil, http.StatusNotFound, CodeNotFound},
+		"delete unknown": {http.MethodDelete, "/conversations/999", nil, http.StatusNotFound, CodeNotFound},
+		"invalid id":     {http.MethodGet, "/conversations/abc", nil, http.StatusBadRequest, CodeInvalidRequest},
+		"bad limit":      {http.MethodGet, "/conversations?limit=101", nil, http.StatusBadRequest, CodeInvalidRequest},
+	}
+	for name, tt := range tests {
+		rec := serve(s, jsonRequest(t, tt.method, tt.path, tt.body))
+		var resp errorResponse
+		decodeBody(t, rec, &resp)
+		if rec.Code != tt.status || resp.Code != tt.code {
+			t.Errorf("%s: expected %d %s, got %d %+v", name, tt.status, tt.code, rec.Code, resp)
+		}
+	}
+}
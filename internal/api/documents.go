@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"rag-therapist/pkg/models"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+type listDocumentsResponse struct {
+	Documents []*models.Document `json:"documents"`
+	Total     int                `json:"total"`
+	Limit     int                `json:"limit"`
+	Offset    int                `json:"offset"`
+}
+
+func (s *Server) handleListDocuments(c *gin.Context) {
+	limit, err := queryInt(c, "limit", defaultPageLimit)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		badRequest(c, "limit must be between 1 and 100")
+		return
+	}
+
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		badRequest(c, "offset must be a non-negative integer")
+		return
+	}
+
+	knowledgeBaseID, err := queryInt(c, "knowledge_base_id", 0)
+	if err != nil || knowledgeBaseID < 0 {
+		badRequest(c, "invalid knowledge_base_id")
+		return
+	}
+
+	documents, err := s.storage.ListDocuments(c.Request.Context(), knowledgeBaseID, limit, offset)
+	if err != nil {
+		writeFailure(c, err, "failed to list documents")
+		return
+	}
+
+	total, err := s.storage.CountDocuments(c.Request.Context(), knowledgeBaseID)
+	if err != nil {
+		writeFailure(c, err, "failed to list documents")
+		return
+	}
+
+	if documents == nil {
+		documents = []*models.Document{}
+	}
+
+	c.JSON(http.StatusOK, listDocumentsResponse{
+		Documents: documents,
+		Total:     total,
+		Limit:     limit,
+		Offset:    offset,
+	})
+}
+
+func (s *Server) handleGetDocument(c *gin.Context) {
+	doc, ok := s.lookupDocument(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, doc)
+}
+
+func (s *Server) handleDeleteDocument(c *gin.Context) {
+	doc, ok := s.lookupDocument(c)
+	if !ok {
+		return
+	}
+
+	// The worker would store its chunks again after they are deleted.
+	if doc.Status == models.DocumentStatusProcessing {
+		writeError(c, http.StatusConflict, CodeConflict, "document is currently being processed")
+		return
+	}
+
+	// Chunks go first: if this fails the document row is kept, so Chroma
+	// never holds chunks for a document SQLite no longer knows about.
+	if err := s.deleteDocumentChunks(c.Request.Context(), doc); err != nil {
+		writeFailure(c, err, "failed to delete document chunks")
+		return
+	}
+
+	if err := s.storage.DeleteDocument(c.Request.Context(), doc.ID); err != nil {
+		writeFailure(c, err, "failed to delete document")
+		return
+	}
+
+	slog.Info("Document deleted", "document_id", doc.ID, "file_name", doc.FileName)
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) handleReprocessDocument(c *gin.Context) {
+	doc, ok := s.lookupDocument(c)
+	if !ok {
+		return
+	}
+
+	if doc.Status == models.DocumentStatusProcessing {
+		writeError(c, http.StatusConflict, CodeConflict, "document is currently being processed")
+		return
+	}
+
+	if err := s.deleteDocumentChunks(c.Request.Context(), doc); err != nil {
+		writeFailure(c, err, "failed to delete document chunks")
+		return
+	}
+
+	if err := s.storage.RequeueDocument(c.Request.Context(), doc.ID); err != nil {
+		writeFailure(c, err, "failed to requeue document")
+		return
+	}
+
+	doc.Status = models.DocumentStatusPending
+	doc.ProcessedAt = nil
+	doc.ErrorMessage = ""
+
+	slog.Info("Document queued for reprocessing", "document_id", doc.ID)
+	s.notifyWorkers(doc)
+	c.JSON(http.StatusAccepted, doc)
+}
+
+// deleteDocumentChunks removes a document's chunks from the collection of
+// its knowledge base.
+func (s *Server) deleteDocumentChunks(ctx context.Context, doc *models.Document) error {
+	base, err := s.knowledgeBases.Get(ctx, doc.KnowledgeBaseID)
+	if err != nil {
+		return err
+	}
+	return base.Vectors.DeleteDocumentChunks(ctx, doc.ID)
+}
+
+// lookupDocument resolves the :id path parameter, writing the error
+// response itself when the document cannot be returned.
+func (s *Server) lookupDocument(c *gin.Context) (*models.Document, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id < 1 {
+		badRequest(c, "invalid document id")
+		return nil, false
+	}
+
+	doc, err := s.storage.GetDocument(c.Request.Context(), id)
+	if err != nil {
+		writeFailure(c, err, "failed to get document")
+		return nil, false
+	}
+
+	return doc, true
+}
+
+func queryInt(c *gin.Context, key string, defaultValue int) (int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
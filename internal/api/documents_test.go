@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"rag-therapist/pkg/models"
+)
+
+// uploadTestDocument uploads a small PDF named name and returns its ID.
+func uploadTestDocument(t *testing.T, s *Server, name string) int {
+	t.Helper()
+
+	rec := serve(s, uploadRequest(t, name, "%PDF-1.4 content of "+name, nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("upload of %s failed with %d: %s", name, rec.Code, rec.Body)
+	}
+	var uploaded uploadResponse
+	decodeBody(t, rec, &uploaded)
+	return uploaded.ID
+}
+
+func TestDocumentEndpoints(t *testing.T) {
+	s := newTestServer(t, &fakeLLM{}, 1<<20)
+	first := uploadTestDocument(t, s, "first.pdf")
+	uploadTestDocument(t, s, "second.pdf")
+
+	rec := serve(s, jsonRequest(t, http.MethodGet, "/documents?limit=1", nil))
+	var page listDocumentsResponse
+	decodeBody(t, rec, &page)
+	if rec.Code != http.StatusOK || page.Total != 2 || len(page.Documents) != 1 || page.Limit != 1 {
+		t.Errorf("expected a page of one of two documents, got %d %+v", rec.Code, page)
+	}
+
+	rec = serve(s, jsonRequest(t, http.MethodGet, fmt.Sprintf("/documents/%d", first), nil))
+	var doc models.Document
+	decodeBody(t, rec, &doc)
+	if rec.Code != http.StatusOK || doc.FileName != "first.pdf" {
+		t.Errorf("expected first.pdf, got %d %+v", rec.Code, doc)
+	}
+
+	rec = serve(s, jsonRequest(t, http.MethodPost, fmt.Sprintf("/documents/%d/reprocess", first), nil))
+	decodeBody(t, rec, &doc)
+	if rec.Code != http.StatusAccepted || doc.Status != models.DocumentStatusPending {
+		t.Errorf("expected the document to be requeued, got %d %+v", rec.Code, doc)
+	}
+
+	tests := map[string]struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		"invalid id":      {http.MethodGet, "/documents/abc", http.StatusBadRequest, CodeInvalidRequest},
+		"unknown":         {http.MethodGet, "/documents/999", http.StatusNotFound, CodeNotFound},
+		"delete unknown":  {http.MethodDelete, "/documents/999", http.StatusNotFound, CodeNotFound},
+		"bad limit":       {http.MethodGet, "/documents?limit=0", http.StatusBadRequest, CodeInvalidRequest},
+		"bad offset":      {http.MethodGet, "/documents?offset=-1", http.StatusBadRequest, CodeInvalidRequest},
+		"bad base filter": {http.MethodGet, "/documents?knowledge_base_id=x", http.StatusBadRequest, CodeInvalidRequest},
+	}
+	for name, tt := range tests {
+		rec := serve(s, jsonRequest(t, tt.method, tt.path, nil))
+		var resp errorResponse
+		decodeBody(t, rec, &resp)
+		if rec.Code != tt.status || resp.Code != tt.code {
+			t.Errorf("%s: expected %d %s, got %d %+v", name, tt.status, tt.code, rec.Code, resp)
+		}
+	}
+}
+
+func TestDeleteProcessingDocument(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, &fakeLLM{}, 1<<20)
+	id := uploadTestDocument(t, s, "busy.pdf")
+
+	job, _, err := s.storage.ClaimJob(ctx, "worker", time.Minute)
+	if err != nil || job == nil {
+		t.Fatalf("ClaimJob failed: %v", err)
+	}
+
+	path := fmt.Sprintf("/documents/%d", id)
+	for _, req := range []*http.Request{
+		jsonRequest(t, http.MethodDelete, path, nil),
+		jsonRequest(t, http.MethodPost, path+"/reprocess", nil),
+	} {
+		rec := serve(s, req)
+		var resp errorResponse
+		decodeBody(t, rec, &resp)
+		if rec.Code != http.StatusConflict || resp.Code != CodeConflict {
+			t.Errorf("%s %s: expected 409 conflict while processing, got %d %+v", req.Method, req.URL.Path, rec.Code, resp)
+		}
+	}
+
+	if err := s.storage.CompleteJob(ctx, job); err != nil {
+		t.Fatalf("CompleteJob failed: %v", err)
+	}
+	if rec := serve(s, jsonRequest(t, http.MethodDelete, path, nil)); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 once processed, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serve(s, jsonRequest(t, http.MethodGet, path, nil)); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after the delete, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"rag-therapist/internal/storage"
+)
+
+// Error codes tell clients what went wrong without parsing messages. They
+// are part of the API and never change meaning.
+const (
+	CodeInvalidRequest  = "invalid_request"
+	CodeTooLarge        = "too_large"
+	CodeUnsupportedType = "unsupported_type"
+	CodeInvalidDocument = "invalid_document"
+	CodeNotFound        = "not_found"
+	CodeDuplicate       = "duplicate"
+	CodeConflict        = "conflict"
+	CodeUnavailable     = "unavailable"
+	CodeInternal        = "internal"
+)
+
+// errorResponse is the body of every error response and of the "error"
+// event of /chat/stream.
+type errorResponse struct {
+	Code  string `json:"code"`
+	Error string `json:"error"`
+	// DocumentID names the existing document when an upload is a
+	// duplicate.
+	DocumentID int `json:"document_id,omitempty"`
+}
+
+// writeError answers with the given status, code and message.
+func writeError(c *gin.Context, status int, code, message string) {
+	c.JSON(status, errorResponse{Code: code, Error: message})
+}
+
+func badRequest(c *gin.Context, message string) {
+	writeError(c, http.StatusBadRequest, CodeInvalidRequest, message)
+}
+
+// writeFailure answers for an error returned by a service. Errors in the
+// storage categories map to 4xx statuses or 503. Client errors carry their own
+// message; server errors are logged and answered with message.
+func writeFailure(c *gin.Context, err error, message string) {
+	resp, status := failureResponse(err, message)
+	if status >= http.StatusInternalServerError {
+		slog.Error("Request failed", "method", c.Request.Method, "path", c.Request.URL.Path, "error", err)
+	}
+	c.JSON(status, resp)
+}
+
+func failureResponse(err error, message string) (errorResponse, int) {
+	switch {
+	case errors.Is(err, storage.ErrDocumentTooLarge):
+		return errorResponse{Code: CodeTooLarge, Error: err.Error()}, http.StatusRequestEntityTooLarge
+	case errors.Is(err, storage.ErrUnsupportedDocument):
+		return errorResponse{Code: CodeUnsupportedType, Error: err.Error()}, http.StatusUnsupportedMediaType
+	case errors.Is(err, storage.ErrInvalidDocument):
+		return errorResponse{Code: CodeInvalidDocument, Error: err.Error()}, http.StatusUnprocessableEntity
+	case errors.Is(err, storage.ErrInvalid):
+		return errorResponse{Code: CodeInvalidRequest, Error: err.Error()}, http.StatusBadRequest
+	case errors.Is(err, storage.ErrNotFound):
+		return errorResponse{Code: CodeNotFound, Error: err.Error()}, http.StatusNotFound
+	case errors.Is(err, storage.ErrDuplicate):
+		return errorResponse{Code: CodeDuplicate, Error: err.Error()}, http.StatusConflict
+	case errors.Is(err, storage.ErrConflict):
+		return errorResponse{Code: CodeConflict, Error: err.Error()}, http.StatusConflict
+	case errors.Is(err, storage.ErrUnavailable):
+		return errorResponse{Code: CodeUnavailable, Error: message}, http.StatusServiceUnavailable
+	}
+	return errorResponse{Code: CodeInternal, Error: message}, http.StatusInternalServerError
+}
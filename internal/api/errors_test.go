@@ -0,0 +1,61 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"rag-therapist/internal/storage"
+)
+
+func TestWriteFailure(t *testing.T) {
+	tests := map[string]struct {
+		err    error
+		status int
+		code   string
+		body   string
+	}{
+		"too large":     {storage.ErrDocumentTooLarge, http.StatusRequestEntityTooLarge, CodeTooLarge, storage.ErrDocumentTooLarge.Error()},
+		"unsupported":   {storage.ErrUnsupportedDocument, http.StatusUnsupportedMediaType, CodeUnsupportedType, storage.ErrUnsupportedDocument.Error()},
+		"invalid pdf":   {fmt.Errorf("%w: broken xref", storage.ErrInvalidDocument), http.StatusUnprocessableEntity, CodeInvalidDocument, storage.ErrInvalidDocument.Error() + ": broken xref"},
+		"invalid":       {storage.Invalid(errors.New("limit must be positive")), http.StatusBadRequest, CodeInvalidRequest, "limit must be positive"},
+		"not found":     {storage.ErrDocumentNotFound, http.StatusNotFound, CodeNotFound, storage.ErrDocumentNotFound.Error()},
+		"duplicate":     {storage.ErrKnowledgeBaseExists, http.StatusConflict, CodeDuplicate, storage.ErrKnowledgeBaseExists.Error()},
+		"conflict":      {storage.ErrDocumentProcessing, http.StatusConflict, CodeConflict, storage.ErrDocumentProcessing.Error()},
+		"unavailable":   {fmt.Errorf("search: %w", storage.ErrVectorStoreUnavailable), http.StatusServiceUnavailable, CodeUnavailable, "failed to search"},
+		"uncategorized": {errors.New("disk on fire"), http.StatusInternalServerError, CodeInternal, "failed to search"},
+		"wrapped twice": {fmt.Errorf("outer: %w", fmt.Errorf("inner: %w", storage.ErrConversationNotFound)), http.StatusNotFound, CodeNotFound, "outer: inner: " + storage.ErrConversationNotFound.Error()},
+	}
+	for name, tt := range tests {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest(http.MethodGet, "/search", nil)
+
+		writeFailure(c, tt.err, "failed to search")
+
+		var resp map[string]interface{}
+		decodeBody(t, rec, &resp)
+		if rec.Code != tt.status || resp["code"] != tt.code || resp["error"] != tt.body {
+			t.Errorf("%s: expected %d %s %q, got %d %v", name, tt.status, tt.code, tt.body, rec.Code, resp)
+		}
+		if _, ok := resp["document_id"]; ok || len(resp) != 2 {
+			t.Errorf("%s: expected only code and error in the envelope, got %v", name, resp)
+		}
+	}
+}
+
+func TestDuplicateUpload(t *testing.T) {
+	s := newTestServer(t, &fakeLLM{}, 1<<20)
+	id := uploadTestDocument(t, s, "notes.pdf")
+
+	rec := serve(s, uploadRequest(t, "copy.pdf", "%PDF-1.4 content of notes.pdf", nil))
+	var resp errorResponse
+	decodeBody(t, rec, &resp)
+	if rec.Code != http.StatusConflict || resp.Code != CodeDuplicate || resp.DocumentID != id || resp.Error == "" {
+		t.Errorf("expected 409 duplicate naming document %d, got %d %+v", id, rec.Code, resp)
+	}
+}
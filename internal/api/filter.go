@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"rag-therapist/internal/storage"
+)
+
+// chatFilter is the JSON form of storage.SearchFilter accepted by /chat.
+type chatFilter struct {
+	DocumentIDs    []int                     `json:"document_ids,omitempty"`
+	Tags           []string                  `json:"tags,omitempty"`
+	PageFrom       int                       `json:"page_from,omitempty"`
+	PageTo         int                       `json:"page_to,omitempty"`
+	UploadedAfter  *time.Time                `json:"uploaded_after,omitempty"`
+	UploadedBefore *time.Time                `json:"uploaded_before,omitempty"`
+	Metadata       map[string]metadataValues `json:"metadata,omitempty"`
+}
+
+func (f *chatFilter) searchFilter() *storage.SearchFilter {
+	if f == nil {
+		return nil
+	}
+
+	filter := &storage.SearchFilter{
+		DocumentIDs:    f.DocumentIDs,
+		Tags:           storage.NormalizeTags(f.Tags),
+		PageFrom:       f.PageFrom,
+		PageTo:         f.PageTo,
+		UploadedAfter:  f.UploadedAfter,
+		UploadedBefore: f.UploadedBefore,
+	}
+	if len(f.Metadata) > 0 {
+		filter.Metadata = make(map[string][]string, len(f.Metadata))
+		for key, values := range f.Metadata {
+			filter.Metadata[key] = values
+		}
+	}
+	return filter
+}
+
+// metadataValues accepts a single value for equality or an array for
+// "any of". Numbers and booleans are matched by their text form, since
+// chunk metadata is stored as strings.
+type metadataValues []string
+
+func (v *metadataValues) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	items, ok := raw.([]interface{})
+	if !ok {
+		items = []interface{}{raw}
+	}
+
+	values := make(metadataValues, 0, len(items))
+	for _, item := range items {
+		switch item := item.(type) {
+		case string:
+			values = append(values, item)
+		case float64:
+			values = append(values, strconv.FormatFloat(item, 'f', -1, 64))
+		case bool:
+			values = append(values, strconv.FormatBool(item))
+		default:
+			return fmt.Errorf("metadata values must be strings, numbers or booleans")
+		}
+	}
+
+	*v = values
+	return nil
+}
+
+// parseTags splits comma-separated tag form values.
+func parseTags(fields []string) []string {
+	var tags []string
+	for _, field := range fields {
+		tags = append(tags, strings.Split(field, ",")...)
+	}
+	return storage.NormalizeTags(tags)
+}
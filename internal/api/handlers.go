@@ -0,0 +1,267 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"rag-therapist/internal/llm"
+	"rag-therapist/internal/rag"
+	"rag-therapist/internal/storage"
+	"rag-therapist/pkg/models"
+)
+
+// multipartOverhead is room in the /upload body for the multipart framing
+// and the form fields besides the file.
+const multipartOverhead = 1 << 20
+
+type uploadResponse struct {
+	ID              int       `json:"id"`
+	KnowledgeBaseID int       `json:"knowledge_base_id"`
+	FileName        string    `json:"file_name"`
+	Status          string    `json:"status"`
+	Tags            []string  `json:"tags,omitempty"`
+	UploadedAt      time.Time `json:"uploaded_at"`
+}
+
+type chatRequest struct {
+	Message string `json:"message"`
+	// ConversationID continues a conversation; without it a new one is
+	// started.
+	ConversationID   int         `json:"conversation_id,omitempty"`
+	KnowledgeBaseIDs []int       `json:"knowledge_base_ids,omitempty"`
+	VectorWeight     *float64    `json:"vector_weight,omitempty"`
+	KeywordWeight    *float64    `json:"keyword_weight,omitempty"`
+	Filter           *chatFilter `json:"filter,omitempty"`
+	// Neighbors adds this many chunks around each hit to the context.
+	Neighbors *int     `json:"neighbors,omitempty"`
+	MMRLambda *float64 `json:"mmr_lambda,omitempty"`
+	// Agent lets the LLM search with tools before answering instead of
+	// retrieving once.
+	Agent bool `json:"agent,omitempty"`
+
+	// history is loaded from the conversation by bindChatRequest.
+	history []llm.Message
+}
+
+func (r chatRequest) queryOptions() rag.QueryOptions {
+	return rag.QueryOptions{
+		KnowledgeBaseIDs: r.KnowledgeBaseIDs,
+		VectorWeight:     r.VectorWeight,
+		KeywordWeight:    r.KeywordWeight,
+		Filter:           r.Filter.searchFilter(),
+		History:          r.history,
+		Neighbors:        r.Neighbors,
+		MMRLambda:        r.MMRLambda,
+	}
+}
+
+type chatResponse struct {
+	ConversationID int    `json:"conversation_id"`
+	Response       string `json:"response"`
+	// StandaloneQuestion is the follow-up as rewritten for retrieval.
+	StandaloneQuestion string                 `json:"standalone_question,omitempty"`
+	Sources            []models.MessageSource `json:"sources"`
+	Citations          []models.Citation      `json:"citations"`
+	// Trace lists the tool calls made in agent mode.
+	Trace []rag.TraceEntry `json:"trace,omitempty"`
+}
+
+// handleUpload stores a PDF and queues it for processing. The request body
+// is capped while it is read, so an oversized upload is refused without
+// being buffered in full; the storage layer enforces the exact limit.
+func (s *Server) handleUpload(c *gin.Context) {
+	if s.maxUploadSize > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, s.maxUploadSize+multipartOverhead)
+	}
+
+	fileHeader, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(c, http.StatusRequestEntityTooLarge, CodeTooLarge,
+			fmt.Sprintf("%v: the limit is %d bytes", storage.ErrDocumentTooLarge, s.maxUploadSize))
+		return
+	}
+	if err != nil {
+		badRequest(c, "multipart field \"file\" is required")
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		badRequest(c, "failed to read uploaded file")
+		return
+	}
+	defer file.Close()
+
+	knowledgeBaseID, ok := s.uploadKnowledgeBase(c)
+	if !ok {
+		return
+	}
+	tags := parseTags(c.PostFormArray("tags"))
+
+	doc, err := s.storage.StoreDocument(c.Request.Context(), knowledgeBaseID, fileHeader.Filename, file, tags)
+	if errors.Is(err, storage.ErrDuplicateDocument) {
+		c.JSON(http.StatusConflict, errorResponse{Code: CodeDuplicate, Error: err.Error(), DocumentID: doc.ID})
+		return
+	}
+	if err != nil {
+		writeFailure(c, err, "failed to store document")
+		return
+	}
+
+	slog.Info("Document uploaded", "document_id", doc.ID, "file_name", doc.FileName, "size", doc.FileSize)
+	s.notifyWorkers(doc)
+
+	c.JSON(http.StatusAccepted, uploadResponse{
+		ID:              doc.ID,
+		KnowledgeBaseID: doc.KnowledgeBaseID,
+		FileName:        doc.FileName,
+		Status:          doc.Status,
+		Tags:            doc.Tags,
+		UploadedAt:      doc.UploadedAt,
+	})
+}
+
+// uploadKnowledgeBase resolves the optional knowledge_base_id form field,
+// defaulting to the default knowledge base, and writes the error response
+// itself when it cannot be used.
+func (s *Server) uploadKnowledgeBase(c *gin.Context) (int, bool) {
+	value := c.PostForm("knowledge_base_id")
+	if value == "" {
+		kb, err := s.storage.DefaultKnowledgeBase(c.Request.Context())
+		if err != nil {
+			writeFailure(c, err, "failed to store document")
+			return 0, false
+		}
+		return kb.ID, true
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 1 {
+		badRequest(c, "invalid knowledge_base_id")
+		return 0, false
+	}
+
+	if _, err := s.storage.GetKnowledgeBase(c.Request.Context(), id); err != nil {
+		writeFailure(c, err, "failed to store document")
+		return 0, false
+	}
+
+	return id, true
+}
+
+func (s *Server) handleChat(c *gin.Context) {
+	req, ok := s.bindChatRequest(c)
+	if !ok {
+		return
+	}
+
+	var answer *rag.Answer
+	var err error
+	if req.Agent {
+		answer, err = s.agent.Answer(c.Request.Context(), req.Message, req.queryOptions())
+	} else {
+		answer, err = s.pipeline.Answer(c.Request.Context(), req.Message, req.queryOptions())
+	}
+	if err != nil {
+		writeFailure(c, err, "failed to generate response")
+		return
+	}
+
+	conversationID, err := s.saveExchange(c.Request.Context(), req, answer)
+	if err != nil {
+		writeFailure(c, err, "failed to save conversation")
+		return
+	}
+
+	resp := chatResponse{
+		ConversationID: conversationID,
+		Response:       answer.Response,
+		Sources:        toChatSources(answer.Sources, answer.Cited),
+		Citations:      toChatCitations(answer.Citations),
+		Trace:          answer.Trace,
+	}
+	if answer.Question != req.Message {
+		resp.StandaloneQuestion = answer.Question
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// bindChatRequest decodes and validates a chat request, writing the error
+// response itself when the request cannot be served.
+func (s *Server) bindChatRequest(c *gin.Context) (chatRequest, bool) {
+	var req chatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, "invalid JSON body")
+		return req, false
+	}
+
+	req.Message = strings.TrimSpace(req.Message)
+	if req.Message == "" {
+		badRequest(c, "message is required")
+		return req, false
+	}
+
+	if s.pipeline == nil {
+		writeError(c, http.StatusServiceUnavailable, CodeUnavailable, "chat is not configured")
+		return req, false
+	}
+	if req.Agent && s.agent == nil {
+		writeError(c, http.StatusServiceUnavailable, CodeUnavailable, "agent mode is not configured")
+		return req, false
+	}
+
+	if req.ConversationID < 0 {
+		badRequest(c, "invalid conversation_id")
+		return req, false
+	}
+	if req.ConversationID > 0 {
+		history, err := s.loadHistory(c.Request.Context(), req.ConversationID)
+		if err != nil {
+			writeFailure(c, err, "failed to load conversation")
+			return req, false
+		}
+		req.history = history
+	}
+
+	// Bad options are answered with 400 and unknown knowledge bases with
+	// 404; failing to open a knowledge base is a server error.
+	if err := s.pipeline.ValidateOptions(c.Request.Context(), req.queryOptions()); err != nil {
+		writeFailure(c, err, "failed to open knowledge bases")
+		return req, false
+	}
+
+	return req, true
+}
+
+// toChatSources converts search results to sources, flagging those whose
+// ID is in cited. cited is nil before the answer exists.
+func toChatSources(results []storage.SearchResult, cited map[string]bool) []models.MessageSource {
+	sources := make([]models.MessageSource, 0, len(results))
+	for _, result := range results {
+		sources = append(sources, models.MessageSource{
+			DocumentID:     result.DocumentID,
+			ChunkID:        result.ID,
+			RelevanceScore: result.Score,
+			Similarity:     result.Similarity,
+			Cited:          cited[result.ID],
+		})
+	}
+	return sources
+}
+
+// toChatCitations returns citations as a non-nil slice, so responses
+// always hold a list.
+func toChatCitations(citations []models.Citation) []models.Citation {
+	if citations == nil {
+		return []models.Citation{}
+	}
+	return citations
+}
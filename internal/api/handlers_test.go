@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"rag-therapist/pkg/models"
+)
+
+func TestUploadThenChat(t *testing.T) {
+	s := newTestServer(t, &fakeLLM{reply: "Keep a regular bedtime."}, 1<<20)
+
+	rec := serve(s, uploadRequest(t, "notes.pdf", "%PDF-1.4 sleep notes", map[string]string{"tags": "sleep"}))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 from /upload, got %d: %s", rec.Code, rec.Body)
+	}
+	var uploaded uploadResponse
+	decodeBody(t, rec, &uploaded)
+	if uploaded.ID == 0 || uploaded.FileName != "notes.pdf" || uploaded.Status != models.DocumentStatusPending {
+		t.Errorf("unexpected upload response %+v", uploaded)
+	}
+
+	rec = serve(s, jsonRequest(t, http.MethodPost, "/chat", chatRequest{Message: "How can I sleep better?"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 from /chat, got %d: %s", rec.Code, rec.Body)
+	}
+	var answer chatResponse
+	decodeBody(t, rec, &answer)
+	if answer.Response != "Keep a regular bedtime." || answer.ConversationID == 0 {
+		t.Errorf("unexpected chat response %+v", answer)
+	}
+}
+
+func TestChatValidation(t *testing.T) {
+	s := newTestServer(t, &fakeLLM{reply: "unused"}, 1<<20)
+
+	tests := map[string]struct {
+		body   interface{}
+		status int
+		code   string
+	}{
+		"empty message":          {chatRequest{Message: "  "}, http.StatusBadRequest, CodeInvalidRequest},
+		"not json":               {"not an object", http.StatusBadRequest, CodeInvalidRequest},
+		"unknown knowledge base": {chatRequest{Message: "hi", KnowledgeBaseIDs: []int{999}}, http.StatusNotFound, CodeNotFound},
+		"unknown conversation":   {chatRequest{Message: "hi", ConversationID: 999}, http.StatusNotFound, CodeNotFound},
+	}
+	for name, tt := range tests {
+		rec := serve(s, jsonRequest(t, http.MethodPost, "/chat", tt.body))
+		var resp errorResponse
+		decodeBody(t, rec, &resp)
+		if rec.Code != tt.status || resp.Code != tt.code || resp.Error == "" {
+			t.Errorf("%s: expected %d %s, got %d %+v", name, tt.status, tt.code, rec.Code, resp)
+		}
+	}
+}
+
+func TestUploadValidation(t *testing.T) {
+	s := newTestServer(t, &fakeLLM{}, 64)
+
+	tests := map[string]struct {
+		content string
+		status  int
+		code    string
+	}{
+		"over the limit":     {"%PDF-1.4 " + strings.Repeat("x", 64), http.StatusRequestEntityTooLarge, CodeTooLarge},
+		"far over the limit": {"%PDF-1.4 " + strings.Repeat("x", 2*multipartOverhead), http.StatusRequestEntityTooLarge, CodeTooLarge},
+		"not a pdf":          {"plain text", http.StatusUnsupportedMediaType, CodeUnsupportedType},
+		"header not first":   {"<html>%PDF-1.4", http.StatusUnsupportedMediaType, CodeUnsupportedType},
+		"empty":              {"", http.StatusUnsupportedMediaType, CodeUnsupportedType},
+		"fails the check":    {"%PDF-1.4 /Encrypt", http.StatusUnprocessableEntity, CodeInvalidDocument},
+	}
+	for name, tt := range tests {
+		rec := serve(s, uploadRequest(t, "upload.pdf", tt.content, nil))
+		var resp errorResponse
+		decodeBody(t, rec, &resp)
+		if rec.Code != tt.status || resp.Code != tt.code || resp.Error == "" {
+			t.Errorf("%s: expected %d %s, got %d %+v", name, tt.status, tt.code, rec.Code, resp)
+		}
+	}
+
+	rec := serve(s, jsonRequest(t, http.MethodGet, "/documents", nil))
+	var page listDocumentsResponse
+	decodeBody(t, rec, &page)
+	if page.Total != 0 {
+		t.Errorf("expected rejected uploads not to be stored, got %d documents", page.Total)
+	}
+
+	rec = serve(s, jsonRequest(t, http.MethodPost, "/upload", nil))
+	var resp errorResponse
+	decodeBody(t, rec, &resp)
+	if rec.Code != http.StatusBadRequest || resp.Code != CodeInvalidRequest {
+		t.Errorf("expected 400 without a file, got %d %+v", rec.Code, resp)
+	}
+}
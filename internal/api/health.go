@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"rag-therapist/internal/health"
+)
+
+type readinessResponse struct {
+	Status string          `json:"status"`
+	Checks []health.Result `json:"checks"`
+}
+
+// collectionStatus is what the vector store reports about a knowledge
+// base's collection.
+type collectionStatus struct {
+	KnowledgeBaseID int                    `json:"knowledge_base_id"`
+	Name            string                 `json:"name"`
+	Collection      string                 `json:"collection"`
+	Stats           map[string]interface{} `json:"stats,omitempty"`
+	Error           string                 `json:"error,omitempty"`
+}
+
+type statusResponse struct {
+	Status              string             `json:"status"`
+	StartedAt           time.Time          `json:"started_at"`
+	UptimeSeconds       int64              `json:"uptime_seconds"`
+	Checks              []health.Result    `json:"checks"`
+	Collections         []collectionStatus `json:"collections"`
+	Documents           map[string]int     `json:"documents"`
+	DocumentsError      string             `json:"documents_error,omitempty"`
+	KnowledgeBasesError string             `json:"knowledge_bases_error,omitempty"`
+}
+
+// handleHealthz answers as long as the process serves requests.
+func (s *Server) handleHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// handleReadyz runs the dependency checks and answers 503 if any fails.
+func (s *Server) handleReadyz(c *gin.Context) {
+	results := s.runChecks(c.Request.Context())
+	if !health.Healthy(results) {
+		c.JSON(http.StatusServiceUnavailable, readinessResponse{Status: "not_ready", Checks: results})
+		return
+	}
+	c.JSON(http.StatusOK, readinessResponse{Status: "ready", Checks: results})
+}
+
+// handleStatus reports the checks with their latency and last error, the
+// collection stats of every knowledge base and the document counts by
+// status. It always answers 200 so it stays readable while degraded.
+func (s *Server) handleStatus(c *gin.Context) {
+	ctx := c.Request.Context()
+	results := s.runChecks(ctx)
+
+	resp := statusResponse{
+		Status:        "ok",
+		StartedAt:     s.startedAt,
+		UptimeSeconds: int64(time.Since(s.startedAt).Seconds()),
+		Checks:        results,
+		Collections:   []collectionStatus{},
+	}
+	if !health.Healthy(results) {
+		resp.Status = "degraded"
+	}
+
+	counts, err := s.storage.CountDocumentsByStatus(ctx)
+	if err != nil {
+		resp.DocumentsError = err.Error()
+	}
+	resp.Documents = counts
+
+	bases, err := s.storage.ListKnowledgeBases(ctx)
+	if err != nil {
+		resp.KnowledgeBasesError = err.Error()
+	}
+	for _, kb := range bases {
+		collection := collectionStatus{KnowledgeBaseID: kb.ID, Name: kb.Name, Collection: kb.CollectionName}
+
+		// stats is only read once the call returned in time.
+		var stats map[string]interface{}
+		err := health.WithTimeout(ctx, s.checkTimeout, func(ctx context.Context) error {
+			base, err := s.knowledgeBases.Get(ctx, kb.ID)
+			if err != nil {
+				return err
+			}
+			stats, err = base.Vectors.GetStats(ctx)
+			return err
+		})
+		if err != nil {
+			collection.Error = err.Error()
+		} else {
+			collection.Stats = stats
+		}
+		resp.Collections = append(resp.Collections, collection)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// runChecks runs the dependency checks, if any are configured.
+func (s *Server) runChecks(ctx context.Context) []health.Result {
+	if s.health == nil {
+		return []health.Result{}
+	}
+	return s.health.Run(ctx)
+}
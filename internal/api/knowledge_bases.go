@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"rag-therapist/internal/knowledge"
+	"rag-therapist/internal/storage"
+	"rag-therapist/pkg/models"
+)
+
+// knowledgeBaseRequest creates or updates a knowledge base. Unset fields
+// keep their current value, or the configured default on create.
+type knowledgeBaseRequest struct {
+	Name                *string `json:"name"`
+	Description         *string `json:"description"`
+	EmbeddingModel      *string `json:"embedding_model"`
+	EmbeddingDimensions *int    `json:"embedding_dimensions"`
+	ChunkStrategy       *string `json:"chunk_strategy"`
+	ChunkSize           *int    `json:"chunk_size"`
+	ChunkOverlap        *int    `json:"chunk_overlap"`
+}
+
+func (r knowledgeBaseRequest) apply(kb *models.KnowledgeBase) {
+	if r.Name != nil {
+		kb.Name = strings.TrimSpace(*r.Name)
+	}
+	if r.Description != nil {
+		kb.Description = *r.Description
+	}
+	if r.EmbeddingModel != nil {
+		kb.EmbeddingModel = strings.TrimSpace(*r.EmbeddingModel)
+	}
+	if r.EmbeddingDimensions != nil {
+		kb.EmbeddingDimensions = *r.EmbeddingDimensions
+	}
+	if r.ChunkStrategy != nil {
+		kb.ChunkStrategy = *r.ChunkStrategy
+	}
+	if r.ChunkSize != nil {
+		kb.ChunkSize = *r.ChunkSize
+	}
+	if r.ChunkOverlap != nil {
+		kb.ChunkOverlap = *r.ChunkOverlap
+	}
+}
+
+type knowledgeBaseResponse struct {
+	*models.KnowledgeBase
+	DocumentCount int `json:"document_count"`
+}
+
+type listKnowledgeBasesResponse struct {
+	KnowledgeBases []knowledgeBaseResponse `json:"knowledge_bases"`
+}
+
+func (s *Server) handleListKnowledgeBases(c *gin.Context) {
+	bases, err := s.storage.ListKnowledgeBases(c.Request.Context())
+	if err != nil {
+		writeFailure(c, err, "failed to list knowledge bases")
+		return
+	}
+
+	resp := listKnowledgeBasesResponse{KnowledgeBases: make([]knowledgeBaseResponse, 0, len(bases))}
+	for _, kb := range bases {
+		item, err := s.knowledgeBaseResponse(c.Request.Context(), kb)
+		if err != nil {
+			writeFailure(c, err, "failed to list knowledge bases")
+			return
+		}
+		resp.KnowledgeBases = append(resp.KnowledgeBases, item)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) handleCreateKnowledgeBase(c *gin.Context) {
+	var req knowledgeBaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, "invalid JSON body")
+		return
+	}
+
+	kb := s.knowledgeBases.NewKnowledgeBase("")
+	req.apply(&kb)
+	if err := knowledge.Validate(&kb); err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	if err := s.storage.CreateKnowledgeBase(c.Request.Context(), &kb); err != nil {
+		writeFailure(c, err, "failed to create knowledge base")
+		return
+	}
+
+	slog.Info("Knowledge base created", "knowledge_base_id", kb.ID, "name", kb.Name, "collection", kb.CollectionName)
+	c.JSON(http.StatusCreated, knowledgeBaseResponse{KnowledgeBase: &kb})
+}
+
+func (s *Server) handleGetKnowledgeBase(c *gin.Context) {
+	kb, ok := s.lookupKnowledgeBase(c)
+	if !ok {
+		return
+	}
+
+	resp, err := s.knowledgeBaseResponse(c.Request.Context(), kb)
+	if err != nil {
+		writeFailure(c, err, "failed to get knowledge base")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// handleUpdateKnowledgeBase changes the name, description or chunking
+// settings. The embedding settings are fixed because the collection's
+// vectors were made with them.
+func (s *Server) handleUpdateKnowledgeBase(c *gin.Context) {
+	kb, ok := s.lookupKnowledgeBase(c)
+	if !ok {
+		return
+	}
+
+	var req knowledgeBaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, "invalid JSON body")
+		return
+	}
+
+	updated := *kb
+	req.apply(&updated)
+	if updated.EmbeddingModel != kb.EmbeddingModel || updated.EmbeddingDimensions != kb.EmbeddingDimensions {
+		badRequest(c, "embedding settings cannot be changed; create a new knowledge base instead")
+		return
+	}
+	if err := knowledge.Validate(&updated); err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	if err := s.storage.UpdateKnowledgeBase(c.Request.Context(), &updated); err != nil {
+		writeFailure(c, err, "failed to update knowledge base")
+		return
+	}
+
+	resp, err := s.knowledgeBaseResponse(c.Request.Context(), &updated)
+	if err != nil {
+		writeFailure(c, err, "failed to update knowledge base")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// handleDeleteKnowledgeBase deletes an empty knowledge base and its vector
+// collection. The default knowledge base cannot be deleted.
+func (s *Server) handleDeleteKnowledgeBase(c *gin.Context) {
+	kb, ok := s.lookupKnowledgeBase(c)
+	if !ok {
+		return
+	}
+
+	if err := s.storage.DeleteKnowledgeBase(c.Request.Context(), kb.ID); err != nil {
+		if errors.Is(err, storage.ErrKnowledgeBaseNotEmpty) {
+			writeError(c, http.StatusConflict, CodeConflict, "knowledge base still has documents; delete them first")
+			return
+		}
+		writeFailure(c, err, "failed to delete knowledge base")
+		return
+	}
+
+	// The record is gone either way; a collection left behind is empty.
+	if err := s.knowledgeBases.Drop(c.Request.Context(), kb); err != nil {
+		slog.Error("Failed to drop knowledge base collection", "knowledge_base_id", kb.ID, "collection", kb.CollectionName, "error", err)
+	}
+
+	slog.Info("Knowledge base deleted", "knowledge_base_id", kb.ID, "name", kb.Name)
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) knowledgeBaseResponse(ctx context.Context, kb *models.KnowledgeBase) (knowledgeBaseResponse, error) {
+	count, err := s.storage.CountDocuments(ctx, kb.ID)
+	if err != nil {
+		return knowledgeBaseResponse{}, err
+	}
+	return knowledgeBaseResponse{KnowledgeBase: kb, DocumentCount: count}, nil
+}
+
+// lookupKnowledgeBase resolves the :id path parameter, writing the error
+// response itself when the knowledge base cannot be returned.
+func (s *Server) lookupKnowledgeBase(c *gin.Context) (*models.KnowledgeBase, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id < 1 {
+		badRequest(c, "invalid knowledge base id")
+		return nil, false
+	}
+
+	kb, err := s.storage.GetKnowledgeBase(c.Request.Context(), id)
+	if err != nil {
+		writeFailure(c, err, "failed to get knowledge base")
+		return nil, false
+	}
+
+	return kb, true
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestKnowledgeBaseEndpoints(t *testing.T) {
+	s := newTestServer(t, &fakeLLM{}, 1<<20)
+
+	rec := serve(s, jsonRequest(t, http.MethodPost, "/knowledge-bases", map[string]interface{}{"name": "clinic", "description": "Clinic policies"}))
+	var created knowledgeBaseResponse
+	decodeBody(t, rec, &created)
+	if rec.Code != http.StatusCreated || created.ID == 0 || created.Name != "clinic" || created.EmbeddingModel != "fake-embedding" {
+		t.Fatalf("expected the knowledge base to be created with the configured settings, got %d %s", rec.Code, rec.Body)
+	}
+	path := fmt.Sprintf("/knowledge-bases/%d", created.ID)
+
+	rec = serve(s, jsonRequest(t, http.MethodGet, "/knowledge-bases", nil))
+	var list listKnowledgeBasesResponse
+	decodeBody(t, rec, &list)
+	if rec.Code != http.StatusOK || len(list.KnowledgeBases) != 2 {
+		t.Errorf("expected the default and the new knowledge base, got %d %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(s, jsonRequest(t, http.MethodPatch, path, map[string]interface{}{"description": "Updated", "chunk_size": 800}))
+	var updated knowledgeBaseResponse
+	decodeBody(t, rec, &updated)
+	if rec.Code != http.StatusOK || updated.Description != "Updated" || updated.ChunkSize != 800 || updated.Name != "clinic" {
+		t.Errorf("expected the description and chunk size to change, got %d %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(s, uploadRequest(t, "policy.pdf", "%PDF-1.4 policy", map[string]string{"knowledge_base_id": strconv.Itoa(created.ID)}))
+	var uploaded uploadResponse
+	decodeBody(t, rec, &uploaded)
+	if rec.Code != http.StatusAccepted || uploaded.KnowledgeBaseID != created.ID {
+		t.Fatalf("expected the upload to go to the new knowledge base, got %d %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(s, jsonRequest(t, http.MethodGet, path, nil))
+	var got knowledgeBaseResponse
+	decodeBody(t, rec, &got)
+	if rec.Code != http.StatusOK || got.DocumentCount != 1 {
+		t.Errorf("expected one document in the knowledge base, got %d %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(s, jsonRequest(t, http.MethodDelete, path, nil))
+	var resp errorResponse
+	decodeBody(t, rec, &resp)
+	if rec.Code != http.StatusConflict || resp.Code != CodeConflict {
+		t.Errorf("expected 409 while the knowledge base has documents, got %d %+v", rec.Code, resp)
+	}
+
+	if rec := serve(s, jsonRequest(t, http.MethodDelete, fmt.Sprintf("/documents/%d", uploaded.ID), nil)); rec.Code != http.StatusNoContent {
+		t.Fatalf("document delete failed with %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serve(s, jsonRequest(t, http.MethodDelete, path, nil)); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 once empty, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serve(s, jsonRequest(t, http.MethodGet, path, nil)); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after the delete, got %d", rec.Code)
+	}
+}
+
+func TestKnowledgeBaseErrors(t *testing.T) {
+	s := newTestServer(t, &fakeLLM{}, 1<<20)
+
+	rec := serve(s, jsonRequest(t, http.MethodPost, "/knowledge-bases", map[string]interface{}{"name": "clinic"}))
+	var created knowledgeBaseResponse
+	decodeBody(t, rec, &created)
+	path := fmt.Sprintf("/knowledge-bases/%d", created.ID)
+	defaultKB, err := s.storage.DefaultKnowledgeBase(context.Background())
+	if err != nil {
+		t.Fatalf("DefaultKnowledgeBase failed: %v", err)
+	}
+
+	tests := map[string]struct {
+		method, path string
+		body         interface{}
+		status       int
+		code         string
+	}{
+		"duplicate name":     {http.MethodPost, "/knowledge-bases", map[string]interface{}{"name": "clinic"}, http.StatusConflict, CodeDuplicate},
+		"overlap too large":  {http.MethodPost, "/knowledge-bases", map[string]interface{}{"name": "other", "chunk_size": 100, "chunk_overlap": 200}, http.StatusBadRequest, CodeInvalidRequest},
+		"embedding change":   {http.MethodPatch, path, map[string]interface{}{"embedding_model": "other-model"}, http.StatusBadRequest, CodeInvalidRequest},
+		"unknown":            {http.MethodGet, "/knowledge-bases/999", nil, http.StatusNotFound, CodeNotFound},
+		"invalid id":         {http.MethodGet, "/knowledge-bases/abc", nil, http.StatusBadRequest, CodeInvalidRequest},
+		"delete the default": {http.MethodDelete, fmt.Sprintf("/knowledge-bases/%d", defaultKB.ID), nil, http.StatusConflict, CodeConflict},
+	}
+	for name, tt := range tests {
+		rec := serve(s, jsonRequest(t, tt.method, tt.path, tt.body))
+		var resp errorResponse
+		decodeBody(t, rec, &resp)
+		if rec.Code != tt.status || resp.Code != tt.code {
+			t.Errorf("%s: expected %d %s, got %d %+v", name, tt.status, tt.code, rec.Code, resp)
+		}
+	}
+
+	rec = serve(s, uploadRequest(t, "policy.pdf", "%PDF-1.4 policy", map[string]string{"knowledge_base_id": "999"}))
+	var resp errorResponse
+	decodeBody(t, rec, &resp)
+	if rec.Code != http.StatusNotFound || resp.Code != CodeNotFound {
+		t.Errorf("expected 404 for an upload to an unknown knowledge base, got %d %+v", rec.Code, resp)
+	}
+}
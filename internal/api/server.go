@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"rag-therapist/internal/health"
+	"rag-therapist/internal/ingest"
+	"rag-therapist/internal/knowledge"
+	"rag-therapist/internal/rag"
+	"rag-therapist/internal/storage"
+	"rag-therapist/pkg/models"
+)
+
+// Uploads larger than this are buffered to temporary files by the
+// multipart reader instead of being held in memory.
+const maxMultipartMemory = 32 << 20
+
+// Dependencies are the services the HTTP handlers call into. Pipeline may
+// be nil, in which case /chat answers 503; without Agent, agent mode
+// answers 503. Workers may be nil, in which case uploads stay pending
+// until a worker pool picks them up. Without Health, /readyz only reports
+// that the process is up. CheckTimeout bounds the collection stats
+// gathered by /status; it defaults to health.DefaultTimeout. MaxUploadSize
+// caps the request body of /upload in bytes; zero or less means no cap.
+type Dependencies struct {
+	Storage        *storage.StorageService
+	KnowledgeBases *knowledge.Registry
+	Pipeline       *rag.Pipeline
+	Agent          *rag.Agent
+	Workers        *ingest.WorkerPool
+	Health         *health.Checker
+	CheckTimeout   time.Duration
+	MaxUploadSize  int64
+}
+
+type Server struct {
+	storage        *storage.StorageService
+	knowledgeBases *knowledge.Registry
+	pipeline       *rag.Pipeline
+	agent          *rag.Agent
+	workers        *ingest.WorkerPool
+	health         *health.Checker
+	checkTimeout   time.Duration
+	maxUploadSize  int64
+	startedAt      time.Time
+	router         *gin.Engine
+	httpServer     *http.Server
+}
+
+func NewServer(port int, deps Dependencies) *Server {
+	gin.SetMode(gin.ReleaseMode)
+
+	router := gin.New()
+	router.MaxMultipartMemory = maxMultipartMemory
+	router.Use(gin.Recovery(), requestLogger())
+
+	s := &Server{
+		storage:        deps.Storage,
+		knowledgeBases: deps.KnowledgeBases,
+		pipeline:       deps.Pipeline,
+		agent:          deps.Agent,
+		workers:        deps.Workers,
+		health:         deps.Health,
+		checkTimeout:   deps.CheckTimeout,
+		maxUploadSize:  deps.MaxUploadSize,
+		startedAt:      time.Now(),
+		router:         router,
+	}
+	if s.checkTimeout <= 0 {
+		s.checkTimeout = health.DefaultTimeout
+	}
+	s.registerRoutes()
+
+	s.httpServer = &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s
+}
+
+func (s *Server) registerRoutes() {
+	s.router.GET("/healthz", s.handleHealthz)
+	s.router.GET("/readyz", s.handleReadyz)
+	s.router.GET("/status", s.handleStatus)
+
+	s.router.POST("/upload", s.handleUpload)
+	s.router.POST("/chat", s.handleChat)
+	s.router.POST("/chat/stream", s.handleChatStream)
+
+	s.router.GET("/documents", s.handleListDocuments)
+	s.router.GET("/documents/:id", s.handleGetDocument)
+	s.router.DELETE("/documents/:id", s.handleDeleteDocument)
+	s.router.POST("/documents/:id/reprocess", s.handleReprocessDocument)
+
+	s.router.GET("/knowledge-bases", s.handleListKnowledgeBases)
+	s.router.POST("/knowledge-bases", s.handleCreateKnowledgeBase)
+	s.router.GET("/knowledge-bases/:id", s.handleGetKnowledgeBase)
+	s.router.PATCH("/knowledge-bases/:id", s.handleUpdateKnowledgeBase)
+	s.router.DELETE("/knowledge-bases/:id", s.handleDeleteKnowledgeBase)
+
+	s.router.GET("/conversations", s.handleListConversations)
+	s.router.GET("/conversations/:id", s.handleGetConversation)
+	s.router.PATCH("/conversations/:id", s.handleRenameConversation)
+	s.router.DELETE("/conversations/:id", s.handleDeleteConversation)
+}
+
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
+
+// Start blocks serving requests until Shutdown is called.
+func (s *Server) Start() error {
+	slog.Info("HTTP server listening", "addr", s.httpServer.Addr)
+
+	err := s.httpServer.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests
+// to finish or for ctx to expire.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
+
+// notifyWorkers wakes the ingestion workers so a freshly queued document is
+// claimed right away instead of on the next poll.
+func (s *Server) notifyWorkers(doc *models.Document) {
+	if s.workers == nil || doc.Status != models.DocumentStatusPending {
+		return
+	}
+	s.workers.Notify()
+}
+
+func requestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		slog.Info("HTTP request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	}
+}
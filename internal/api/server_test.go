@@ -0,0 +1,175 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"rag-therapist/internal/config"
+	"rag-therapist/internal/embeddings"
+	"rag-therapist/internal/knowledge"
+	"rag-therapist/internal/llm"
+	"rag-therapist/internal/rag"
+	"rag-therapist/internal/storage"
+	"rag-therapist/pkg/models"
+)
+
+// fakeEmbedder embeds every text as the same vector.
+type fakeEmbedder struct{}
+
+func (fakeEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i := range texts {
+		vectors[i] = []float32{1, 0}
+	}
+	return vectors, nil
+}
+
+func (fakeEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	return []float32{1, 0}, nil
+}
+
+func (fakeEmbedder) Dimensions() int   { return 2 }
+func (fakeEmbedder) ModelName() string { return "fake-embedding" }
+
+// fakeLLM answers every question with reply. ChatStream sends it one word
+// per delta and then fails with streamErr, if set.
+type fakeLLM struct {
+	reply     string
+	streamErr error
+	// deltas counts the chunks handed to onDelta.
+	deltas int
+}
+
+func (f *fakeLLM) Chat(ctx context.Context, systemPrompt string, messages []llm.Message, opts llm.Options) (*llm.Response, error) {
+	return &llm.Response{Content: f.reply, Usage: llm.Usage{InputTokens: 10, OutputTokens: 1}}, nil
+}
+
+func (f *fakeLLM) ChatStream(ctx context.Context, systemPrompt string, messages []llm.Message, opts llm.Options, onDelta llm.DeltaFunc) (*llm.Response, error) {
+	for i, word := range strings.SplitAfter(f.reply, " ") {
+		if i > 0 && f.streamErr != nil {
+			return nil, f.streamErr
+		}
+		f.deltas++
+		if err := onDelta(word); err != nil {
+			return nil, err
+		}
+	}
+	return f.Chat(ctx, systemPrompt, messages, opts)
+}
+
+// errEncrypted is what checkTestPDF reports for uploads containing
+// "/Encrypt".
+var errEncrypted = errors.New("PDF is encrypted")
+
+func checkTestPDF(path string) error {
+	content, err := os.ReadFile(path)
+	if err == nil && bytes.Contains(content, []byte("/Encrypt")) {
+		return errEncrypted
+	}
+	return err
+}
+
+// newTestServer returns a server over a temporary SQLite database and
+// embedded vector store, answering chats with client. Uploads are capped
+// at maxUploadSize bytes.
+func newTestServer(t *testing.T, client llm.Client, maxUploadSize int64) *Server {
+	t.Helper()
+	ctx := context.Background()
+
+	cfg := &config.Config{
+		EmbeddingModel: "fake-embedding",
+		ChunkStrategy:  "recursive",
+		ChunkSize:      500,
+		ChunkOverlap:   50,
+		VectorStore:    storage.VectorStoreEmbedded,
+		VectorDistance: string(storage.DistanceCosine),
+		DataDir:        t.TempDir(),
+	}
+
+	storageService, err := storage.NewStorageService(cfg.DataDir,
+		storage.WithMaxDocumentSize(maxUploadSize),
+		storage.WithDocumentCheck(checkTestPDF))
+	if err != nil {
+		t.Fatalf("NewStorageService failed: %v", err)
+	}
+	t.Cleanup(func() { storageService.Close() })
+
+	bases := knowledge.NewRegistry(cfg, storageService, knowledge.WithEmbedderFactory(func(kb *models.KnowledgeBase) (embeddings.Embedder, error) {
+		return fakeEmbedder{}, nil
+	}))
+	t.Cleanup(func() { bases.Close() })
+	if _, err := bases.EnsureDefault(ctx); err != nil {
+		t.Fatalf("EnsureDefault failed: %v", err)
+	}
+
+	pipeline := rag.NewPipeline(bases, client, rag.WithDocumentStore(storageService))
+	return NewServer(0, Dependencies{
+		Storage:        storageService,
+		KnowledgeBases: bases,
+		Pipeline:       pipeline,
+		Agent:          rag.NewAgent(pipeline, storageService),
+		MaxUploadSize:  maxUploadSize,
+	})
+}
+
+// serve runs req through the server's router.
+func serve(s *Server, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func jsonRequest(t *testing.T, method, path string, body interface{}) *http.Request {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("failed to encode request: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// uploadRequest builds a POST /upload with content as the file and fields
+// as further form fields.
+func uploadRequest(t *testing.T, fileName, content string, fields map[string]string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	part, err := form.CreateFormFile("file", fileName)
+	if err != nil {
+		t.Fatalf("CreateFormFile failed: %v", err)
+	}
+	part.Write([]byte(content))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("failed to decode response %q: %v", rec.Body.String(), err)
+	}
+}
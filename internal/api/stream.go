@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+
+	"rag-therapist/internal/llm"
+	"rag-therapist/internal/storage"
+	"rag-therapist/pkg/models"
+)
+
+type streamDelta struct {
+	Text string `json:"text"`
+}
+
+// streamDone repeats the sources, now flagged as cited or not, along with
+// the citations parsed from the complete answer.
+type streamDone struct {
+	ConversationID     int                    `json:"conversation_id"`
+	StandaloneQuestion string                 `json:"standalone_question,omitempty"`
+	Sources            []models.MessageSource `json:"sources"`
+	Citations          []models.Citation      `json:"citations"`
+	Usage              llm.Usage              `json:"usage"`
+}
+
+// handleChatStream answers like /chat but as Server-Sent Events: one
+// "sources" event, a "delta" event per generated chunk and a final "done"
+// event with the conversation ID, citations and usage totals. The exchange
+// is only saved to the conversation once the answer is complete. Failures
+// after the stream has started are reported as an "error" event with the
+// same body as error responses. The request context is passed to the LLM,
+// so a client disconnect cancels the upstream request, and generation also
+// stops as soon as an event cannot be written.
+func (s *Server) handleChatStream(c *gin.Context) {
+	req, ok := s.bindChatRequest(c)
+	if !ok {
+		return
+	}
+	if req.Agent {
+		badRequest(c, "agent mode is not available for streaming; use /chat")
+		return
+	}
+
+	ctx := c.Request.Context()
+	streaming := false
+
+	// Once a write fails the client is gone; later events are dropped.
+	var writeErr error
+	write := func(event string, data interface{}) error {
+		if writeErr == nil {
+			writeErr = writeEvent(c, event, data)
+		}
+		return writeErr
+	}
+
+	onSources := func(results []storage.SearchResult) error {
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		streaming = true
+
+		return write("sources", toChatSources(results, nil))
+	}
+
+	onDelta := func(text string) error {
+		return write("delta", streamDelta{Text: text})
+	}
+
+	answer, err := s.pipeline.AnswerStream(ctx, req.Message, req.queryOptions(), onSources, onDelta)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) || writeErr != nil {
+			slog.Info("Chat stream cancelled by client", "error", writeErr)
+			return
+		}
+
+		if !streaming {
+			writeFailure(c, err, "failed to generate response")
+			return
+		}
+		slog.Error("Failed to stream chat response", "error", err)
+		resp, _ := failureResponse(err, "failed to generate response")
+		write("error", resp)
+		return
+	}
+
+	conversationID, err := s.saveExchange(ctx, req, answer)
+	if err != nil {
+		slog.Error("Failed to save chat messages", "conversation_id", req.ConversationID, "error", err)
+		write("error", errorResponse{Code: CodeInternal, Error: "failed to save conversation"})
+		return
+	}
+
+	done := streamDone{
+		ConversationID: conversationID,
+		Sources:        toChatSources(answer.Sources, answer.Cited),
+		Citations:      toChatCitations(answer.Citations),
+		Usage:          answer.Usage,
+	}
+	if answer.Question != req.Message {
+		done.StandaloneQuestion = answer.Question
+	}
+	if err := write("done", done); err != nil {
+		slog.Info("Chat stream closed before the done event", "conversation_id", conversationID, "error", err)
+	}
+}
+
+// writeEvent sends one event to the client right away. It fails when the
+// event cannot be written or flushed, or the request was cancelled.
+func writeEvent(c *gin.Context, event string, data interface{}) error {
+	if err := sse.Encode(c.Writer, sse.Event{Event: event, Data: data}); err != nil {
+		return err
+	}
+	if err := flush(c.Writer); err != nil {
+		return err
+	}
+	return c.Request.Context().Err()
+}
+
+// flush sends buffered output to the client. gin's Flush hides failures,
+// so the underlying writer is flushed directly where possible.
+func flush(w gin.ResponseWriter) error {
+	w.WriteHeaderNow()
+	if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); ok {
+		return http.NewResponseController(u.Unwrap()).Flush()
+	}
+	w.Flush()
+	return nil
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"rag-therapist/internal/storage"
+)
+
+// sseEvent is one Server-Sent Event read back from a response.
+type sseEvent struct {
+	name string
+	data string
+}
+
+func readEvents(t *testing.T, body string) []sseEvent {
+	t.Helper()
+
+	var events []sseEvent
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		var event sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				event.name = strings.TrimPrefix(line, "event:")
+			case strings.HasPrefix(line, "data:"):
+				event.data = strings.TrimPrefix(line, "data:")
+			}
+		}
+		if event.name == "" {
+			t.Fatalf("unexpected event block %q", block)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func eventNames(events []sseEvent) []string {
+	names := make([]string, len(events))
+	for i, event := range events {
+		names[i] = event.name
+	}
+	return names
+}
+
+func TestChatStreamEvents(t *testing.T) {
+	s := newTestServer(t, &fakeLLM{reply: "Keep a regular bedtime."}, 1<<20)
+
+	rec := serve(s, jsonRequest(t, http.MethodPost, "/chat/stream", chatRequest{Message: "How can I sleep better?"}))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+
+	events := readEvents(t, rec.Body.String())
+	want := []string{"sources", "delta", "delta", "delta", "delta", "done"}
+	if got := eventNames(events); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected events %v, got %v", want, got)
+	}
+
+	var text strings.Builder
+	for _, event := range events[1:5] {
+		var delta streamDelta
+		if err := json.Unmarshal([]byte(event.data), &delta); err != nil {
+			t.Fatalf("failed to decode delta %q: %v", event.data, err)
+		}
+		text.WriteString(delta.Text)
+	}
+	if text.String() != "Keep a regular bedtime." {
+		t.Errorf("expected the deltas to add up to the answer, got %q", text.String())
+	}
+
+	var done streamDone
+	if err := json.Unmarshal([]byte(events[5].data), &done); err != nil {
+		t.Fatalf("failed to decode done %q: %v", events[5].data, err)
+	}
+	if done.ConversationID == 0 || done.Usage.InputTokens != 10 || done.Sources == nil || done.Citations == nil {
+		t.Errorf("unexpected done event %+v", done)
+	}
+}
+
+func TestChatStreamReportsFailuresAsEvents(t *testing.T) {
+	client := &fakeLLM{reply: "Keep a regular bedtime.", streamErr: storage.ErrVectorStoreUnavailable}
+	s := newTestServer(t, client, 1<<20)
+
+	rec := serve(s, jsonRequest(t, http.MethodPost, "/chat/stream", chatRequest{Message: "How can I sleep better?"}))
+	events := readEvents(t, rec.Body.String())
+	want := []string{"sources", "delta", "error"}
+	if got := eventNames(events); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected events %v, got %v", want, got)
+	}
+
+	var resp errorResponse
+	if err := json.Unmarshal([]byte(events[2].data), &resp); err != nil {
+		t.Fatalf("failed to decode error %q: %v", events[2].data, err)
+	}
+	if resp.Code != CodeUnavailable || resp.Error != "failed to generate response" {
+		t.Errorf("expected the error envelope in the event, got %+v", resp)
+	}
+}
+
+func TestChatStreamRejectsAgentMode(t *testing.T) {
+	s := newTestServer(t, &fakeLLM{}, 1<<20)
+
+	rec := serve(s, jsonRequest(t, http.MethodPost, "/chat/stream", chatRequest{Message: "hi", Agent: true}))
+	var resp errorResponse
+	decodeBody(t, rec, &resp)
+	if rec.Code != http.StatusBadRequest || resp.Code != CodeInvalidRequest {
+		t.Errorf("expected 400 for agent mode, got %d %+v", rec.Code, resp)
+	}
+}
+
+// disconnectedWriter records a response but fails every flush after the
+// first, like a connection the client closed.
+type disconnectedWriter struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (w *disconnectedWriter) FlushError() error {
+	w.flushes++
+	if w.flushes > 1 {
+		return errors.New("connection reset by peer")
+	}
+	w.ResponseRecorder.Flush()
+	return nil
+}
+
+func TestChatStreamStopsWhenClientIsGone(t *testing.T) {
+	client := &fakeLLM{reply: "one two three four five six seven eight"}
+	s := newTestServer(t, client, 1<<20)
+
+	w := &disconnectedWriter{ResponseRecorder: httptest.NewRecorder()}
+	s.Handler().ServeHTTP(w, jsonRequest(t, http.MethodPost, "/chat/stream", chatRequest{Message: "Hello?"}))
+
+	if client.deltas != 1 {
+		t.Errorf("expected generation to stop at the first failed write, got %d deltas", client.deltas)
+	}
+	if got := eventNames(readEvents(t, w.Body.String())); !reflect.DeepEqual(got, []string{"sources", "delta"}) {
+		t.Errorf("expected no events after the failed write, got %v", got)
+	}
+
+	rec := serve(s, jsonRequest(t, http.MethodGet, "/conversations", nil))
+	var page listConversationsResponse
+	decodeBody(t, rec, &page)
+	if page.Total != 0 {
+		t.Errorf("expected the unfinished exchange not to be saved, got %d conversations", page.Total)
+	}
+}
@@ -0,0 +1,245 @@
+package chunking
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	StrategyFixed     = "fixed"
+	StrategySentence  = "sentence"
+	StrategyRecursive = "recursive"
+	StrategyMarkdown  = "markdown"
+)
+
+// Metadata keys written for every chunk so citations can point back to
+// the source text.
+const (
+	MetaCharStart = "char_start"
+	MetaCharEnd   = "char_end"
+	MetaPageStart = "page_start"
+	MetaPageEnd   = "page_end"
+	MetaSection   = "section"
+)
+
+// pageSeparator joins pages into one document text; chunk offsets refer
+// to that joined text.
+const pageSeparator = "\n\n"
+
+// Span is a byte range [Start, End) of the text passed to Split. Section
+// is set by strategies that know which heading the span belongs to.
+type Span struct {
+	Start   int
+	End     int
+	Section string
+}
+
+// Chunker splits text into spans of at most the configured size in
+// characters. Consecutive spans may overlap.
+type Chunker interface {
+	Split(text string) []Span
+}
+
+// New returns the chunker for strategy. size and overlap are measured in
+// characters; overlap must be smaller than size.
+func New(strategy string, size, overlap int) (Chunker, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("chunk size must be positive, got %d", size)
+	}
+	if overlap < 0 || overlap >= size {
+		return nil, fmt.Errorf("chunk overlap must be between 0 and chunk size (%d), got %d", size, overlap)
+	}
+
+	switch strings.ToLower(strategy) {
+	case StrategyFixed:
+		return &FixedChunker{size: size, overlap: overlap}, nil
+	case StrategySentence:
+		return &SentenceChunker{size: size, overlap: overlap}, nil
+	case StrategyRecursive:
+		return &RecursiveChunker{size: size, overlap: overlap, separators: defaultSeparators}, nil
+	case StrategyMarkdown:
+		return &MarkdownChunker{size: size, overlap: overlap}, nil
+	default:
+		return nil, fmt.Errorf("unknown chunk strategy %q (expected %s, %s, %s or %s)", strategy, StrategyFixed, StrategySentence, StrategyRecursive, StrategyMarkdown)
+	}
+}
+
+// Page is the text of one source page. Number is 1-based.
+type Page struct {
+	Number int
+	Text   string
+}
+
+// Chunk is a piece of a document ready to be embedded. CharStart and
+// CharEnd are character (rune) offsets into the document text, which is
+// the pages joined by blank lines.
+type Chunk struct {
+	Text      string
+	CharStart int
+	CharEnd   int
+	PageStart int
+	PageEnd   int
+	Section   string
+}
+
+func (c Chunk) Metadata() map[string]string {
+	metadata := map[string]string{
+		MetaCharStart: strconv.Itoa(c.CharStart),
+		MetaCharEnd:   strconv.Itoa(c.CharEnd),
+		MetaPageStart: strconv.Itoa(c.PageStart),
+		MetaPageEnd:   strconv.Itoa(c.PageEnd),
+	}
+	if c.Section != "" {
+		metadata[MetaSection] = c.Section
+	}
+	return metadata
+}
+
+// ChunkPages splits a document with chunker and records, for every chunk,
+// its character offsets and the pages it spans. Leading and trailing
+// whitespace is trimmed from each chunk.
+func ChunkPages(chunker Chunker, pages []Page) []Chunk {
+	var b strings.Builder
+	pageStarts := make([]int, len(pages))
+	for i, page := range pages {
+		if i > 0 {
+			b.WriteString(pageSeparator)
+		}
+		pageStarts[i] = b.Len()
+		b.WriteString(page.Text)
+	}
+	text := b.String()
+
+	var spans []Span
+	for _, span := range chunker.Split(text) {
+		span.Start, span.End = trimSpan(text, span.Start, span.End)
+		if span.Start < span.End {
+			spans = append(spans, span)
+		}
+	}
+
+	offsets := make([]int, 0, 2*len(spans))
+	for _, span := range spans {
+		offsets = append(offsets, span.Start, span.End)
+	}
+	charOffsets := runeOffsets(text, offsets)
+
+	pageAt := func(offset int) int {
+		i := sort.Search(len(pageStarts), func(i int) bool { return pageStarts[i] > offset }) - 1
+		if i < 0 {
+			i = 0
+		}
+		return pages[i].Number
+	}
+
+	chunks := make([]Chunk, 0, len(spans))
+	for _, span := range spans {
+		chunks = append(chunks, Chunk{
+			Text:      text[span.Start:span.End],
+			CharStart: charOffsets[span.Start],
+			CharEnd:   charOffsets[span.End],
+			PageStart: pageAt(span.Start),
+			PageEnd:   pageAt(span.End - 1),
+			Section:   span.Section,
+		})
+	}
+
+	return chunks
+}
+
+func trimSpan(text string, start, end int) (int, int) {
+	for start < end {
+		r, size := utf8.DecodeRuneInString(text[start:end])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		start += size
+	}
+	for end > start {
+		r, size := utf8.DecodeLastRuneInString(text[start:end])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		end -= size
+	}
+	return start, end
+}
+
+// runeOffsets maps byte offsets in text to character offsets in a single
+// pass over the text.
+func runeOffsets(text string, byteOffsets []int) map[int]int {
+	sorted := append([]int(nil), byteOffsets...)
+	sort.Ints(sorted)
+
+	result := make(map[int]int, len(sorted))
+	pos, count := 0, 0
+	for _, offset := range sorted {
+		if _, ok := result[offset]; ok {
+			continue
+		}
+		count += utf8.RuneCountInString(text[pos:offset])
+		pos = offset
+		result[offset] = count
+	}
+	return result
+}
+
+func runeLen(text string, span Span) int {
+	return utf8.RuneCountInString(text[span.Start:span.End])
+}
+
+// advance moves n characters forward from start without passing limit.
+func advance(text string, start, limit, n int) int {
+	pos := start
+	for i := 0; i < n && pos < limit; i++ {
+		_, size := utf8.DecodeRuneInString(text[pos:limit])
+		pos += size
+	}
+	return pos
+}
+
+// retreat moves n characters back from end without passing floor.
+func retreat(text string, floor, end, n int) int {
+	pos := end
+	for i := 0; i < n && pos > floor; i++ {
+		_, size := utf8.DecodeLastRuneInString(text[floor:pos])
+		pos -= size
+	}
+	return pos
+}
+
+// mergeSpans packs consecutive pieces into chunks of at most size
+// characters. Trailing pieces totalling at most overlap characters are
+// repeated at the start of the next chunk. Pieces must be contiguous and
+// no longer than size.
+func mergeSpans(text string, pieces []Span, size, overlap int) []Span {
+	var chunks []Span
+	var window []Span
+	windowLen := 0
+
+	emit := func() {
+		chunks = append(chunks, Span{Start: window[0].Start, End: window[len(window)-1].End})
+	}
+
+	for _, piece := range pieces {
+		pieceLen := runeLen(text, piece)
+		if len(window) > 0 && windowLen+pieceLen > size {
+			emit()
+			for len(window) > 0 && (windowLen > overlap || windowLen+pieceLen > size) {
+				windowLen -= runeLen(text, window[0])
+				window = window[1:]
+			}
+		}
+		window = append(window, piece)
+		windowLen += pieceLen
+	}
+	if len(window) > 0 {
+		emit()
+	}
+
+	return chunks
+}
@@ -0,0 +1,166 @@
+package chunking
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+const sampleText = "Anxiety disorders are common. They affect many adults every year! " +
+	"Cognitive behavioural therapy is an effective treatment. Medication can also help.\n\n" +
+	"Sleep hygiene matters too. Regular routines reduce symptoms? Exercise helps as well."
+
+// checkChunks verifies the invariants every strategy must keep: chunks fit
+// the size limit, are non-empty and their offsets point at their text.
+func checkChunks(t *testing.T, pages []Page, chunks []Chunk, size int) {
+	t.Helper()
+
+	texts := make([]string, len(pages))
+	for i, page := range pages {
+		texts[i] = page.Text
+	}
+	document := []rune(strings.Join(texts, pageSeparator))
+
+	if len(chunks) == 0 {
+		t.Fatal("expected chunks, got none")
+	}
+	for i, chunk := range chunks {
+		if chunk.Text == "" {
+			t.Errorf("chunk %d is empty", i)
+		}
+		if n := utf8.RuneCountInString(chunk.Text); n > size {
+			t.Errorf("chunk %d has %d characters, limit is %d", i, n, size)
+		}
+		if got := string(document[chunk.CharStart:chunk.CharEnd]); got != chunk.Text {
+			t.Errorf("chunk %d offsets [%d,%d) point at %q, expected %q", i, chunk.CharStart, chunk.CharEnd, got, chunk.Text)
+		}
+		if chunk.PageStart > chunk.PageEnd {
+			t.Errorf("chunk %d has page range %d-%d", i, chunk.PageStart, chunk.PageEnd)
+		}
+	}
+}
+
+func TestStrategiesKeepInvariants(t *testing.T) {
+	pages := []Page{
+		{Number: 1, Text: sampleText},
+		{Number: 2, Text: "Ünïcödé text on the second page. " + sampleText},
+	}
+
+	for _, strategy := range []string{StrategyFixed, StrategySentence, StrategyRecursive, StrategyMarkdown} {
+		t.Run(strategy, func(t *testing.T) {
+			chunker, err := New(strategy, 80, 20)
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			checkChunks(t, pages, ChunkPages(chunker, pages), 80)
+		})
+	}
+}
+
+func TestFixedChunkerOverlap(t *testing.T) {
+	chunker, _ := New(StrategyFixed, 10, 4)
+
+	text := "abcdefghijklmnopqrstuvwxyz"
+	spans := chunker.Split(text)
+
+	expected := []string{"abcdefghij", "ghijklmnop", "mnopqrstuv", "stuvwxyz"}
+	if len(spans) != len(expected) {
+		t.Fatalf("expected %d spans, got %d", len(expected), len(spans))
+	}
+	for i, span := range spans {
+		if got := text[span.Start:span.End]; got != expected[i] {
+			t.Errorf("span %d: expected %q, got %q", i, expected[i], got)
+		}
+	}
+}
+
+func TestSentenceChunkerKeepsSentencesWhole(t *testing.T) {
+	chunker, _ := New(StrategySentence, 100, 40)
+	chunks := ChunkPages(chunker, []Page{{Number: 1, Text: sampleText}})
+
+	for i, chunk := range chunks {
+		last := chunk.Text[len(chunk.Text)-1]
+		if last != '.' && last != '!' && last != '?' {
+			t.Errorf("chunk %d does not end on a sentence boundary: %q", i, chunk.Text)
+		}
+	}
+
+	// The second chunk repeats the last sentence of the first as overlap.
+	if len(chunks) < 2 || !strings.HasPrefix(chunks[1].Text, "They affect many adults every year!") {
+		t.Errorf("expected sentence overlap, got %q", chunks)
+	}
+}
+
+func TestRecursiveChunkerPrefersParagraphs(t *testing.T) {
+	chunker, _ := New(StrategyRecursive, 200, 0)
+	chunks := ChunkPages(chunker, []Page{{Number: 1, Text: sampleText}})
+
+	if len(chunks) != 2 {
+		t.Fatalf("expected one chunk per paragraph, got %d: %q", len(chunks), chunks)
+	}
+	if !strings.HasPrefix(chunks[1].Text, "Sleep hygiene") {
+		t.Errorf("expected second chunk to start at the paragraph, got %q", chunks[1].Text)
+	}
+}
+
+func TestMarkdownChunkerSections(t *testing.T) {
+	text := "Intro line.\n\n# Treatment\nTherapy works.\n\n## Children\nLower doses.\n\n# Side effects\nNausea."
+
+	chunker, _ := New(StrategyMarkdown, 500, 0)
+	chunks := ChunkPages(chunker, []Page{{Number: 1, Text: text}})
+
+	expected := []struct {
+		section string
+		prefix  string
+	}{
+		{"", "Intro line."},
+		{"Treatment", "# Treatment"},
+		{"Treatment > Children", "## Children"},
+		{"Side effects", "# Side effects"},
+	}
+	if len(chunks) != len(expected) {
+		t.Fatalf("expected %d chunks, got %d: %q", len(expected), len(chunks), chunks)
+	}
+	for i, want := range expected {
+		if chunks[i].Section != want.section || !strings.HasPrefix(chunks[i].Text, want.prefix) {
+			t.Errorf("chunk %d: expected section %q starting %q, got %q %q", i, want.section, want.prefix, chunks[i].Section, chunks[i].Text)
+		}
+	}
+	if chunks[2].Metadata()[MetaSection] != "Treatment > Children" {
+		t.Errorf("expected section in metadata, got %v", chunks[2].Metadata())
+	}
+}
+
+func TestChunkPagesPageRanges(t *testing.T) {
+	pages := []Page{
+		{Number: 3, Text: "Page three ends here"},
+		{Number: 4, Text: "and page four continues"},
+	}
+
+	chunker, _ := New(StrategyFixed, 1000, 0)
+	chunks := ChunkPages(chunker, pages)
+
+	if len(chunks) != 1 {
+		t.Fatalf("expected a single chunk, got %d", len(chunks))
+	}
+
+	metadata := chunks[0].Metadata()
+	if metadata[MetaPageStart] != "3" || metadata[MetaPageEnd] != "4" {
+		t.Errorf("expected page range 3-4, got %v", metadata)
+	}
+	if metadata[MetaCharStart] != "0" || metadata[MetaCharEnd] != "45" {
+		t.Errorf("unexpected character offsets: %v", metadata)
+	}
+}
+
+func TestNewValidatesParameters(t *testing.T) {
+	if _, err := New(StrategyFixed, 0, 0); err == nil {
+		t.Error("expected error for zero size")
+	}
+	if _, err := New(StrategyFixed, 100, 100); err == nil {
+		t.Error("expected error for overlap >= size")
+	}
+	if _, err := New("semantic", 100, 10); err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+}
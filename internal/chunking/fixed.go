@@ -0,0 +1,43 @@
+package chunking
+
+import "strings"
+
+// FixedChunker cuts text into windows of a fixed number of characters,
+// each starting overlap characters before the previous one ended. Cuts are
+// moved back to the last whitespace when one is close enough, so words are
+// rarely split.
+type FixedChunker struct {
+	size    int
+	overlap int
+}
+
+func (c *FixedChunker) Split(text string) []Span {
+	return fixedSpans(text, 0, len(text), c.size, c.overlap)
+}
+
+func fixedSpans(text string, start, end, size, overlap int) []Span {
+	var spans []Span
+
+	for start < end {
+		stop := advance(text, start, end, size)
+		if stop < end {
+			// Only snap when it keeps at least half the window.
+			if ws := strings.LastIndexAny(text[start:stop], " \t\n"); ws >= 0 && start+ws+1 > start+(stop-start)/2 {
+				stop = start + ws + 1
+			}
+		}
+
+		spans = append(spans, Span{Start: start, End: stop})
+		if stop >= end {
+			break
+		}
+
+		next := retreat(text, start, stop, overlap)
+		if next <= start {
+			next = stop
+		}
+		start = next
+	}
+
+	return spans
+}
@@ -0,0 +1,62 @@
+package chunking
+
+import (
+	"regexp"
+	"strings"
+)
+
+var headingPattern = regexp.MustCompile(`(?m)^(#{1,6})[ \t]+(\S.*?)[ \t#]*$`)
+
+// MarkdownChunker never lets a chunk cross a heading. Each section is
+// chunked with the recursive strategy and its chunks are labelled with the
+// heading path, e.g. "Dosage > Children".
+type MarkdownChunker struct {
+	size    int
+	overlap int
+}
+
+func (c *MarkdownChunker) Split(text string) []Span {
+	type heading struct {
+		level int
+		title string
+	}
+
+	matches := headingPattern.FindAllStringSubmatchIndex(text, -1)
+
+	var spans []Span
+	var path []heading
+
+	sectionStart := 0
+	section := ""
+	flush := func(end int) {
+		pieces := recursivePieces(text, sectionStart, end, defaultSeparators, c.size)
+		for _, span := range mergeSpans(text, pieces, c.size, c.overlap) {
+			span.Section = section
+			spans = append(spans, span)
+		}
+	}
+
+	for _, m := range matches {
+		if m[0] > sectionStart {
+			flush(m[0])
+		}
+
+		level := m[3] - m[2]
+		for len(path) > 0 && path[len(path)-1].level >= level {
+			path = path[:len(path)-1]
+		}
+		path = append(path, heading{level: level, title: text[m[4]:m[5]]})
+
+		titles := make([]string, len(path))
+		for i, h := range path {
+			titles[i] = h.title
+		}
+		section = strings.Join(titles, " > ")
+		sectionStart = m[0]
+	}
+	if sectionStart < len(text) {
+		flush(len(text))
+	}
+
+	return spans
+}
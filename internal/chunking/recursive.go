@@ -0,0 +1,63 @@
+package chunking
+
+import "strings"
+
+// Separators tried in order: paragraphs, lines, sentences, words.
+var defaultSeparators = []string{"\n\n", "\n", ". ", " "}
+
+// RecursiveChunker splits on the coarsest separator that occurs in the
+// text and only falls back to finer separators for pieces that are still
+// too long, then packs the pieces into chunks. This keeps paragraphs and
+// sentences together whenever they fit.
+type RecursiveChunker struct {
+	size       int
+	overlap    int
+	separators []string
+}
+
+func (c *RecursiveChunker) Split(text string) []Span {
+	pieces := recursivePieces(text, 0, len(text), c.separators, c.size)
+	return mergeSpans(text, pieces, c.size, c.overlap)
+}
+
+func recursivePieces(text string, start, end int, separators []string, size int) []Span {
+	if runeLen(text, Span{Start: start, End: end}) <= size {
+		return []Span{{Start: start, End: end}}
+	}
+	if len(separators) == 0 {
+		return fixedSpans(text, start, end, size, 0)
+	}
+
+	parts := splitKeepingSeparator(text, start, end, separators[0])
+	if len(parts) == 1 {
+		return recursivePieces(text, start, end, separators[1:], size)
+	}
+
+	var pieces []Span
+	for _, part := range parts {
+		pieces = append(pieces, recursivePieces(text, part.Start, part.End, separators[1:], size)...)
+	}
+	return pieces
+}
+
+// splitKeepingSeparator splits text[start:end] after every occurrence of
+// sep, so the parts stay contiguous and cover the whole range.
+func splitKeepingSeparator(text string, start, end int, sep string) []Span {
+	var parts []Span
+	pos := start
+
+	for pos < end {
+		i := strings.Index(text[pos:end], sep)
+		if i < 0 {
+			break
+		}
+		cut := pos + i + len(sep)
+		parts = append(parts, Span{Start: pos, End: cut})
+		pos = cut
+	}
+	if pos < end {
+		parts = append(parts, Span{Start: pos, End: end})
+	}
+
+	return parts
+}
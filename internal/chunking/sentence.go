@@ -0,0 +1,86 @@
+package chunking
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// SentenceChunker packs whole sentences into chunks. Overlap is made of
+// whole sentences too. Sentences longer than a chunk are cut with the
+// fixed strategy.
+type SentenceChunker struct {
+	size    int
+	overlap int
+}
+
+func (c *SentenceChunker) Split(text string) []Span {
+	var pieces []Span
+	for _, sentence := range splitSentences(text) {
+		if runeLen(text, sentence) > c.size {
+			pieces = append(pieces, fixedSpans(text, sentence.Start, sentence.End, c.size, 0)...)
+			continue
+		}
+		pieces = append(pieces, sentence)
+	}
+
+	return mergeSpans(text, pieces, c.size, c.overlap)
+}
+
+// splitSentences returns contiguous spans covering text, each ending after
+// a sentence terminator (. ! ?), any closing quotes or brackets and the
+// whitespace that follows. Blank lines also end a sentence.
+func splitSentences(text string) []Span {
+	var spans []Span
+	start := 0
+	i := 0
+
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+
+		boundary := false
+		switch {
+		case r == '.' || r == '!' || r == '?':
+			for i < len(text) {
+				next, nextSize := utf8.DecodeRuneInString(text[i:])
+				if !isSentenceCloser(next) {
+					break
+				}
+				i += nextSize
+			}
+			boundary = i >= len(text) || startsWithSpace(text[i:])
+		case r == '\n':
+			boundary = i < len(text) && text[i] == '\n'
+		}
+
+		if !boundary {
+			continue
+		}
+
+		for i < len(text) && startsWithSpace(text[i:]) {
+			_, spaceSize := utf8.DecodeRuneInString(text[i:])
+			i += spaceSize
+		}
+		spans = append(spans, Span{Start: start, End: i})
+		start = i
+	}
+
+	if start < len(text) {
+		spans = append(spans, Span{Start: start, End: len(text)})
+	}
+
+	return spans
+}
+
+func isSentenceCloser(r rune) bool {
+	switch r {
+	case '.', '!', '?', '"', '\'', ')', ']', '”', '’':
+		return true
+	}
+	return false
+}
+
+func startsWithSpace(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsSpace(r)
+}
@@ -4,17 +4,43 @@ import (
 	"log/slog"
 	"os"
 	"strconv"
+	"time"
 )
 
 type Config struct {
-	LLMProvider    string
-	ClaudeAPIKey   string
-	GeminiAPIKey   string
-	OpenAIAPIKey   string
-	Port           int
-	ChromaURL      string
-	DBPath         string
-	UploadDir      string
+	LLMProvider         string
+	ClaudeAPIKey        string
+	ClaudeModel         string
+	GeminiAPIKey        string
+	GeminiModel         string
+	OpenAIAPIKey        string
+	EmbeddingModel      string
+	EmbeddingDimensions int
+	ChunkStrategy       string
+	ChunkSize           int
+	ChunkOverlap        int
+	MaxUploadSizeMB     int
+	IngestWorkers       int
+	IngestPollInterval  time.Duration
+	IngestMaxAttempts   int
+	IngestRetryDelay    time.Duration
+	HybridVectorWeight  float64
+	HybridKeywordWeight float64
+	MMRLambda           float64
+	AgentMaxSteps       int
+	AgentMaxTokens      int
+	ContextNeighbors    int
+	ContextMaxTokens    int
+	HealthCheckTimeout  time.Duration
+	StorageTimeout      time.Duration
+	VectorStoreTimeout  time.Duration
+	Port                int
+	VectorStore         string
+	VectorDistance      string
+	ChromaURL           string
+	DataDir             string
+	DBPath              string
+	UploadDir           string
 }
 
 func Load() *Config {
@@ -26,20 +52,67 @@ func Load() *Config {
 	}
 
 	config := &Config{
-		LLMProvider:    getEnv("LLM_PROVIDER", "claude"),
-		ClaudeAPIKey:   getEnv("CLAUDE_API_KEY", ""),
-		GeminiAPIKey:   getEnv("GEMINI_API_KEY", ""),
-		OpenAIAPIKey:   getEnv("OPENAI_API_KEY", ""),
-		Port:           port,
-		ChromaURL:      getEnv("CHROMA_URL", "http://localhost:8000"),
-		DBPath:         getEnv("DB_PATH", "./data/rag.db"),
-		UploadDir:      getEnv("UPLOAD_DIR", "./data/uploads"),
+		LLMProvider:         getEnv("LLM_PROVIDER", "claude"),
+		ClaudeAPIKey:        getEnv("CLAUDE_API_KEY", ""),
+		ClaudeModel:         getEnv("CLAUDE_MODEL", "claude-sonnet-4-20250514"),
+		GeminiAPIKey:        getEnv("GEMINI_API_KEY", ""),
+		GeminiModel:         getEnv("GEMINI_MODEL", "gemini-2.0-flash"),
+		OpenAIAPIKey:        getEnv("OPENAI_API_KEY", ""),
+		EmbeddingModel:      getEnv("EMBEDDING_MODEL", "text-embedding-3-small"),
+		EmbeddingDimensions: getEnvInt("EMBEDDING_DIMENSIONS", 0),
+		ChunkStrategy:       getEnv("CHUNK_STRATEGY", "recursive"),
+		ChunkSize:           getEnvInt("CHUNK_SIZE", 1000),
+		ChunkOverlap:        getEnvInt("CHUNK_OVERLAP", 200),
+		MaxUploadSizeMB:     getEnvInt("MAX_UPLOAD_SIZE_MB", 50),
+		IngestWorkers:       getEnvInt("INGEST_WORKERS", 2),
+		IngestPollInterval:  getEnvDuration("INGEST_POLL_INTERVAL", 5*time.Second),
+		IngestMaxAttempts:   getEnvInt("INGEST_MAX_ATTEMPTS", 3),
+		IngestRetryDelay:    getEnvDuration("INGEST_RETRY_DELAY", 30*time.Second),
+		HybridVectorWeight:  getEnvFloat("HYBRID_VECTOR_WEIGHT", 1),
+		HybridKeywordWeight: getEnvFloat("HYBRID_KEYWORD_WEIGHT", 1),
+		MMRLambda:           getEnvFloat("MMR_LAMBDA", 1),
+		AgentMaxSteps:       getEnvInt("AGENT_MAX_STEPS", 5),
+		AgentMaxTokens:      getEnvInt("AGENT_MAX_TOKENS", 50000),
+		ContextNeighbors:    getEnvInt("CONTEXT_NEIGHBORS", 0),
+		ContextMaxTokens:    getEnvInt("CONTEXT_MAX_TOKENS", 6000),
+		HealthCheckTimeout:  getEnvDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second),
+		StorageTimeout:      getEnvDurationAllowZero("STORAGE_TIMEOUT", 10*time.Second),
+		VectorStoreTimeout:  getEnvDurationAllowZero("VECTOR_STORE_TIMEOUT", 30*time.Second),
+		Port:                port,
+		VectorStore:         getEnv("VECTOR_STORE", "chroma"),
+		VectorDistance:      getEnv("VECTOR_DISTANCE", "cosine"),
+		ChromaURL:           getEnv("CHROMA_URL", "http://localhost:8000"),
+		DataDir:             getEnv("DATA_DIR", "./data"),
+		DBPath:              getEnv("DB_PATH", "./data/rag.db"),
+		UploadDir:           getEnv("UPLOAD_DIR", "./data/uploads"),
 	}
 
-	slog.Info("Configuration loaded", 
+	slog.Info("Configuration loaded",
 		"llm_provider", config.LLMProvider,
+		"embedding_model", config.EmbeddingModel,
+		"chunk_strategy", config.ChunkStrategy,
+		"chunk_size", config.ChunkSize,
+		"chunk_overlap", config.ChunkOverlap,
+		"max_upload_size_mb", config.MaxUploadSizeMB,
+		"ingest_workers", config.IngestWorkers,
+		"ingest_poll_interval", config.IngestPollInterval,
+		"ingest_max_attempts", config.IngestMaxAttempts,
+		"ingest_retry_delay", config.IngestRetryDelay,
+		"hybrid_vector_weight", config.HybridVectorWeight,
+		"hybrid_keyword_weight", config.HybridKeywordWeight,
+		"mmr_lambda", config.MMRLambda,
+		"agent_max_steps", config.AgentMaxSteps,
+		"agent_max_tokens", config.AgentMaxTokens,
+		"context_neighbors", config.ContextNeighbors,
+		"context_max_tokens", config.ContextMaxTokens,
+		"health_check_timeout", config.HealthCheckTimeout,
+		"storage_timeout", config.StorageTimeout,
+		"vector_store_timeout", config.VectorStoreTimeout,
 		"port", config.Port,
+		"vector_store", config.VectorStore,
+		"vector_distance", config.VectorDistance,
 		"chroma_url", config.ChromaURL,
+		"data_dir", config.DataDir,
 		"db_path", config.DBPath,
 		"upload_dir", config.UploadDir,
 	)
@@ -52,4 +125,62 @@ func getEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Error("Invalid integer value", "key", key, "value", value, "error", err)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		slog.Error("Invalid number value", "key", key, "value", value, "error", err)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		slog.Error("Invalid duration value", "key", key, "value", value, "error", err)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvDurationAllowZero is getEnvDuration for settings where 0 means no
+// limit.
+func getEnvDurationAllowZero(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		slog.Error("Invalid duration value", "key", key, "value", value, "error", err)
+		return defaultValue
+	}
+	return parsed
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeoutsAcceptZero(t *testing.T) {
+	t.Setenv("STORAGE_TIMEOUT", "0")
+	t.Setenv("VECTOR_STORE_TIMEOUT", "0s")
+	t.Setenv("HEALTH_CHECK_TIMEOUT", "0")
+
+	cfg := Load()
+	if cfg.StorageTimeout != 0 || cfg.VectorStoreTimeout != 0 {
+		t.Errorf("expected 0 to disable the storage timeouts, got %v and %v", cfg.StorageTimeout, cfg.VectorStoreTimeout)
+	}
+	if cfg.HealthCheckTimeout != 2*time.Second {
+		t.Errorf("expected the default health check timeout, got %v", cfg.HealthCheckTimeout)
+	}
+}
+
+func TestTimeoutsRejectInvalidValues(t *testing.T) {
+	t.Setenv("STORAGE_TIMEOUT", "-1s")
+	t.Setenv("VECTOR_STORE_TIMEOUT", "soon")
+
+	cfg := Load()
+	if cfg.StorageTimeout != 10*time.Second || cfg.VectorStoreTimeout != 30*time.Second {
+		t.Errorf("expected the defaults, got %v and %v", cfg.StorageTimeout, cfg.VectorStoreTimeout)
+	}
+}
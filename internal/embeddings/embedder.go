@@ -0,0 +1,34 @@
+package embeddings
+
+import (
+	"context"
+	"fmt"
+
+	"rag-therapist/internal/config"
+)
+
+// Embedder turns text into vectors for the vector store. Documents and
+// queries are separate calls because some models embed them differently.
+type Embedder interface {
+	EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error)
+	EmbedQuery(ctx context.Context, text string) ([]float32, error)
+	Dimensions() int
+	ModelName() string
+}
+
+// Pinger is implemented by embedders that can check that the provider is
+// reachable and accepts the credentials, without embedding anything.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// NewEmbedder returns the embedder described by cfg. It fails when the
+// OpenAI API key is missing so misconfiguration is caught at startup.
+func NewEmbedder(cfg *config.Config, opts ...Option) (Embedder, error) {
+	if cfg.OpenAIAPIKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY is required for embeddings")
+	}
+
+	opts = append([]Option{WithDimensions(cfg.EmbeddingDimensions)}, opts...)
+	return NewOpenAIEmbedder(cfg.OpenAIAPIKey, cfg.EmbeddingModel, opts...), nil
+}
@@ -0,0 +1,372 @@
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	openAIBaseURL = "https://api.openai.com"
+
+	// OpenAI accepts at most 2048 inputs and 300k tokens per embeddings
+	// request.
+	maxBatchInputs = 2048
+	maxBatchTokens = 300000
+
+	defaultMaxRetries     = 5
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+
+	maxErrorBodySize = 64 << 10
+)
+
+// Native output sizes of the OpenAI embedding models.
+var openAIModelDimensions = map[string]int{
+	"text-embedding-3-small": 1536,
+	"text-embedding-3-large": 3072,
+	"text-embedding-ada-002": 1536,
+}
+
+type OpenAIEmbedder struct {
+	apiKey         string
+	model          string
+	dimensions     int
+	baseURL        string
+	httpClient     *http.Client
+	batchSize      int
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+type Option func(*OpenAIEmbedder)
+
+// WithBaseURL points the embedder at a different API host, e.g. a proxy
+// or a test server.
+func WithBaseURL(baseURL string) Option {
+	return func(e *OpenAIEmbedder) {
+		e.baseURL = baseURL
+	}
+}
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(e *OpenAIEmbedder) {
+		e.httpClient = httpClient
+	}
+}
+
+// WithDimensions requests shortened embeddings from models that support
+// it. Zero keeps the model's native size.
+func WithDimensions(dimensions int) Option {
+	return func(e *OpenAIEmbedder) {
+		if dimensions > 0 {
+			e.dimensions = dimensions
+		}
+	}
+}
+
+// WithBatchSize caps the number of inputs sent per request. Values above
+// the API limit are clamped to it.
+func WithBatchSize(size int) Option {
+	return func(e *OpenAIEmbedder) {
+		if size > 0 && size <= maxBatchInputs {
+			e.batchSize = size
+		}
+	}
+}
+
+// WithRetry configures how often and how patiently 429 and 5xx responses
+// are retried. A Retry-After header from the server takes precedence over
+// the computed backoff.
+func WithRetry(maxRetries int, initialBackoff, maxBackoff time.Duration) Option {
+	return func(e *OpenAIEmbedder) {
+		e.maxRetries = maxRetries
+		e.initialBackoff = initialBackoff
+		e.maxBackoff = maxBackoff
+	}
+}
+
+func NewOpenAIEmbedder(apiKey, model string, opts ...Option) *OpenAIEmbedder {
+	e := &OpenAIEmbedder{
+		apiKey:         apiKey,
+		model:          model,
+		dimensions:     openAIModelDimensions[model],
+		baseURL:        openAIBaseURL,
+		httpClient:     &http.Client{Timeout: 60 * time.Second},
+		batchSize:      maxBatchInputs,
+		maxRetries:     defaultMaxRetries,
+		initialBackoff: defaultInitialBackoff,
+		maxBackoff:     defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+func (e *OpenAIEmbedder) Dimensions() int {
+	return e.dimensions
+}
+
+func (e *OpenAIEmbedder) ModelName() string {
+	return e.model
+}
+
+func (e *OpenAIEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	vectors, err := e.EmbedDocuments(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+func (e *OpenAIEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	result := make([][]float32, 0, len(texts))
+
+	for _, batch := range e.batches(texts) {
+		vectors, err := e.embedBatch(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, vectors...)
+	}
+
+	return result, nil
+}
+
+// batches splits texts into request-sized groups, keeping each under both
+// the input count and the (estimated) token limit.
+func (e *OpenAIEmbedder) batches(texts []string) [][]string {
+	var batches [][]string
+	var current []string
+	currentTokens := 0
+
+	for _, text := range texts {
+		tokens := estimateTokens(text)
+		if len(current) > 0 && (len(current) >= e.batchSize || currentTokens+tokens > maxBatchTokens) {
+			batches = append(batches, current)
+			current, currentTokens = nil, 0
+		}
+		current = append(current, text)
+		currentTokens += tokens
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+
+	return batches
+}
+
+// estimateTokens over-approximates the token count (~4 characters per
+// token for English) so batches stay under the API limit without a
+// tokenizer.
+func estimateTokens(text string) int {
+	return len(text)/3 + 1
+}
+
+type embeddingRequest struct {
+	Model          string   `json:"model"`
+	Input          []string `json:"input"`
+	EncodingFormat string   `json:"encoding_format"`
+	Dimensions     int      `json:"dimensions,omitempty"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Usage struct {
+		PromptTokens int `json:"prompt_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+// APIError is returned when the embeddings API answers with a non-2xx
+// status that was not (or no longer) retried.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("openai embeddings API error (status %d): %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+func (e *OpenAIEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	req := embeddingRequest{
+		Model:          e.model,
+		Input:          texts,
+		EncodingFormat: "float",
+	}
+	// Only ask for a non-native size; ada-002 rejects the parameter.
+	if e.dimensions != openAIModelDimensions[e.model] {
+		req.Dimensions = e.dimensions
+	}
+
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode embeddings request: %w", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, retryAfter, err := e.post(ctx, payload)
+		if err == nil {
+			return orderEmbeddings(resp, len(texts))
+		}
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !apiErr.retryable() || attempt >= e.maxRetries {
+			return nil, err
+		}
+
+		wait := e.backoff(attempt)
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		slog.Warn("Retrying embeddings request", "attempt", attempt+1, "status", apiErr.StatusCode, "wait", wait)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Ping looks the configured model up in the Models API, which checks the
+// API key without embedding anything.
+func (e *OpenAIEmbedder) Ping(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, e.baseURL+"/v1/models/"+url.PathEscape(e.model), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create models request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+e.apiKey)
+
+	httpResp, err := e.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to call models API: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		raw, _ := io.ReadAll(io.LimitReader(httpResp.Body, maxErrorBodySize))
+
+		message := http.StatusText(httpResp.StatusCode)
+		var errResp errorResponse
+		if json.Unmarshal(raw, &errResp) == nil && errResp.Error.Message != "" {
+			message = errResp.Error.Message
+		}
+		return &APIError{StatusCode: httpResp.StatusCode, Message: message}
+	}
+	return nil
+}
+
+// post performs one embeddings request. On failure it also returns the
+// server's Retry-After hint, if any.
+func (e *OpenAIEmbedder) post(ctx context.Context, payload []byte) (*embeddingResponse, time.Duration, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/v1/embeddings", bytes.NewReader(payload))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create embeddings request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+e.apiKey)
+
+	httpResp, err := e.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to call embeddings API: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		raw, _ := io.ReadAll(io.LimitReader(httpResp.Body, maxErrorBodySize))
+
+		message := http.StatusText(httpResp.StatusCode)
+		var errResp errorResponse
+		if json.Unmarshal(raw, &errResp) == nil && errResp.Error.Message != "" {
+			message = errResp.Error.Message
+		}
+
+		return nil, parseRetryAfter(httpResp.Header.Get("Retry-After")), &APIError{StatusCode: httpResp.StatusCode, Message: message}
+	}
+
+	var resp embeddingResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode embeddings response: %w", err)
+	}
+
+	return &resp, 0, nil
+}
+
+// backoff is exponential with full jitter, capped at maxBackoff.
+func (e *OpenAIEmbedder) backoff(attempt int) time.Duration {
+	wait := e.initialBackoff << attempt
+	if wait <= 0 || wait > e.maxBackoff {
+		wait = e.maxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(wait)) + 1)
+}
+
+// parseRetryAfter understands both forms of the header: delay-seconds and
+// an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// orderEmbeddings puts the returned vectors back into input order; the API
+// tags each one with the index of its input.
+func orderEmbeddings(resp *embeddingResponse, expected int) ([][]float32, error) {
+	if len(resp.Data) != expected {
+		return nil, fmt.Errorf("embeddings API returned %d vectors for %d inputs", len(resp.Data), expected)
+	}
+
+	sort.Slice(resp.Data, func(i, j int) bool {
+		return resp.Data[i].Index < resp.Data[j].Index
+	})
+
+	vectors := make([][]float32, expected)
+	for i, item := range resp.Data {
+		if item.Index != i {
+			return nil, fmt.Errorf("embeddings API returned unexpected index %d", item.Index)
+		}
+		vectors[i] = item.Embedding
+	}
+
+	return vectors, nil
+}
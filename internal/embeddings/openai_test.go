@@ -0,0 +1,217 @@
+package embeddings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeOpenAI answers embeddings requests with vectors whose first element
+// encodes the input, returning the data in reverse order to exercise the
+// index handling.
+func fakeOpenAI(t *testing.T, requests *[]embeddingRequest) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("unexpected Authorization header %q", got)
+		}
+
+		var req embeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if requests != nil {
+			*requests = append(*requests, req)
+		}
+
+		var resp embeddingResponse
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			var value float32
+			fmt.Sscanf(req.Input[i], "text %f", &value)
+			resp.Data = append(resp.Data, struct {
+				Index     int       `json:"index"`
+				Embedding []float32 `json:"embedding"`
+			}{Index: i, Embedding: []float32{value, 0.5}})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func TestOpenAIEmbedderBatchesAndOrders(t *testing.T) {
+	var requests []embeddingRequest
+	server := httptest.NewServer(fakeOpenAI(t, &requests))
+	defer server.Close()
+
+	embedder := NewOpenAIEmbedder("test-key", "text-embedding-3-small", WithBaseURL(server.URL), WithBatchSize(2))
+
+	texts := []string{"text 1", "text 2", "text 3", "text 4", "text 5"}
+	vectors, err := embedder.EmbedDocuments(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("EmbedDocuments failed: %v", err)
+	}
+
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 batched requests, got %d", len(requests))
+	}
+	if requests[0].Model != "text-embedding-3-small" || requests[0].Dimensions != 0 {
+		t.Errorf("unexpected request: %+v", requests[0])
+	}
+
+	if len(vectors) != len(texts) {
+		t.Fatalf("expected %d vectors, got %d", len(texts), len(vectors))
+	}
+	for i, vector := range vectors {
+		if vector[0] != float32(i+1) {
+			t.Errorf("vector %d out of order: %v", i, vector)
+		}
+	}
+
+	if embedder.Dimensions() != 1536 || embedder.ModelName() != "text-embedding-3-small" {
+		t.Errorf("unexpected model info: %d %s", embedder.Dimensions(), embedder.ModelName())
+	}
+}
+
+func TestOpenAIEmbedderSplitsOnTokenBudget(t *testing.T) {
+	embedder := NewOpenAIEmbedder("test-key", "text-embedding-3-small")
+
+	large := make([]byte, maxBatchTokens*2)
+	for i := range large {
+		large[i] = 'a'
+	}
+
+	batches := embedder.batches([]string{string(large), string(large), "small"})
+	if len(batches) != 2 || len(batches[0]) != 1 || len(batches[1]) != 2 {
+		t.Fatalf("expected inputs split at the token budget, got batch sizes %v", batchSizes(batches))
+	}
+}
+
+func batchSizes(batches [][]string) []int {
+	sizes := make([]int, len(batches))
+	for i, batch := range batches {
+		sizes[i] = len(batch)
+	}
+	return sizes
+}
+
+func TestOpenAIEmbedderRetriesWithRetryAfter(t *testing.T) {
+	var calls int32
+	success := fakeOpenAI(t, nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error": {"message": "Rate limit reached", "type": "requests"}}`))
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			success(w, r)
+		}
+	}))
+	defer server.Close()
+
+	embedder := NewOpenAIEmbedder("test-key", "text-embedding-3-small",
+		WithBaseURL(server.URL),
+		WithRetry(3, time.Millisecond, 5*time.Millisecond),
+	)
+
+	start := time.Now()
+	vector, err := embedder.EmbedQuery(context.Background(), "text 7")
+	if err != nil {
+		t.Fatalf("EmbedQuery failed: %v", err)
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected Retry-After to be honoured, finished after %v", elapsed)
+	}
+	if vector[0] != 7 {
+		t.Errorf("unexpected vector %v", vector)
+	}
+}
+
+func TestOpenAIEmbedderDoesNotRetryClientErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": {"message": "Invalid input", "type": "invalid_request_error"}}`))
+	}))
+	defer server.Close()
+
+	embedder := NewOpenAIEmbedder("test-key", "text-embedding-3-small",
+		WithBaseURL(server.URL),
+		WithRetry(3, time.Millisecond, 5*time.Millisecond),
+	)
+
+	_, err := embedder.EmbedQuery(context.Background(), "text 1")
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Message != "Invalid input" {
+		t.Fatalf("expected 400 APIError, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("expected a single attempt, got %d", got)
+	}
+}
+
+func TestOpenAIEmbedderGivesUpAfterMaxRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	embedder := NewOpenAIEmbedder("test-key", "text-embedding-3-small",
+		WithBaseURL(server.URL),
+		WithRetry(2, time.Millisecond, 5*time.Millisecond),
+	)
+
+	_, err := embedder.EmbedQuery(context.Background(), "text 1")
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 APIError, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+}
+
+func TestOpenAIEmbedderPing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/models/text-embedding-3-small" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": {"message": "Incorrect API key provided"}}`))
+			return
+		}
+		w.Write([]byte(`{"id": "text-embedding-3-small", "object": "model"}`))
+	}))
+	defer server.Close()
+
+	if err := NewOpenAIEmbedder("test-key", "text-embedding-3-small", WithBaseURL(server.URL)).Ping(context.Background()); err != nil {
+		t.Errorf("Ping failed: %v", err)
+	}
+
+	var apiErr *APIError
+	err := NewOpenAIEmbedder("bad-key", "text-embedding-3-small", WithBaseURL(server.URL)).Ping(context.Background())
+	if !errors.As(err, &apiErr) || apiErr.Message != "Incorrect API key provided" {
+		t.Errorf("expected an APIError for a bad key, got %v", err)
+	}
+}
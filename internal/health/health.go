@@ -0,0 +1,143 @@
+// Package health runs the dependency checks behind the readiness and
+// status endpoints and remembers their last failure.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds a check that does not set its own timeout.
+const DefaultTimeout = 2 * time.Second
+
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+)
+
+// Check is one dependency check. Run must return once ctx is done; a check
+// that does not is reported as timed out anyway.
+type Check struct {
+	Name    string
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// Result is the outcome of the latest run of a check. LastError and
+// LastErrorAt describe the most recent failure, which may be older than
+// the latest run.
+type Result struct {
+	Name          string     `json:"name"`
+	Status        string     `json:"status"`
+	LatencyMS     int64      `json:"latency_ms"`
+	Error         string     `json:"error,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+}
+
+// Checker runs a fixed set of checks. It is safe for concurrent use.
+type Checker struct {
+	checks []Check
+
+	mu    sync.Mutex
+	state map[string]Result
+}
+
+func NewChecker(checks ...Check) *Checker {
+	return &Checker{
+		checks: checks,
+		state:  make(map[string]Result),
+	}
+}
+
+// Run runs all checks concurrently, each within its timeout, and returns
+// their results in the order the checks were given.
+func (c *Checker) Run(ctx context.Context) []Result {
+	results := make([]Result, len(c.checks))
+
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = c.record(check.Name, run(ctx, check))
+		}(i, check)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// Healthy reports whether every result is ok.
+func Healthy(results []Result) bool {
+	for _, result := range results {
+		if result.Status != StatusOK {
+			return false
+		}
+	}
+	return true
+}
+
+// outcome is a single run of a check.
+type outcome struct {
+	err     error
+	latency time.Duration
+	at      time.Time
+}
+
+func run(ctx context.Context, check Check) outcome {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	start := time.Now()
+	err := WithTimeout(ctx, timeout, check.Run)
+	return outcome{err: err, latency: time.Since(start), at: start}
+}
+
+// WithTimeout calls fn with a context that expires after timeout and
+// returns once fn does or the timeout passes, whichever is first. fn keeps
+// running in the background if it ignores its context.
+func WithTimeout(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+}
+
+// record folds an outcome into the state kept for the check.
+func (c *Checker) record(name string, o outcome) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := c.state[name]
+	result.Name = name
+	result.LatencyMS = o.latency.Milliseconds()
+	at := o.at
+	if o.err != nil {
+		result.Status = StatusFailing
+		result.Error = o.err.Error()
+		result.LastError = result.Error
+		result.LastErrorAt = &at
+	} else {
+		result.Status = StatusOK
+		result.Error = ""
+		result.LastSuccessAt = &at
+	}
+
+	c.state[name] = result
+	return result
+}
@@ -0,0 +1,61 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckerRun(t *testing.T) {
+	failing := true
+	checker := NewChecker(
+		Check{Name: "database", Run: func(ctx context.Context) error { return nil }},
+		Check{Name: "vector_store", Run: func(ctx context.Context) error {
+			if failing {
+				return errors.New("connection refused")
+			}
+			return nil
+		}},
+	)
+
+	results := checker.Run(context.Background())
+	if len(results) != 2 || results[0].Name != "database" || results[1].Name != "vector_store" {
+		t.Fatalf("expected results in check order, got %+v", results)
+	}
+	if results[0].Status != StatusOK || results[0].LastSuccessAt == nil {
+		t.Errorf("expected the database check to pass, got %+v", results[0])
+	}
+	if results[1].Status != StatusFailing || results[1].Error != "connection refused" || Healthy(results) {
+		t.Errorf("expected the vector store check to fail, got %+v", results[1])
+	}
+
+	failing = false
+	results = checker.Run(context.Background())
+	if !Healthy(results) {
+		t.Fatalf("expected all checks to pass, got %+v", results)
+	}
+	if results[1].Error != "" || results[1].LastError != "connection refused" || results[1].LastErrorAt == nil {
+		t.Errorf("expected the last error to be remembered after recovery, got %+v", results[1])
+	}
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	checker := NewChecker(Check{Name: "llm", Timeout: 20 * time.Millisecond, Run: func(ctx context.Context) error {
+		// Ignores ctx, like a client without deadline support.
+		<-release
+		return nil
+	}})
+
+	start := time.Now()
+	results := checker.Run(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the check to be abandoned at its timeout, took %s", elapsed)
+	}
+	if results[0].Status != StatusFailing || results[0].Error != "timed out after 20ms" {
+		t.Errorf("expected a timeout, got %+v", results[0])
+	}
+}
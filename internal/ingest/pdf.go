@@ -0,0 +1,161 @@
+package ingest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+var (
+	ErrEncryptedPDF = errors.New("PDF is encrypted")
+	ErrNoTextInPDF  = errors.New("PDF contains no extractable text (it may contain only scanned images)")
+	ErrMalformedPDF = errors.New("PDF is malformed")
+)
+
+// Page is the text of one PDF page. Number is 1-based.
+type Page struct {
+	Number int
+	Text   string
+}
+
+// ExtractPDF returns the text of every page that has any. Encrypted,
+// image-only and unreadable files are reported as ErrEncryptedPDF,
+// ErrNoTextInPDF and ErrMalformedPDF so the caller can record a reason.
+func ExtractPDF(path string) (pages []Page, err error) {
+	// The PDF parser panics on some malformed input.
+	defer func() {
+		if r := recover(); r != nil {
+			pages = nil
+			err = fmt.Errorf("%w: %v", ErrMalformedPDF, r)
+		}
+	}()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PDF: %w", err)
+	}
+	defer file.Close()
+
+	reader, err := openPDF(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pageCount := reader.NumPage()
+	failedPages := 0
+
+	for i := 1; i <= pageCount; i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			failedPages++
+			slog.Warn("Failed to extract PDF page text", "path", path, "page", i, "error", err)
+			continue
+		}
+
+		text = normalizeText(text)
+		if text == "" {
+			continue
+		}
+
+		pages = append(pages, Page{Number: i, Text: text})
+	}
+
+	if len(pages) == 0 {
+		if failedPages > 0 {
+			return nil, fmt.Errorf("%w: could not read any of %d pages", ErrMalformedPDF, pageCount)
+		}
+		return nil, ErrNoTextInPDF
+	}
+
+	return pages, nil
+}
+
+// CheckPDF reports whether the file at path can be processed without
+// extracting its text, which is left to the worker. Encrypted files are
+// ErrEncryptedPDF even when they open without a password, and files whose
+// structure cannot be read or that have no pages are ErrMalformedPDF.
+func CheckPDF(path string) (err error) {
+	// The PDF parser panics on some malformed input.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrMalformedPDF, r)
+		}
+	}()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open PDF: %w", err)
+	}
+	defer file.Close()
+
+	reader, err := openPDF(file)
+	if err != nil {
+		return err
+	}
+	if !reader.Trailer().Key("Encrypt").IsNull() {
+		return ErrEncryptedPDF
+	}
+	if reader.NumPage() == 0 {
+		return fmt.Errorf("%w: no pages", ErrMalformedPDF)
+	}
+	return nil
+}
+
+// openPDF parses the structure of file, reporting encrypted and broken
+// files as ErrEncryptedPDF and ErrMalformedPDF.
+func openPDF(file *os.File) (*pdf.Reader, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat PDF: %w", err)
+	}
+
+	reader, err := pdf.NewReader(file, info.Size())
+	if err != nil {
+		if errors.Is(err, pdf.ErrInvalidPassword) || hasEncryptDictionary(file, info.Size()) {
+			return nil, fmt.Errorf("%w: %v", ErrEncryptedPDF, err)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrMalformedPDF, err)
+	}
+	return reader, nil
+}
+
+// hasEncryptDictionary reports whether the trailer, which sits at the end
+// of the file, references an /Encrypt dictionary. The parser reports
+// unsupported encryption schemes as generic errors, so this tells them
+// apart from files that are simply broken.
+func hasEncryptDictionary(file io.ReaderAt, size int64) bool {
+	const tailSize = 64 << 10
+
+	offset := size - tailSize
+	if offset < 0 {
+		offset = 0
+	}
+
+	tail := make([]byte, size-offset)
+	n, _ := file.ReadAt(tail, offset)
+	return bytes.Contains(tail[:n], []byte("/Encrypt"))
+}
+
+// normalizeText drops NUL bytes and trailing whitespace on each line that
+// PDF text extraction tends to leave behind.
+func normalizeText(text string) string {
+	text = strings.ReplaceAll(text, "\x00", "")
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,167 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildPDF writes a minimal single-font PDF with one page per entry in
+// pages. An empty entry produces a page without a content stream, which is
+// what a scanned page without a text layer looks like to the extractor.
+func buildPDF(t *testing.T, pages []string) string {
+	t.Helper()
+
+	var objects []string
+	pageCount := len(pages)
+	fontID := 3 + 2*pageCount
+
+	kids := make([]string, pageCount)
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 3+2*i)
+	}
+
+	objects = append(objects, "<< /Type /Catalog /Pages 2 0 R >>")
+	objects = append(objects, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pageCount))
+	for i, text := range pages {
+		contentID := 4 + 2*i
+		if text == "" {
+			objects = append(objects, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>")
+			objects = append(objects, "<< /Length 0 >>\nstream\n\nendstream")
+			continue
+		}
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 %d 0 R >> >> /Contents %d 0 R >>", fontID, contentID))
+		stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream))
+	}
+	objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>")
+
+	return writePDF(t, objects, "")
+}
+
+// writePDF serialises objects (numbered from 1, object 1 being the
+// catalog) with a valid xref table. trailerExtra is appended to the
+// trailer dictionary.
+func writePDF(t *testing.T, objects []string, trailerExtra string) string {
+	t.Helper()
+
+	var b strings.Builder
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R %s>>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, trailerExtra, xref)
+
+	path := filepath.Join(t.TempDir(), "test.pdf")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatalf("failed to write PDF: %v", err)
+	}
+	return path
+}
+
+func TestExtractPDFPages(t *testing.T) {
+	path := buildPDF(t, []string{"First page text", "", "Third page text"})
+
+	pages, err := ExtractPDF(path)
+	if err != nil {
+		t.Fatalf("ExtractPDF failed: %v", err)
+	}
+
+	if len(pages) != 2 {
+		t.Fatalf("expected 2 pages with text, got %d: %+v", len(pages), pages)
+	}
+	if pages[0].Number != 1 || !strings.Contains(pages[0].Text, "First page text") {
+		t.Errorf("unexpected first page: %+v", pages[0])
+	}
+	if pages[1].Number != 3 || !strings.Contains(pages[1].Text, "Third page text") {
+		t.Errorf("expected page numbers to be kept, got %+v", pages[1])
+	}
+}
+
+func TestExtractPDFImageOnly(t *testing.T) {
+	path := buildPDF(t, []string{"", ""})
+
+	_, err := ExtractPDF(path)
+	if !errors.Is(err, ErrNoTextInPDF) {
+		t.Fatalf("expected ErrNoTextInPDF, got %v", err)
+	}
+}
+
+func TestExtractPDFMalformed(t *testing.T) {
+	tests := map[string]string{
+		"not a pdf":     "hello, world",
+		"truncated":     "%PDF-1.4\n1 0 obj\n<< /Type /Catalog",
+		"broken xref":   "%PDF-1.4\nstartxref\n9999\n%%EOF\n",
+		"garbage xref":  "%PDF-1.4\nxref\nnonsense\nstartxref\n9\n%%EOF\n",
+		"missing pages": "%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\nxref\n0 2\n0000000000 65535 f \n0000000009 00000 n \ntrailer\n<< /Size 2 /Root 1 0 R >>\nstartxref\n53\n%%EOF\n",
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bad.pdf")
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+
+			_, err := ExtractPDF(path)
+			if !errors.Is(err, ErrMalformedPDF) && !errors.Is(err, ErrNoTextInPDF) {
+				t.Fatalf("expected a malformed or no-text error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractPDFEncrypted(t *testing.T) {
+	path := writePDF(t, []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		"<< /Filter /Standard /V 2 /R 3 /Length 128 /P -3904 /O <00> /U <00> >>",
+	}, "/Encrypt 3 0 R ")
+
+	_, err := ExtractPDF(path)
+	if !errors.Is(err, ErrEncryptedPDF) {
+		t.Fatalf("expected ErrEncryptedPDF, got %v", err)
+	}
+}
+
+func TestCheckPDF(t *testing.T) {
+	for _, pages := range [][]string{{"Some text"}, {""}} {
+		if err := CheckPDF(buildPDF(t, pages)); err != nil {
+			t.Errorf("expected %q to pass, got %v", pages, err)
+		}
+	}
+
+	encrypted := writePDF(t, []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		"<< /Filter /Standard /V 2 /R 3 /Length 128 /P -3904 /O <00> /U <00> >>",
+	}, "/Encrypt 3 0 R ")
+	if err := CheckPDF(encrypted); !errors.Is(err, ErrEncryptedPDF) {
+		t.Errorf("expected ErrEncryptedPDF, got %v", err)
+	}
+
+	for name, content := range map[string]string{
+		"truncated":   "%PDF-1.4\n1 0 obj\n<< /Type /Catalog",
+		"broken xref": "%PDF-1.4\nstartxref\n9999\n%%EOF\n",
+		"no pages":    "%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\nxref\n0 2\n0000000000 65535 f \n0000000009 00000 n \ntrailer\n<< /Size 2 /Root 1 0 R >>\nstartxref\n53\n%%EOF\n",
+	} {
+		path := filepath.Join(t.TempDir(), "bad.pdf")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		if err := CheckPDF(path); !errors.Is(err, ErrMalformedPDF) {
+			t.Errorf("%s: expected ErrMalformedPDF, got %v", name, err)
+		}
+	}
+}
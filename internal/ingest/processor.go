@@ -0,0 +1,94 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"rag-therapist/internal/chunking"
+	"rag-therapist/internal/knowledge"
+	"rag-therapist/internal/storage"
+	"rag-therapist/pkg/models"
+)
+
+// Processor turns an uploaded document into searchable chunks: it extracts
+// the text, embeds it and stores the chunks in the vector store, using the
+// settings of the document's knowledge base.
+type Processor struct {
+	bases *knowledge.Registry
+}
+
+func NewProcessor(bases *knowledge.Registry) *Processor {
+	return &Processor{
+		bases: bases,
+	}
+}
+
+// Process runs the whole pipeline for a claimed document. It only does
+// the work; recording the outcome on the job and document is left to the
+// caller. Panics are turned into errors so one bad file cannot take down
+// the worker.
+func (p *Processor) Process(ctx context.Context, doc *models.Document) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while processing document: %v", r)
+		}
+	}()
+
+	slog.Info("Processing document", "document_id", doc.ID, "knowledge_base_id", doc.KnowledgeBaseID, "file_name", doc.FileName)
+
+	base, err := p.bases.Get(ctx, doc.KnowledgeBaseID)
+	if err != nil {
+		return err
+	}
+
+	// Check the vector store first so an outage does not cost an
+	// embedding run whose results cannot be stored.
+	if err := base.Vectors.Heartbeat(ctx); err != nil {
+		return err
+	}
+
+	pages, err := ExtractPDF(doc.FilePath)
+	if err != nil {
+		return err
+	}
+
+	sourcePages := make([]chunking.Page, len(pages))
+	for i, page := range pages {
+		sourcePages[i] = chunking.Page{Number: page.Number, Text: page.Text}
+	}
+
+	documentChunks := chunking.ChunkPages(base.Chunker, sourcePages)
+	chunks := make([]string, len(documentChunks))
+	chunkMetadata := make([]map[string]string, len(documentChunks))
+	for i, chunk := range documentChunks {
+		chunks[i] = chunk.Text
+		chunkMetadata[i] = chunk.Metadata()
+	}
+
+	vectors, err := base.Embedder.EmbedDocuments(ctx, chunks)
+	if err != nil {
+		return fmt.Errorf("failed to embed chunks: %w", err)
+	}
+
+	// Drop chunks from an earlier run so reprocessing never duplicates them.
+	if err := base.Vectors.DeleteDocumentChunks(ctx, doc.ID); err != nil {
+		return err
+	}
+
+	metadata := map[string]string{
+		"file_name":            doc.FileName,
+		"embedding_model":      base.Embedder.ModelName(),
+		storage.MetaUploadedAt: strconv.FormatInt(doc.UploadedAt.Unix(), 10),
+	}
+	for _, tag := range doc.Tags {
+		metadata[storage.MetaTagPrefix+tag] = "true"
+	}
+	if err := base.Vectors.StoreChunksWithMetadata(ctx, doc.ID, chunks, vectors, metadata, chunkMetadata); err != nil {
+		return err
+	}
+
+	slog.Info("Document processed", "document_id", doc.ID, "pages", len(pages), "chunks", len(chunks))
+	return nil
+}
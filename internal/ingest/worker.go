@@ -0,0 +1,291 @@
+package ingest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"rag-therapist/internal/storage"
+	"rag-therapist/pkg/models"
+)
+
+// A claimed job is leased for leaseDuration and the lease is renewed every
+// heartbeatInterval while the document is processed. A crashed worker's
+// job becomes claimable again once its lease runs out, or as soon as the
+// server starts again.
+const (
+	leaseDuration     = 2 * time.Minute
+	heartbeatInterval = leaseDuration / 3
+)
+
+// unavailableRetryDelay is how long a job waits when the vector store is
+// down. Such jobs do not use up their attempts, so uploads made during an
+// outage are processed once the store is back.
+const unavailableRetryDelay = 30 * time.Second
+
+// DocumentProcessor turns a claimed document into indexed chunks.
+// *Processor is the implementation used by the server.
+type DocumentProcessor interface {
+	Process(ctx context.Context, doc *models.Document) error
+}
+
+// WorkerPool drains the ingestion job queue with a fixed number of
+// concurrent workers. Workers poll for due jobs and can be woken early
+// with Notify when a document is uploaded.
+type WorkerPool struct {
+	processor    DocumentProcessor
+	storage      *storage.StorageService
+	concurrency  int
+	pollInterval time.Duration
+	owner        string
+
+	wake chan struct{}
+	quit chan struct{}
+
+	// processCtx is cancelled only when a graceful shutdown times out, so
+	// in-flight documents normally get to finish.
+	processCtx    context.Context
+	cancelProcess context.CancelFunc
+
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+func NewWorkerPool(processor DocumentProcessor, storageService *storage.StorageService, concurrency int, pollInterval time.Duration) *WorkerPool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	processCtx, cancel := context.WithCancel(context.Background())
+
+	return &WorkerPool{
+		processor:     processor,
+		storage:       storageService,
+		concurrency:   concurrency,
+		pollInterval:  pollInterval,
+		owner:         newOwnerID(),
+		wake:          make(chan struct{}, concurrency),
+		quit:          make(chan struct{}),
+		processCtx:    processCtx,
+		cancelProcess: cancel,
+	}
+}
+
+// Start reclaims jobs a previous run left running, queues jobs for
+// documents that need processing but have none and launches the workers.
+func (w *WorkerPool) Start(ctx context.Context) error {
+	expired, err := w.storage.ExpireJobLeases(ctx)
+	if err != nil {
+		return err
+	}
+	if expired > 0 {
+		slog.Warn("Reclaiming jobs left running by a previous run", "count", expired)
+	}
+
+	recovered, err := w.storage.RecoverDocumentJobs(ctx)
+	if err != nil {
+		return err
+	}
+	if recovered > 0 {
+		slog.Warn("Queued jobs for documents without one", "count", recovered)
+	}
+
+	for i := 0; i < w.concurrency; i++ {
+		w.wg.Add(1)
+		go w.run(i)
+	}
+
+	slog.Info("Ingestion workers started", "owner", w.owner, "concurrency", w.concurrency, "poll_interval", w.pollInterval)
+	return nil
+}
+
+// Notify wakes idle workers so a new document is picked up without
+// waiting for the next poll.
+func (w *WorkerPool) Notify() {
+	for i := 0; i < w.concurrency; i++ {
+		select {
+		case w.wake <- struct{}{}:
+		default:
+			return
+		}
+	}
+}
+
+// Shutdown stops claiming new documents and waits for in-flight ones to
+// finish. If ctx expires first, in-flight processing is cancelled and
+// those jobs are released back to the queue.
+func (w *WorkerPool) Shutdown(ctx context.Context) error {
+	w.stopOnce.Do(func() { close(w.quit) })
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		w.cancelProcess()
+		return nil
+	case <-ctx.Done():
+		w.cancelProcess()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (w *WorkerPool) run(id int) {
+	defer w.wg.Done()
+
+	for {
+		w.drain(id)
+
+		select {
+		case <-w.quit:
+			return
+		case <-w.wake:
+		case <-time.After(w.pollInterval):
+		}
+	}
+}
+
+// drain processes due jobs until none are left or the pool is shutting
+// down.
+func (w *WorkerPool) drain(id int) {
+	owner := fmt.Sprintf("%s/%d", w.owner, id)
+
+	for {
+		select {
+		case <-w.quit:
+			return
+		default:
+		}
+
+		job, doc, err := w.storage.ClaimJob(w.processCtx, owner, leaseDuration)
+		if err != nil {
+			slog.Error("Failed to claim job", "worker", id, "error", err)
+			return
+		}
+		if job == nil {
+			return
+		}
+
+		slog.Info("Worker claimed job", "worker", id, "job_id", job.ID, "document_id", doc.ID, "attempt", job.Attempts)
+		w.runJob(job, doc)
+	}
+}
+
+// runJob processes the document while keeping the job's lease alive, then
+// records the outcome.
+func (w *WorkerPool) runJob(job *models.Job, doc *models.Document) {
+	ctx, cancel := context.WithCancel(w.processCtx)
+	defer cancel()
+
+	var leaseLost bool
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		leaseLost = w.heartbeat(ctx, cancel, job)
+	}()
+
+	err := w.processor.Process(ctx, doc)
+	cancel()
+	<-heartbeatDone
+
+	log := slog.With("job_id", job.ID, "document_id", doc.ID, "file_name", doc.FileName, "attempt", job.Attempts)
+
+	// The outcome is recorded even when processing was cancelled by a
+	// shutdown; the storage timeout still bounds it.
+	ctx = context.Background()
+
+	switch {
+	case err == nil:
+		if err := w.storage.CompleteJob(ctx, job); err != nil {
+			log.Error("Failed to record completed job", "error", err)
+			return
+		}
+		log.Info("Job completed")
+
+	case w.processCtx.Err() != nil:
+		log.Warn("Job interrupted by shutdown, releasing", "error", err)
+		if err := w.storage.ReleaseJob(ctx, job); err != nil {
+			log.Error("Failed to release job", "error", err)
+		}
+
+	case leaseLost:
+		// Another worker owns the job now and records the outcome.
+		log.Warn("Job abandoned after losing its lease", "error", err)
+
+	case errors.Is(err, storage.ErrVectorStoreUnavailable):
+		if err := w.storage.PostponeJob(ctx, job, err.Error(), unavailableRetryDelay); err != nil {
+			log.Error("Failed to postpone job", "error", err)
+			return
+		}
+		log.Warn("Vector store unavailable, job postponed", "retry_in", unavailableRetryDelay, "error", err)
+
+	default:
+		retrying, failErr := w.storage.FailJob(ctx, job, err.Error(), !isPermanent(err))
+		if failErr != nil {
+			log.Error("Failed to record failed job", "error", failErr, "job_error", err)
+			return
+		}
+		if retrying {
+			log.Warn("Job failed, will retry", "error", err)
+			return
+		}
+		log.Error("Job failed", "error", err)
+	}
+}
+
+// heartbeat renews the job's lease until ctx is done. If the lease was
+// lost it cancels processing and returns true.
+func (w *WorkerPool) heartbeat(ctx context.Context, cancel context.CancelFunc, job *models.Job) bool {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			err := w.storage.ExtendJobLease(ctx, job, leaseDuration)
+			if errors.Is(err, storage.ErrLeaseLost) {
+				slog.Warn("Lost lease on job, cancelling", "job_id", job.ID)
+				cancel()
+				return true
+			}
+			if err != nil {
+				slog.Error("Failed to extend job lease", "job_id", job.ID, "error", err)
+			}
+		}
+	}
+}
+
+// isPermanent reports whether retrying err is pointless because the file
+// itself is unusable.
+func isPermanent(err error) bool {
+	return errors.Is(err, ErrEncryptedPDF) ||
+		errors.Is(err, ErrNoTextInPDF) ||
+		errors.Is(err, ErrMalformedPDF) ||
+		errors.Is(err, os.ErrNotExist)
+}
+
+// newOwnerID identifies this process in job leases. The random suffix
+// keeps IDs unique across restarts that reuse a PID, e.g. in containers.
+func newOwnerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "worker"
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
@@ -0,0 +1,298 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rag-therapist/internal/storage"
+	"rag-therapist/pkg/models"
+)
+
+// fakeProcessor stands in for *Processor so the worker pool can be tested
+// without PDFs, embedders or a vector store.
+type fakeProcessor func(ctx context.Context, doc *models.Document) error
+
+func (f fakeProcessor) Process(ctx context.Context, doc *models.Document) error {
+	return f(ctx, doc)
+}
+
+func newWorkerTestStorage(t *testing.T, maxAttempts int) *storage.StorageService {
+	t.Helper()
+	ctx := context.Background()
+
+	s, err := storage.NewStorageService(t.TempDir(), storage.WithRetryPolicy(storage.RetryPolicy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   10 * time.Millisecond,
+		MaxDelay:    50 * time.Millisecond,
+	}))
+	if err != nil {
+		t.Fatalf("NewStorageService failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	_, err = s.EnsureDefaultKnowledgeBase(ctx, models.KnowledgeBase{
+		Name:           "default",
+		EmbeddingModel: "test-embedding",
+		ChunkStrategy:  "recursive",
+		ChunkSize:      1000,
+		ChunkOverlap:   200,
+	})
+	if err != nil {
+		t.Fatalf("EnsureDefaultKnowledgeBase failed: %v", err)
+	}
+	return s
+}
+
+func storeWorkerTestDocument(t *testing.T, s *storage.StorageService, name string) *models.Document {
+	t.Helper()
+	ctx := context.Background()
+
+	kb, err := s.DefaultKnowledgeBase(ctx)
+	if err != nil {
+		t.Fatalf("DefaultKnowledgeBase failed: %v", err)
+	}
+
+	doc, err := s.StoreDocument(ctx, kb.ID, name, strings.NewReader("%PDF-1.4 content of "+name), nil)
+	if err != nil {
+		t.Fatalf("StoreDocument failed: %v", err)
+	}
+	return doc
+}
+
+// startWorkers starts a pool that is shut down when the test ends.
+func startWorkers(t *testing.T, s *storage.StorageService, processor DocumentProcessor) *WorkerPool {
+	t.Helper()
+
+	pool := NewWorkerPool(processor, s, 2, 10*time.Millisecond)
+	if err := pool.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(func() { pool.Shutdown(context.Background()) })
+	return pool
+}
+
+// waitForStatus polls until the document reaches status.
+func waitForStatus(t *testing.T, s *storage.StorageService, id int, status string) *models.Document {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		doc, err := s.GetDocument(context.Background(), id)
+		if err != nil {
+			t.Fatalf("GetDocument failed: %v", err)
+		}
+		if doc.Status == status {
+			return doc
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected document %d to be %q, still %q", id, status, doc.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func listJobs(t *testing.T, s *storage.StorageService, documentID int) []*models.Job {
+	t.Helper()
+
+	jobs, err := s.ListDocumentJobs(context.Background(), documentID)
+	if err != nil {
+		t.Fatalf("ListDocumentJobs failed: %v", err)
+	}
+	return jobs
+}
+
+func TestWorkerPoolProcessesDocuments(t *testing.T) {
+	s := newWorkerTestStorage(t, 3)
+	docs := []*models.Document{
+		storeWorkerTestDocument(t, s, "first.pdf"),
+		storeWorkerTestDocument(t, s, "second.pdf"),
+	}
+
+	var mu sync.Mutex
+	processed := map[int]int{}
+	startWorkers(t, s, fakeProcessor(func(ctx context.Context, doc *models.Document) error {
+		mu.Lock()
+		defer mu.Unlock()
+		processed[doc.ID]++
+		return nil
+	}))
+
+	for _, doc := range docs {
+		waitForStatus(t, s, doc.ID, models.DocumentStatusCompleted)
+
+		jobs := listJobs(t, s, doc.ID)
+		if len(jobs) != 1 || jobs[0].Status != models.JobStatusSucceeded || jobs[0].Attempts != 1 {
+			t.Errorf("expected one job succeeded on attempt 1, got %+v", jobs)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, doc := range docs {
+		if processed[doc.ID] != 1 {
+			t.Errorf("expected document %d to be processed once, got %d", doc.ID, processed[doc.ID])
+		}
+	}
+}
+
+func TestWorkerPoolRetriesTransientFailures(t *testing.T) {
+	s := newWorkerTestStorage(t, 3)
+	doc := storeWorkerTestDocument(t, s, "flaky.pdf")
+
+	var mu sync.Mutex
+	var attempts []time.Time
+	startWorkers(t, s, fakeProcessor(func(ctx context.Context, doc *models.Document) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, time.Now())
+		if len(attempts) < 3 {
+			return fmt.Errorf("embedding API error %d", len(attempts))
+		}
+		return nil
+	}))
+
+	waitForStatus(t, s, doc.ID, models.DocumentStatusCompleted)
+
+	jobs := listJobs(t, s, doc.ID)
+	if len(jobs) != 1 || jobs[0].Status != models.JobStatusSucceeded || jobs[0].Attempts != 3 {
+		t.Fatalf("expected one job succeeded on attempt 3, got %+v", jobs)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Backoff doubles: 10ms after the first failure, 20ms after the second.
+	for i, want := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond} {
+		if gap := attempts[i+1].Sub(attempts[i]); gap < want {
+			t.Errorf("expected attempt %d at least %v after the previous one, got %v", i+2, want, gap)
+		}
+	}
+}
+
+func TestWorkerPoolFailsDocuments(t *testing.T) {
+	tests := map[string]struct {
+		err          error
+		wantAttempts int
+	}{
+		"attempts exhausted": {
+			err:          errors.New("embedding API error"),
+			wantAttempts: 2,
+		},
+		"permanent error": {
+			err:          fmt.Errorf("failed to read PDF: %w", ErrEncryptedPDF),
+			wantAttempts: 1,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := newWorkerTestStorage(t, 2)
+			doc := storeWorkerTestDocument(t, s, "broken.pdf")
+
+			startWorkers(t, s, fakeProcessor(func(ctx context.Context, doc *models.Document) error {
+				return tt.err
+			}))
+
+			failed := waitForStatus(t, s, doc.ID, models.DocumentStatusFailed)
+			if failed.ErrorMessage != tt.err.Error() {
+				t.Errorf("expected error message %q, got %q", tt.err.Error(), failed.ErrorMessage)
+			}
+
+			jobs := listJobs(t, s, doc.ID)
+			if len(jobs) != 1 || jobs[0].Status != models.JobStatusFailed || jobs[0].Attempts != tt.wantAttempts {
+				t.Errorf("expected one job failed after %d attempts, got %+v", tt.wantAttempts, jobs)
+			}
+		})
+	}
+}
+
+func TestWorkerPoolShutdownWaitsForInFlightDocuments(t *testing.T) {
+	s := newWorkerTestStorage(t, 3)
+	doc := storeWorkerTestDocument(t, s, "slow.pdf")
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	pool := startWorkers(t, s, fakeProcessor(func(ctx context.Context, doc *models.Document) error {
+		close(started)
+		<-finish
+		return nil
+	}))
+
+	<-started
+	shutdown := make(chan error)
+	go func() { shutdown <- pool.Shutdown(context.Background()) }()
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("expected Shutdown to wait for the document, returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(finish)
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	waitForStatus(t, s, doc.ID, models.DocumentStatusCompleted)
+}
+
+func TestWorkerPoolShutdownTimeoutReleasesJobs(t *testing.T) {
+	s := newWorkerTestStorage(t, 3)
+	doc := storeWorkerTestDocument(t, s, "stuck.pdf")
+
+	started := make(chan struct{})
+	pool := startWorkers(t, s, fakeProcessor(func(ctx context.Context, doc *models.Document) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+
+	stored, _ := s.GetDocument(context.Background(), doc.ID)
+	if stored.Status != models.DocumentStatusPending {
+		t.Errorf("expected the document back to pending, got %q", stored.Status)
+	}
+
+	jobs := listJobs(t, s, doc.ID)
+	if len(jobs) != 1 || jobs[0].Status != models.JobStatusQueued || jobs[0].Attempts != 0 {
+		t.Errorf("expected the job queued again without using an attempt, got %+v", jobs)
+	}
+}
+
+func TestWorkerPoolReclaimsJobsOfPreviousRun(t *testing.T) {
+	ctx := context.Background()
+	s := newWorkerTestStorage(t, 3)
+	doc := storeWorkerTestDocument(t, s, "interrupted.pdf")
+
+	// The previous run claimed the job and was killed while its lease was
+	// still valid.
+	if _, _, err := s.ClaimJob(ctx, "previous-run", leaseDuration); err != nil {
+		t.Fatalf("ClaimJob failed: %v", err)
+	}
+	if err := s.DeleteDocument(ctx, doc.ID); !errors.Is(err, storage.ErrDocumentProcessing) {
+		t.Fatalf("expected ErrDocumentProcessing before restart, got %v", err)
+	}
+
+	startWorkers(t, s, fakeProcessor(func(ctx context.Context, doc *models.Document) error {
+		return nil
+	}))
+
+	waitForStatus(t, s, doc.ID, models.DocumentStatusCompleted)
+
+	jobs := listJobs(t, s, doc.ID)
+	if len(jobs) != 1 || jobs[0].Attempts != 2 {
+		t.Errorf("expected the job to be reclaimed on attempt 2, got %+v", jobs)
+	}
+	if err := s.DeleteDocument(ctx, doc.ID); err != nil {
+		t.Errorf("DeleteDocument failed: %v", err)
+	}
+}
@@ -0,0 +1,267 @@
+// Package knowledge opens knowledge bases: for each one it builds the
+// vector collection, embedder and chunker described by its settings.
+package knowledge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+
+	"rag-therapist/internal/chunking"
+	"rag-therapist/internal/config"
+	"rag-therapist/internal/embeddings"
+	"rag-therapist/internal/storage"
+	"rag-therapist/pkg/models"
+)
+
+// DefaultName is the name the default knowledge base is created with.
+const DefaultName = "default"
+
+// Base is an opened knowledge base: its settings and the services that
+// index and search its collection.
+type Base struct {
+	*models.KnowledgeBase
+	Vectors  *storage.VectorService
+	Embedder embeddings.Embedder
+	Chunker  chunking.Chunker
+}
+
+// EmbedderFactory builds the embedder for a knowledge base's embedding
+// settings.
+type EmbedderFactory func(kb *models.KnowledgeBase) (embeddings.Embedder, error)
+
+// Registry opens knowledge bases on first use and keeps them open. A base
+// whose settings were updated is rebuilt on its next use.
+type Registry struct {
+	cfg         *config.Config
+	vectors     storage.VectorStoreConfig
+	storage     *storage.StorageService
+	newEmbedder EmbedderFactory
+
+	mu    sync.Mutex
+	bases map[int]*Base
+}
+
+type Option func(*Registry)
+
+// WithEmbedderFactory replaces how embedders are built, e.g. with a fake
+// in tests.
+func WithEmbedderFactory(factory EmbedderFactory) Option {
+	return func(r *Registry) {
+		r.newEmbedder = factory
+	}
+}
+
+func NewRegistry(cfg *config.Config, storageService *storage.StorageService, opts ...Option) *Registry {
+	r := &Registry{
+		cfg: cfg,
+		vectors: storage.VectorStoreConfig{
+			Backend:   cfg.VectorStore,
+			Distance:  cfg.VectorDistance,
+			ChromaURL: cfg.ChromaURL,
+			Dir:       filepath.Join(cfg.DataDir, "vectors"),
+		},
+		storage: storageService,
+		bases:   make(map[int]*Base),
+	}
+	r.newEmbedder = func(kb *models.KnowledgeBase) (embeddings.Embedder, error) {
+		kbConfig := *cfg
+		kbConfig.EmbeddingModel = kb.EmbeddingModel
+		kbConfig.EmbeddingDimensions = kb.EmbeddingDimensions
+		return embeddings.NewEmbedder(&kbConfig)
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// NewKnowledgeBase returns a knowledge base named name with the embedding
+// and chunking settings from the configuration, to be adjusted and stored
+// by the caller.
+func (r *Registry) NewKnowledgeBase(name string) models.KnowledgeBase {
+	return models.KnowledgeBase{
+		Name:                name,
+		EmbeddingModel:      r.cfg.EmbeddingModel,
+		EmbeddingDimensions: r.cfg.EmbeddingDimensions,
+		ChunkStrategy:       r.cfg.ChunkStrategy,
+		ChunkSize:           r.cfg.ChunkSize,
+		ChunkOverlap:        r.cfg.ChunkOverlap,
+	}
+}
+
+// Validate checks the embedding and chunking settings of kb.
+func Validate(kb *models.KnowledgeBase) error {
+	if kb.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if kb.EmbeddingModel == "" {
+		return fmt.Errorf("embedding_model is required")
+	}
+	if kb.EmbeddingDimensions < 0 {
+		return fmt.Errorf("embedding_dimensions must not be negative")
+	}
+	if _, err := chunking.New(kb.ChunkStrategy, kb.ChunkSize, kb.ChunkOverlap); err != nil {
+		return err
+	}
+	return nil
+}
+
+// EnsureDefault creates the default knowledge base on first start, using
+// the configured settings and the collection used before knowledge bases
+// existed, and opens it. Once created, its stored settings win over the
+// configuration.
+func (r *Registry) EnsureDefault(ctx context.Context) (*Base, error) {
+	template := r.NewKnowledgeBase(DefaultName)
+	template.Description = "Documents uploaded without a knowledge base"
+	template.CollectionName = storage.DefaultCollectionName
+	if err := Validate(&template); err != nil {
+		return nil, fmt.Errorf("invalid embedding or chunking configuration: %w", err)
+	}
+
+	kb, err := r.storage.EnsureDefaultKnowledgeBase(ctx, template)
+	if err != nil {
+		return nil, err
+	}
+
+	if kb.EmbeddingModel != r.cfg.EmbeddingModel || kb.EmbeddingDimensions != r.cfg.EmbeddingDimensions {
+		slog.Warn("Default knowledge base keeps its embedding settings; EMBEDDING_MODEL and EMBEDDING_DIMENSIONS only apply to new knowledge bases",
+			"knowledge_base_id", kb.ID, "embedding_model", kb.EmbeddingModel, "embedding_dimensions", kb.EmbeddingDimensions)
+	}
+
+	return r.Get(ctx, kb.ID)
+}
+
+// Get returns the opened knowledge base with the given ID. Opening one is
+// done without holding the lock, so a slow vector store only delays the
+// calls that need that knowledge base opened.
+func (r *Registry) Get(ctx context.Context, id int) (*Base, error) {
+	kb, err := r.storage.GetKnowledgeBase(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	cached, ok := r.bases[id]
+	r.mu.Unlock()
+
+	if ok && cached.UpdatedAt.Equal(kb.UpdatedAt) {
+		return cached, nil
+	}
+
+	base := &Base{KnowledgeBase: kb}
+	if ok {
+		// The collection never changes, so the open store is kept.
+		base.Vectors = cached.Vectors
+	}
+
+	if base.Chunker, err = chunking.New(kb.ChunkStrategy, kb.ChunkSize, kb.ChunkOverlap); err != nil {
+		return nil, fmt.Errorf("invalid chunking settings for knowledge base %d: %w", id, err)
+	}
+	if base.Embedder, err = r.newEmbedder(kb); err != nil {
+		return nil, fmt.Errorf("failed to create embedder for knowledge base %d: %w", id, err)
+	}
+	opened := base.Vectors == nil
+	if opened {
+		store, err := storage.OpenVectorStore(ctx, r.vectors, kb.CollectionName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open collection %s: %w", kb.CollectionName, err)
+		}
+		keywords := r.storage.KeywordIndex().ForKnowledgeBase(id)
+		base.Vectors = storage.NewVectorService(store,
+			storage.WithKeywordIndex(keywords),
+			storage.WithVectorTimeout(r.cfg.VectorStoreTimeout))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Another call may have opened the knowledge base meanwhile. Its store
+	// is kept so there is only one, and so are its settings if newer.
+	if current, ok := r.bases[id]; ok {
+		if opened {
+			base.Vectors.Close()
+			base.Vectors = current.Vectors
+		}
+		if current.UpdatedAt.After(kb.UpdatedAt) {
+			return current, nil
+		}
+	}
+
+	r.bases[id] = base
+	return base, nil
+}
+
+// Default returns the opened default knowledge base.
+func (r *Registry) Default(ctx context.Context) (*Base, error) {
+	kb, err := r.storage.DefaultKnowledgeBase(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.Get(ctx, kb.ID)
+}
+
+// Resolve opens the knowledge bases with the given IDs, ignoring
+// duplicates. No IDs means the default knowledge base.
+func (r *Registry) Resolve(ctx context.Context, ids []int) ([]*Base, error) {
+	if len(ids) == 0 {
+		base, err := r.Default(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []*Base{base}, nil
+	}
+
+	var bases []*Base
+	seen := make(map[int]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		base, err := r.Get(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("knowledge base %d: %w", id, err)
+		}
+		bases = append(bases, base)
+	}
+	return bases, nil
+}
+
+// Drop deletes the vector collection of a knowledge base that has been
+// removed from the database.
+func (r *Registry) Drop(ctx context.Context, kb *models.KnowledgeBase) error {
+	r.mu.Lock()
+	base, ok := r.bases[kb.ID]
+	delete(r.bases, kb.ID)
+	r.mu.Unlock()
+
+	if ok {
+		return base.Vectors.Drop(ctx)
+	}
+
+	store, err := storage.OpenVectorStore(ctx, r.vectors, kb.CollectionName)
+	if err != nil {
+		return fmt.Errorf("failed to open collection %s: %w", kb.CollectionName, err)
+	}
+	return storage.NewVectorService(store, storage.WithVectorTimeout(r.cfg.VectorStoreTimeout)).Drop(ctx)
+}
+
+// Close closes the collections of all opened knowledge bases.
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+	for id, base := range r.bases {
+		if err := base.Vectors.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(r.bases, id)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,215 @@
+package knowledge
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rag-therapist/internal/config"
+	"rag-therapist/internal/embeddings"
+	"rag-therapist/internal/storage"
+	"rag-therapist/pkg/models"
+)
+
+// fakeEmbedder embeds every text as the same vector.
+type fakeEmbedder struct {
+	model string
+}
+
+func (e fakeEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i := range texts {
+		vectors[i] = []float32{1, 0}
+	}
+	return vectors, nil
+}
+
+func (e fakeEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	return []float32{1, 0}, nil
+}
+
+func (e fakeEmbedder) Dimensions() int   { return 2 }
+func (e fakeEmbedder) ModelName() string { return e.model }
+
+func newTestRegistry(t *testing.T) (*Registry, *storage.StorageService, *config.Config) {
+	t.Helper()
+
+	cfg := &config.Config{
+		EmbeddingModel: "fake-embedding",
+		ChunkStrategy:  "recursive",
+		ChunkSize:      500,
+		ChunkOverlap:   50,
+		VectorStore:    storage.VectorStoreEmbedded,
+		VectorDistance: string(storage.DistanceCosine),
+		DataDir:        t.TempDir(),
+	}
+
+	storageService, err := storage.NewStorageService(cfg.DataDir)
+	if err != nil {
+		t.Fatalf("NewStorageService failed: %v", err)
+	}
+	t.Cleanup(func() { storageService.Close() })
+
+	registry := NewRegistry(cfg, storageService, WithEmbedderFactory(func(kb *models.KnowledgeBase) (embeddings.Embedder, error) {
+		return fakeEmbedder{model: kb.EmbeddingModel}, nil
+	}))
+	t.Cleanup(func() { registry.Close() })
+
+	return registry, storageService, cfg
+}
+
+func TestEnsureDefaultUsesLegacyCollection(t *testing.T) {
+	ctx := context.Background()
+	registry, _, _ := newTestRegistry(t)
+
+	base, err := registry.EnsureDefault(ctx)
+	if err != nil {
+		t.Fatalf("EnsureDefault failed: %v", err)
+	}
+	if !base.IsDefault || base.CollectionName != storage.DefaultCollectionName || base.Embedder.ModelName() != "fake-embedding" {
+		t.Errorf("unexpected default knowledge base %+v", base.KnowledgeBase)
+	}
+
+	bases, err := registry.Resolve(ctx, nil)
+	if err != nil || len(bases) != 1 || bases[0] != base {
+		t.Errorf("expected no IDs to resolve to the default knowledge base, got %v, %v", bases, err)
+	}
+}
+
+func TestRegistryRebuildsUpdatedKnowledgeBase(t *testing.T) {
+	ctx := context.Background()
+	registry, storageService, _ := newTestRegistry(t)
+
+	kb := registry.NewKnowledgeBase("handouts")
+	kb.EmbeddingModel = "other-embedding"
+	if err := storageService.CreateKnowledgeBase(ctx, &kb); err != nil {
+		t.Fatalf("CreateKnowledgeBase failed: %v", err)
+	}
+
+	base, err := registry.Get(ctx, kb.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if again, _ := registry.Get(ctx, kb.ID); again != base {
+		t.Error("expected the opened knowledge base to be reused")
+	}
+	if base.Embedder.ModelName() != "other-embedding" {
+		t.Errorf("expected the knowledge base's embedding model, got %q", base.Embedder.ModelName())
+	}
+
+	kb.ChunkStrategy = "fixed"
+	if err := storageService.UpdateKnowledgeBase(ctx, &kb); err != nil {
+		t.Fatalf("UpdateKnowledgeBase failed: %v", err)
+	}
+
+	updated, err := registry.Get(ctx, kb.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if updated == base || updated.ChunkStrategy != "fixed" {
+		t.Errorf("expected a rebuilt knowledge base, got %+v", updated.KnowledgeBase)
+	}
+	if updated.Vectors != base.Vectors {
+		t.Error("expected the collection to stay open across updates")
+	}
+
+	if _, err := registry.Resolve(ctx, []int{kb.ID, 999}); !errors.Is(err, storage.ErrKnowledgeBaseNotFound) {
+		t.Errorf("expected ErrKnowledgeBaseNotFound, got %v", err)
+	}
+}
+
+func TestRegistryDropRemovesCollection(t *testing.T) {
+	ctx := context.Background()
+	registry, storageService, cfg := newTestRegistry(t)
+
+	kb := registry.NewKnowledgeBase("policies")
+	if err := storageService.CreateKnowledgeBase(ctx, &kb); err != nil {
+		t.Fatalf("CreateKnowledgeBase failed: %v", err)
+	}
+	if _, err := registry.Get(ctx, kb.ID); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	path := filepath.Join(cfg.DataDir, "vectors", kb.CollectionName+".jsonl")
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected collection file: %v", err)
+	}
+
+	if err := storageService.DeleteKnowledgeBase(ctx, kb.ID); err != nil {
+		t.Fatalf("DeleteKnowledgeBase failed: %v", err)
+	}
+	if err := registry.Drop(ctx, &kb); err != nil {
+		t.Fatalf("Drop failed: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected collection file to be removed, got %v", err)
+	}
+}
+
+func TestRegistryOpensWithoutBlockingOtherBases(t *testing.T) {
+	ctx := context.Background()
+	registry, storageService, _ := newTestRegistry(t)
+
+	defaultBase, err := registry.EnsureDefault(ctx)
+	if err != nil {
+		t.Fatalf("EnsureDefault failed: %v", err)
+	}
+
+	kb := registry.NewKnowledgeBase("slow")
+	if err := storageService.CreateKnowledgeBase(ctx, &kb); err != nil {
+		t.Fatalf("CreateKnowledgeBase failed: %v", err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	registry.newEmbedder = func(kb *models.KnowledgeBase) (embeddings.Embedder, error) {
+		close(started)
+		<-release
+		return fakeEmbedder{model: kb.EmbeddingModel}, nil
+	}
+
+	opened := make(chan error, 1)
+	go func() {
+		_, err := registry.Get(ctx, kb.ID)
+		opened <- err
+	}()
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		registry.Get(ctx, defaultBase.ID)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an opened knowledge base to be returned while another one is opening")
+	}
+
+	close(release)
+	if err := <-opened; err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := models.KnowledgeBase{Name: "kb", EmbeddingModel: "m", ChunkStrategy: "recursive", ChunkSize: 100, ChunkOverlap: 10}
+	if err := Validate(&valid); err != nil {
+		t.Errorf("expected valid settings, got %v", err)
+	}
+
+	invalid := valid
+	invalid.ChunkOverlap = 100
+	if err := Validate(&invalid); err == nil {
+		t.Error("expected an error for overlap >= size")
+	}
+
+	invalid = valid
+	invalid.Name = ""
+	if err := Validate(&invalid); err == nil {
+		t.Error("expected an error for a missing name")
+	}
+}
@@ -0,0 +1,249 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	claudeBaseURL    = "https://api.anthropic.com"
+	anthropicVersion = "2023-06-01"
+)
+
+// ClaudeClient talks to the Anthropic Messages API.
+type ClaudeClient struct {
+	apiKey string
+	model  string
+	config clientConfig
+}
+
+func NewClaudeClient(apiKey, model string, opts ...ClientOption) *ClaudeClient {
+	return &ClaudeClient{
+		apiKey: apiKey,
+		model:  model,
+		config: newClientConfig(claudeBaseURL, opts),
+	}
+}
+
+// claudeMessage content is a string, or a []claudeContentBlock for turns
+// with tool calls or results.
+type claudeMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+type claudeTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+type claudeRequest struct {
+	Model         string          `json:"model"`
+	MaxTokens     int             `json:"max_tokens"`
+	System        string          `json:"system,omitempty"`
+	Messages      []claudeMessage `json:"messages"`
+	Tools         []claudeTool    `json:"tools,omitempty"`
+	Temperature   float64         `json:"temperature,omitempty"`
+	StopSequences []string        `json:"stop_sequences,omitempty"`
+	Stream        bool            `json:"stream,omitempty"`
+}
+
+// claudeContentBlock is a "text", "tool_use" or "tool_result" block.
+type claudeContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+}
+
+type claudeUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type claudeResponse struct {
+	Content    []claudeContentBlock `json:"content"`
+	StopReason string               `json:"stop_reason"`
+	Usage      claudeUsage          `json:"usage"`
+}
+
+// Streaming events, see https://docs.anthropic.com/en/api/messages-streaming
+type claudeMessageStartEvent struct {
+	Message struct {
+		Usage claudeUsage `json:"usage"`
+	} `json:"message"`
+}
+
+type claudeContentBlockDeltaEvent struct {
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+}
+
+type claudeMessageDeltaEvent struct {
+	Delta struct {
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage claudeUsage `json:"usage"`
+}
+
+type claudeErrorResponse struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (c *ClaudeClient) Chat(ctx context.Context, systemPrompt string, messages []Message, opts Options) (*Response, error) {
+	req := c.buildRequest(systemPrompt, messages, opts)
+
+	var resp claudeResponse
+	if err := postJSON(ctx, c.config, c.config.baseURL+"/v1/messages", c.headers(), req, &resp, "claude", parseClaudeError); err != nil {
+		return nil, err
+	}
+
+	result := &Response{
+		StopReason: resp.StopReason,
+		Usage: Usage{
+			InputTokens:  resp.Usage.InputTokens,
+			OutputTokens: resp.Usage.OutputTokens,
+		},
+	}
+
+	var text strings.Builder
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			result.ToolCalls = append(result.ToolCalls, ToolCall{ID: block.ID, Name: block.Name, Arguments: block.Input})
+		}
+	}
+	result.Content = text.String()
+
+	return result, nil
+}
+
+func (c *ClaudeClient) ChatStream(ctx context.Context, systemPrompt string, messages []Message, opts Options, onDelta DeltaFunc) (*Response, error) {
+	req := c.buildRequest(systemPrompt, messages, opts)
+	req.Stream = true
+
+	httpResp, err := post(ctx, c.config.httpClient, c.config.baseURL+"/v1/messages", c.headers(), req, "claude", parseClaudeError)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	result := &Response{}
+	var text strings.Builder
+
+	err = readSSE(httpResp.Body, func(event, data string) error {
+		switch event {
+		case "message_start":
+			var ev claudeMessageStartEvent
+			if err := json.Unmarshal([]byte(data), &ev); err != nil {
+				return fmt.Errorf("failed to decode claude %s event: %w", event, err)
+			}
+			result.Usage.InputTokens = ev.Message.Usage.InputTokens
+		case "content_block_delta":
+			var ev claudeContentBlockDeltaEvent
+			if err := json.Unmarshal([]byte(data), &ev); err != nil {
+				return fmt.Errorf("failed to decode claude %s event: %w", event, err)
+			}
+			if ev.Delta.Type != "text_delta" || ev.Delta.Text == "" {
+				return nil
+			}
+			text.WriteString(ev.Delta.Text)
+			return onDelta(ev.Delta.Text)
+		case "message_delta":
+			var ev claudeMessageDeltaEvent
+			if err := json.Unmarshal([]byte(data), &ev); err != nil {
+				return fmt.Errorf("failed to decode claude %s event: %w", event, err)
+			}
+			result.StopReason = ev.Delta.StopReason
+			result.Usage.OutputTokens = ev.Usage.OutputTokens
+		case "error":
+			return fmt.Errorf("claude stream error: %s", parseClaudeError([]byte(data)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Content = text.String()
+	return result, nil
+}
+
+func (c *ClaudeClient) buildRequest(systemPrompt string, messages []Message, opts Options) claudeRequest {
+	req := claudeRequest{
+		Model:         c.model,
+		MaxTokens:     maxTokens(opts),
+		System:        systemPrompt,
+		Temperature:   opts.Temperature,
+		StopSequences: opts.StopSequences,
+	}
+	for _, tool := range opts.Tools {
+		req.Tools = append(req.Tools, claudeTool{Name: tool.Name, Description: tool.Description, InputSchema: tool.Parameters})
+	}
+	for _, m := range messages {
+		req.Messages = append(req.Messages, claudeMessage{Role: m.Role, Content: claudeContent(m)})
+	}
+	return req
+}
+
+// claudeContent returns the text of a plain message, or its blocks when
+// it carries tool calls or results. Claude requires tool_result blocks to
+// come before any text in their message.
+func claudeContent(m Message) interface{} {
+	if len(m.ToolCalls) == 0 && len(m.ToolResults) == 0 {
+		return m.Content
+	}
+
+	var blocks []claudeContentBlock
+	for _, result := range m.ToolResults {
+		blocks = append(blocks, claudeContentBlock{Type: "tool_result", ToolUseID: result.CallID, Content: result.Content, IsError: result.IsError})
+	}
+	if m.Content != "" {
+		blocks = append(blocks, claudeContentBlock{Type: "text", Text: m.Content})
+	}
+	for _, call := range m.ToolCalls {
+		input := call.Arguments
+		if len(input) == 0 {
+			input = json.RawMessage("{}")
+		}
+		blocks = append(blocks, claudeContentBlock{Type: "tool_use", ID: call.ID, Name: call.Name, Input: input})
+	}
+	return blocks
+}
+
+// Ping looks the configured model up in the Models API.
+func (c *ClaudeClient) Ping(ctx context.Context) error {
+	return get(ctx, c.config, c.config.baseURL+"/v1/models/"+url.PathEscape(c.model), c.headers(), "claude", parseClaudeError)
+}
+
+func (c *ClaudeClient) headers() map[string]string {
+	return map[string]string{
+		"x-api-key":         c.apiKey,
+		"anthropic-version": anthropicVersion,
+	}
+}
+
+func parseClaudeError(body []byte) string {
+	var errResp claudeErrorResponse
+	if err := json.Unmarshal(body, &errResp); err != nil {
+		return ""
+	}
+	return errResp.Error.Message
+}
@@ -0,0 +1,293 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClaudeClientChat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("x-api-key"); got != "test-key" {
+			t.Errorf("expected x-api-key test-key, got %q", got)
+		}
+		if got := r.Header.Get("anthropic-version"); got != anthropicVersion {
+			t.Errorf("expected anthropic-version %s, got %q", anthropicVersion, got)
+		}
+
+		var req claudeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if req.Model != "claude-test" || req.System != "be brief" || req.MaxTokens != 200 {
+			t.Errorf("unexpected request: %+v", req)
+		}
+		if len(req.Messages) != 3 || req.Messages[1].Role != RoleAssistant {
+			t.Errorf("expected history to be forwarded, got %+v", req.Messages)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"content": [{"type": "text", "text": "Hello"}, {"type": "text", "text": " there"}],
+			"stop_reason": "end_turn",
+			"usage": {"input_tokens": 12, "output_tokens": 3}
+		}`))
+	}))
+	defer server.Close()
+
+	client := NewClaudeClient("test-key", "claude-test", WithBaseURL(server.URL))
+
+	messages := []Message{
+		{Role: RoleUser, Content: "hi"},
+		{Role: RoleAssistant, Content: "hello"},
+		{Role: RoleUser, Content: "again"},
+	}
+	resp, err := client.Chat(context.Background(), "be brief", messages, Options{MaxTokens: 200})
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	if resp.Content != "Hello there" {
+		t.Errorf("expected content %q, got %q", "Hello there", resp.Content)
+	}
+	if resp.StopReason != "end_turn" {
+		t.Errorf("expected stop reason end_turn, got %q", resp.StopReason)
+	}
+	if resp.Usage.InputTokens != 12 || resp.Usage.OutputTokens != 3 {
+		t.Errorf("unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestClaudeClientAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"type": "error", "error": {"type": "authentication_error", "message": "invalid x-api-key"}}`))
+	}))
+	defer server.Close()
+
+	client := NewClaudeClient("bad-key", "claude-test", WithBaseURL(server.URL))
+
+	_, err := client.Chat(context.Background(), "", []Message{{Role: RoleUser, Content: "hi"}}, Options{})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusUnauthorized || apiErr.Message != "invalid x-api-key" {
+		t.Errorf("unexpected error: %+v", apiErr)
+	}
+}
+
+func TestClaudeClientChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req claudeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if !req.Stream {
+			t.Error("expected stream to be requested")
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: message_start\n" +
+			`data: {"type":"message_start","message":{"usage":{"input_tokens":25,"output_tokens":1}}}` + "\n\n" +
+			"event: content_block_start\n" +
+			`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}` + "\n\n" +
+			"event: ping\n" +
+			`data: {"type":"ping"}` + "\n\n" +
+			"event: content_block_delta\n" +
+			`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}` + "\n\n" +
+			"event: content_block_delta\n" +
+			`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" world"}}` + "\n\n" +
+			"event: message_delta\n" +
+			`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":4}}` + "\n\n" +
+			"event: message_stop\n" +
+			`data: {"type":"message_stop"}` + "\n\n"))
+	}))
+	defer server.Close()
+
+	client := NewClaudeClient("test-key", "claude-test", WithBaseURL(server.URL))
+
+	var deltas []string
+	resp, err := client.ChatStream(context.Background(), "", []Message{{Role: RoleUser, Content: "hi"}}, Options{}, func(text string) error {
+		deltas = append(deltas, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+
+	if len(deltas) != 2 || deltas[0] != "Hello" || deltas[1] != " world" {
+		t.Errorf("unexpected deltas: %q", deltas)
+	}
+	if resp.Content != "Hello world" || resp.StopReason != "end_turn" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if resp.Usage.InputTokens != 25 || resp.Usage.OutputTokens != 4 {
+		t.Errorf("unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestClaudeClientChatStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: error\n" +
+			`data: {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}` + "\n\n"))
+	}))
+	defer server.Close()
+
+	client := NewClaudeClient("test-key", "claude-test", WithBaseURL(server.URL))
+
+	_, err := client.ChatStream(context.Background(), "", []Message{{Role: RoleUser, Content: "hi"}}, Options{}, func(string) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "Overloaded") {
+		t.Fatalf("expected overloaded error, got %v", err)
+	}
+}
+
+func TestClaudeClientChatWithTools(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Tools    []claudeTool `json:"tools"`
+			Messages []struct {
+				Role    string          `json:"role"`
+				Content json.RawMessage `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if len(req.Tools) != 1 || req.Tools[0].Name != "search" || req.Tools[0].InputSchema["type"] != "object" {
+			t.Errorf("unexpected tools: %+v", req.Tools)
+		}
+		if len(req.Messages) != 3 {
+			t.Fatalf("expected 3 messages, got %d", len(req.Messages))
+		}
+
+		var call, result []claudeContentBlock
+		if err := json.Unmarshal(req.Messages[1].Content, &call); err != nil {
+			t.Fatalf("expected tool_use blocks: %v", err)
+		}
+		if err := json.Unmarshal(req.Messages[2].Content, &result); err != nil {
+			t.Fatalf("expected tool_result blocks: %v", err)
+		}
+		if len(call) != 1 || call[0].Type != "tool_use" || call[0].ID != "toolu_1" || string(call[0].Input) != `{"query":"sleep"}` {
+			t.Errorf("unexpected tool_use blocks: %+v", call)
+		}
+		if len(result) != 1 || result[0].Type != "tool_result" || result[0].ToolUseID != "toolu_1" || !result[0].IsError {
+			t.Errorf("unexpected tool_result blocks: %+v", result)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"content": [
+				{"type": "text", "text": "Let me search again."},
+				{"type": "tool_use", "id": "toolu_2", "name": "search", "input": {"query": "insomnia"}}
+			],
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 40, "output_tokens": 12}
+		}`))
+	}))
+	defer server.Close()
+
+	client := NewClaudeClient("test-key", "claude-test", WithBaseURL(server.URL))
+
+	tools := []Tool{{
+		Name:        "search",
+		Description: "Search the documents",
+		Parameters:  map[string]interface{}{"type": "object", "properties": map[string]interface{}{"query": map[string]interface{}{"type": "string"}}},
+	}}
+	messages := []Message{
+		{Role: RoleUser, Content: "How can I sleep better?"},
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "toolu_1", Name: "search", Arguments: json.RawMessage(`{"query":"sleep"}`)}}},
+		{Role: RoleUser, ToolResults: []ToolResult{{CallID: "toolu_1", Name: "search", Content: "index unavailable", IsError: true}}},
+	}
+	resp, err := client.Chat(context.Background(), "", messages, Options{Tools: tools})
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	if resp.Content != "Let me search again." || resp.StopReason != "tool_use" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].ID != "toolu_2" || string(resp.ToolCalls[0].Arguments) != `{"query": "insomnia"}` {
+		t.Errorf("unexpected tool calls: %+v", resp.ToolCalls)
+	}
+}
+
+func TestClaudeClientPing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/models/claude-test" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("x-api-key"); got != "test-key" {
+			t.Errorf("expected x-api-key test-key, got %q", got)
+		}
+		w.Write([]byte(`{"id": "claude-test", "type": "model"}`))
+	}))
+	defer server.Close()
+
+	client := NewClaudeClient("test-key", "claude-test", WithBaseURL(server.URL))
+	if err := client.Ping(context.Background()); err != nil {
+		t.Errorf("Ping failed: %v", err)
+	}
+}
+
+func TestClaudeClientTimeouts(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	pause := func(r *http.Request) {
+		select {
+		case <-time.After(3 * timeout):
+		case <-r.Context().Done():
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req claudeRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		switch {
+		case !req.Stream:
+			pause(r)
+			w.Write([]byte(`{"content":[{"type":"text","text":"late"}],"stop_reason":"end_turn"}`))
+		case req.System == "slow start":
+			pause(r)
+		default:
+			// A stream that outlasts the timeout once it has started.
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("event: content_block_delta\n" +
+				`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}` + "\n\n"))
+			w.(http.Flusher).Flush()
+			pause(r)
+			w.Write([]byte("event: content_block_delta\n" +
+				`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" world"}}` + "\n\n" +
+				"event: message_stop\n" +
+				`data: {"type":"message_stop"}` + "\n\n"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClaudeClient("test-key", "claude-test", WithBaseURL(server.URL), WithTimeout(timeout))
+	ctx := context.Background()
+	messages := []Message{{Role: RoleUser, Content: "hi"}}
+	ignore := func(string) error { return nil }
+
+	resp, err := client.ChatStream(ctx, "", messages, Options{}, ignore)
+	if err != nil || resp.Content != "Hello world" {
+		t.Errorf("expected a stream longer than the timeout to complete, got %+v, %v", resp, err)
+	}
+
+	if _, err := client.Chat(ctx, "", messages, Options{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a slow response to time out, got %v", err)
+	}
+	if _, err := client.ChatStream(ctx, "slow start", messages, Options{}, ignore); err == nil {
+		t.Error("expected a stream that never starts to time out")
+	}
+}
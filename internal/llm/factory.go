@@ -0,0 +1,33 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+
+	"rag-therapist/internal/config"
+)
+
+const (
+	ProviderClaude = "claude"
+	ProviderGemini = "gemini"
+)
+
+// NewClient returns the client selected by LLM_PROVIDER. It fails when the
+// provider is unknown or its API key is missing so misconfiguration is
+// caught at startup rather than on the first chat request.
+func NewClient(cfg *config.Config, opts ...ClientOption) (Client, error) {
+	switch strings.ToLower(cfg.LLMProvider) {
+	case ProviderClaude:
+		if cfg.ClaudeAPIKey == "" {
+			return nil, fmt.Errorf("CLAUDE_API_KEY is required when LLM_PROVIDER=%s", ProviderClaude)
+		}
+		return NewClaudeClient(cfg.ClaudeAPIKey, cfg.ClaudeModel, opts...), nil
+	case ProviderGemini:
+		if cfg.GeminiAPIKey == "" {
+			return nil, fmt.Errorf("GEMINI_API_KEY is required when LLM_PROVIDER=%s", ProviderGemini)
+		}
+		return NewGeminiClient(cfg.GeminiAPIKey, cfg.GeminiModel, opts...), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM_PROVIDER %q (expected %q or %q)", cfg.LLMProvider, ProviderClaude, ProviderGemini)
+	}
+}
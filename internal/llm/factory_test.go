@@ -0,0 +1,69 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+
+	"rag-therapist/internal/config"
+)
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		want    interface{}
+		wantErr string
+	}{
+		{
+			name: "claude",
+			cfg:  config.Config{LLMProvider: "claude", ClaudeAPIKey: "key"},
+			want: &ClaudeClient{},
+		},
+		{
+			name: "gemini is case insensitive",
+			cfg:  config.Config{LLMProvider: "Gemini", GeminiAPIKey: "key"},
+			want: &GeminiClient{},
+		},
+		{
+			name:    "claude without key",
+			cfg:     config.Config{LLMProvider: "claude", GeminiAPIKey: "key"},
+			wantErr: "CLAUDE_API_KEY is required",
+		},
+		{
+			name:    "gemini without key",
+			cfg:     config.Config{LLMProvider: "gemini", ClaudeAPIKey: "key"},
+			wantErr: "GEMINI_API_KEY is required",
+		},
+		{
+			name:    "unknown provider",
+			cfg:     config.Config{LLMProvider: "gpt"},
+			wantErr: "unknown LLM_PROVIDER",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(&tt.cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			switch tt.want.(type) {
+			case *ClaudeClient:
+				if _, ok := client.(*ClaudeClient); !ok {
+					t.Errorf("expected *ClaudeClient, got %T", client)
+				}
+			case *GeminiClient:
+				if _, ok := client.(*GeminiClient); !ok {
+					t.Errorf("expected *GeminiClient, got %T", client)
+				}
+			}
+		})
+	}
+}
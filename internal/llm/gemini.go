@@ -0,0 +1,271 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const geminiBaseURL = "https://generativelanguage.googleapis.com"
+
+// GeminiClient talks to the Gemini generateContent API.
+type GeminiClient struct {
+	apiKey string
+	model  string
+	config clientConfig
+}
+
+func NewGeminiClient(apiKey, model string, opts ...ClientOption) *GeminiClient {
+	return &GeminiClient{
+		apiKey: apiKey,
+		model:  model,
+		config: newClientConfig(geminiBaseURL, opts),
+	}
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+	ThoughtSignature string                  `json:"thoughtSignature,omitempty"`
+}
+
+type geminiFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// geminiFunctionResponse.Response must be a JSON object, so results are
+// wrapped as {"content": ...} or {"error": ...}.
+type geminiFunctionResponse struct {
+	Name     string            `json:"name"`
+	Response map[string]string `json:"response"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiGenerationConfig struct {
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	Temperature     float64  `json:"temperature,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+}
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent         `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent        `json:"contents"`
+	Tools             []geminiTool           `json:"tools,omitempty"`
+	GenerationConfig  geminiGenerationConfig `json:"generationConfig"`
+}
+
+type geminiUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+}
+
+type geminiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata geminiUsageMetadata `json:"usageMetadata"`
+	Error         *geminiError        `json:"error,omitempty"`
+}
+
+type geminiErrorResponse struct {
+	Error geminiError `json:"error"`
+}
+
+func (c *GeminiClient) Chat(ctx context.Context, systemPrompt string, messages []Message, opts Options) (*Response, error) {
+	req := c.buildRequest(systemPrompt, messages, opts)
+
+	var resp geminiResponse
+	if err := postJSON(ctx, c.config, c.endpoint("generateContent"), c.headers(), req, &resp, "gemini", parseGeminiError); err != nil {
+		return nil, err
+	}
+
+	result := &Response{}
+	result.Content = resp.apply(result)
+
+	return result, nil
+}
+
+func (c *GeminiClient) ChatStream(ctx context.Context, systemPrompt string, messages []Message, opts Options, onDelta DeltaFunc) (*Response, error) {
+	req := c.buildRequest(systemPrompt, messages, opts)
+
+	httpResp, err := post(ctx, c.config.httpClient, c.endpoint("streamGenerateContent")+"?alt=sse", c.headers(), req, "gemini", parseGeminiError)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	result := &Response{}
+	var text strings.Builder
+
+	// Every event is a partial GenerateContentResponse; usage metadata is
+	// cumulative so the last event carries the totals.
+	err = readSSE(httpResp.Body, func(event, data string) error {
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to decode gemini stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("gemini stream error: %s", chunk.Error.Message)
+		}
+
+		delta := chunk.apply(result)
+		if delta == "" {
+			return nil
+		}
+		text.WriteString(delta)
+		return onDelta(delta)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Content = text.String()
+	return result, nil
+}
+
+func (c *GeminiClient) buildRequest(systemPrompt string, messages []Message, opts Options) geminiRequest {
+	req := geminiRequest{
+		GenerationConfig: geminiGenerationConfig{
+			MaxOutputTokens: maxTokens(opts),
+			Temperature:     opts.Temperature,
+			StopSequences:   opts.StopSequences,
+		},
+	}
+	if systemPrompt != "" {
+		req.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: systemPrompt}}}
+	}
+	if len(opts.Tools) > 0 {
+		var tool geminiTool
+		for _, t := range opts.Tools {
+			tool.FunctionDeclarations = append(tool.FunctionDeclarations, geminiFunctionDeclaration{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			})
+		}
+		req.Tools = []geminiTool{tool}
+	}
+	for _, m := range messages {
+		req.Contents = append(req.Contents, geminiContent{
+			Role:  geminiRole(m.Role),
+			Parts: geminiParts(m),
+		})
+	}
+	return req
+}
+
+// geminiParts converts a message's tool results, text and tool calls.
+// Gemini matches results to calls by function name; results come first,
+// as they answer the previous turn.
+func geminiParts(m Message) []geminiPart {
+	if len(m.ToolCalls) == 0 && len(m.ToolResults) == 0 {
+		return []geminiPart{{Text: m.Content}}
+	}
+
+	var parts []geminiPart
+	for _, result := range m.ToolResults {
+		response := map[string]string{"content": result.Content}
+		if result.IsError {
+			response = map[string]string{"error": result.Content}
+		}
+		parts = append(parts, geminiPart{FunctionResponse: &geminiFunctionResponse{Name: result.Name, Response: response}})
+	}
+	if m.Content != "" {
+		parts = append(parts, geminiPart{Text: m.Content})
+	}
+	for _, call := range m.ToolCalls {
+		parts = append(parts, geminiPart{
+			FunctionCall:     &geminiFunctionCall{Name: call.Name, Args: call.Arguments},
+			ThoughtSignature: call.signature,
+		})
+	}
+	return parts
+}
+
+// Ping looks the configured model up in the models API.
+func (c *GeminiClient) Ping(ctx context.Context) error {
+	return get(ctx, c.config, c.config.baseURL+"/v1beta/models/"+url.PathEscape(c.model), c.headers(), "gemini", parseGeminiError)
+}
+
+func (c *GeminiClient) headers() map[string]string {
+	return map[string]string{"x-goog-api-key": c.apiKey}
+}
+
+// apply copies usage, finish reason and function calls into result and
+// returns the text of the first candidate. Gemini calls have no IDs, so
+// they are numbered in order.
+func (r *geminiResponse) apply(result *Response) string {
+	if r.UsageMetadata.PromptTokenCount > 0 || r.UsageMetadata.CandidatesTokenCount > 0 {
+		result.Usage = Usage{
+			InputTokens:  r.UsageMetadata.PromptTokenCount,
+			OutputTokens: r.UsageMetadata.CandidatesTokenCount,
+		}
+	}
+	if len(r.Candidates) == 0 {
+		return ""
+	}
+
+	candidate := r.Candidates[0]
+	if candidate.FinishReason != "" {
+		result.StopReason = candidate.FinishReason
+	}
+
+	var text strings.Builder
+	for _, part := range candidate.Content.Parts {
+		text.WriteString(part.Text)
+		if part.FunctionCall != nil {
+			result.ToolCalls = append(result.ToolCalls, ToolCall{
+				ID:        fmt.Sprintf("call_%d", len(result.ToolCalls)+1),
+				Name:      part.FunctionCall.Name,
+				Arguments: part.FunctionCall.Args,
+				signature: part.ThoughtSignature,
+			})
+		}
+	}
+	return text.String()
+}
+
+func (c *GeminiClient) endpoint(method string) string {
+	return c.config.baseURL + "/v1beta/models/" + url.PathEscape(c.model) + ":" + method
+}
+
+// Gemini calls the assistant role "model".
+func geminiRole(role string) string {
+	if role == RoleAssistant {
+		return "model"
+	}
+	return "user"
+}
+
+func parseGeminiError(body []byte) string {
+	var errResp geminiErrorResponse
+	if err := json.Unmarshal(body, &errResp); err != nil {
+		return ""
+	}
+	return errResp.Error.Message
+}
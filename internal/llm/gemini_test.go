@@ -0,0 +1,224 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGeminiClientChat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models/gemini-test:generateContent" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("x-goog-api-key"); got != "test-key" {
+			t.Errorf("expected x-goog-api-key test-key, got %q", got)
+		}
+
+		var req geminiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if req.SystemInstruction == nil || req.SystemInstruction.Parts[0].Text != "be brief" {
+			t.Errorf("expected system instruction, got %+v", req.SystemInstruction)
+		}
+		if len(req.Contents) != 2 || req.Contents[1].Role != "model" {
+			t.Errorf("expected assistant turn mapped to model, got %+v", req.Contents)
+		}
+		if req.GenerationConfig.MaxOutputTokens != DefaultMaxTokens {
+			t.Errorf("expected default max tokens, got %d", req.GenerationConfig.MaxOutputTokens)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"candidates": [{"content": {"role": "model", "parts": [{"text": "Hi "}, {"text": "there"}]}, "finishReason": "STOP"}],
+			"usageMetadata": {"promptTokenCount": 9, "candidatesTokenCount": 2}
+		}`))
+	}))
+	defer server.Close()
+
+	client := NewGeminiClient("test-key", "gemini-test", WithBaseURL(server.URL))
+
+	messages := []Message{
+		{Role: RoleUser, Content: "hi"},
+		{Role: RoleAssistant, Content: "hello"},
+	}
+	resp, err := client.Chat(context.Background(), "be brief", messages, Options{})
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	if resp.Content != "Hi there" {
+		t.Errorf("expected content %q, got %q", "Hi there", resp.Content)
+	}
+	if resp.StopReason != "STOP" {
+		t.Errorf("expected stop reason STOP, got %q", resp.StopReason)
+	}
+	if resp.Usage.InputTokens != 9 || resp.Usage.OutputTokens != 2 {
+		t.Errorf("unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestGeminiClientAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": {"code": 400, "message": "API key not valid", "status": "INVALID_ARGUMENT"}}`))
+	}))
+	defer server.Close()
+
+	client := NewGeminiClient("bad-key", "gemini-test", WithBaseURL(server.URL))
+
+	_, err := client.Chat(context.Background(), "", []Message{{Role: RoleUser, Content: "hi"}}, Options{})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || apiErr.Message != "API key not valid" {
+		t.Errorf("unexpected error: %+v", apiErr)
+	}
+}
+
+func TestGeminiClientChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models/gemini-test:streamGenerateContent" || r.URL.Query().Get("alt") != "sse" {
+			t.Errorf("unexpected URL %s", r.URL)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(
+			`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Hello"}]}}],"usageMetadata":{"promptTokenCount":7,"candidatesTokenCount":1}}` + "\r\n\r\n" +
+				`data: {"candidates":[{"content":{"role":"model","parts":[{"text":" world"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":7,"candidatesTokenCount":3}}` + "\r\n\r\n"))
+	}))
+	defer server.Close()
+
+	client := NewGeminiClient("test-key", "gemini-test", WithBaseURL(server.URL))
+
+	var deltas []string
+	resp, err := client.ChatStream(context.Background(), "", []Message{{Role: RoleUser, Content: "hi"}}, Options{}, func(text string) error {
+		deltas = append(deltas, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+
+	if len(deltas) != 2 || deltas[0] != "Hello" || deltas[1] != " world" {
+		t.Errorf("unexpected deltas: %q", deltas)
+	}
+	if resp.Content != "Hello world" || resp.StopReason != "STOP" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if resp.Usage.InputTokens != 7 || resp.Usage.OutputTokens != 3 {
+		t.Errorf("unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestGeminiClientChatStreamAbortedByCallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(
+			`data: {"candidates":[{"content":{"parts":[{"text":"one"}]}}]}` + "\n\n" +
+				`data: {"candidates":[{"content":{"parts":[{"text":"two"}]}}]}` + "\n\n"))
+	}))
+	defer server.Close()
+
+	client := NewGeminiClient("test-key", "gemini-test", WithBaseURL(server.URL))
+
+	stop := errors.New("client went away")
+	calls := 0
+	_, err := client.ChatStream(context.Background(), "", []Message{{Role: RoleUser, Content: "hi"}}, Options{}, func(string) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("expected callback error, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected stream to stop after first delta, got %d calls", calls)
+	}
+}
+
+func TestGeminiClientChatWithTools(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req geminiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if len(req.Tools) != 1 || len(req.Tools[0].FunctionDeclarations) != 1 || req.Tools[0].FunctionDeclarations[0].Name != "search" {
+			t.Errorf("unexpected tools: %+v", req.Tools)
+		}
+		if len(req.Contents) != 3 {
+			t.Fatalf("expected 3 contents, got %d", len(req.Contents))
+		}
+
+		call := req.Contents[1]
+		if call.Role != "model" || call.Parts[0].FunctionCall == nil || call.Parts[0].FunctionCall.Name != "search" || call.Parts[0].ThoughtSignature != "sig" {
+			t.Errorf("unexpected function call turn: %+v", call)
+		}
+		result := req.Contents[2]
+		if result.Role != "user" || result.Parts[0].FunctionResponse == nil || result.Parts[0].FunctionResponse.Response["content"] != "3 results" ||
+			len(result.Parts) != 2 || result.Parts[1].Text != "Answer now." {
+			t.Errorf("expected the function response followed by the text, got %+v", result)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"candidates": [{"content": {"role": "model", "parts": [
+				{"functionCall": {"name": "search", "args": {"query": "insomnia"}}},
+				{"functionCall": {"name": "list", "args": {}}}
+			]}, "finishReason": "STOP"}],
+			"usageMetadata": {"promptTokenCount": 30, "candidatesTokenCount": 8}
+		}`))
+	}))
+	defer server.Close()
+
+	client := NewGeminiClient("test-key", "gemini-test", WithBaseURL(server.URL))
+
+	// The first call comes from a response so its thought signature is kept.
+	var previous geminiResponse
+	if err := json.Unmarshal([]byte(`{"candidates": [{"content": {"role": "model", "parts": [
+		{"functionCall": {"name": "search", "args": {"query": "sleep"}}, "thoughtSignature": "sig"}
+	]}}]}`), &previous); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	first := &Response{}
+	previous.apply(first)
+
+	messages := []Message{
+		{Role: RoleUser, Content: "How can I sleep better?"},
+		{Role: RoleAssistant, ToolCalls: first.ToolCalls},
+		{Role: RoleUser, Content: "Answer now.", ToolResults: []ToolResult{{CallID: first.ToolCalls[0].ID, Name: "search", Content: "3 results"}}},
+	}
+	tools := []Tool{{Name: "search", Parameters: map[string]interface{}{"type": "object"}}}
+
+	resp, err := client.Chat(context.Background(), "", messages, Options{Tools: tools})
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	if len(resp.ToolCalls) != 2 || resp.ToolCalls[0].ID != "call_1" || resp.ToolCalls[1].ID != "call_2" || resp.ToolCalls[1].Name != "list" {
+		t.Errorf("expected two numbered tool calls, got %+v", resp.ToolCalls)
+	}
+}
+
+func TestGeminiClientPingError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1beta/models/gemini-test" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": {"code": 404, "message": "model not found", "status": "NOT_FOUND"}}`))
+	}))
+	defer server.Close()
+
+	client := NewGeminiClient("test-key", "gemini-test", WithBaseURL(server.URL))
+
+	var apiErr *APIError
+	if err := client.Ping(context.Background()); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a not found APIError, got %v", err)
+	}
+}
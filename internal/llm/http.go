@@ -0,0 +1,210 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultTimeout bounds a whole non-streaming request, and how long a
+// streaming one waits for the response to start. A stream itself runs for
+// as long as the caller's context allows, since a long answer can take
+// minutes to generate.
+const defaultTimeout = 120 * time.Second
+
+const (
+	// Error bodies are read only this far when building an APIError.
+	maxErrorBodySize = 64 << 10
+	maxSSELineSize   = 1 << 20
+)
+
+type clientConfig struct {
+	baseURL    string
+	timeout    time.Duration
+	httpClient *http.Client
+}
+
+type ClientOption func(*clientConfig)
+
+// WithBaseURL points a client at a different API host, e.g. a proxy or a
+// test server.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(c *clientConfig) {
+		c.baseURL = baseURL
+	}
+}
+
+// WithTimeout replaces defaultTimeout.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.timeout = timeout
+	}
+}
+
+// WithHTTPClient sends requests with httpClient. A Timeout set on it also
+// cuts off streams.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *clientConfig) {
+		c.httpClient = httpClient
+	}
+}
+
+func newClientConfig(defaultBaseURL string, opts []ClientOption) clientConfig {
+	cfg := clientConfig{
+		baseURL: defaultBaseURL,
+		timeout: defaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	// No client Timeout: it would also cover reading a stream's body.
+	if cfg.httpClient == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.ResponseHeaderTimeout = cfg.timeout
+		cfg.httpClient = &http.Client{Transport: transport}
+	}
+	return cfg
+}
+
+func maxTokens(opts Options) int {
+	if opts.MaxTokens > 0 {
+		return opts.MaxTokens
+	}
+	return DefaultMaxTokens
+}
+
+// postJSON sends body as JSON and decodes a 2xx response into out, all
+// within the configured timeout.
+func postJSON(ctx context.Context, cfg clientConfig, url string, headers map[string]string, body, out interface{}, provider string, parseError func([]byte) string) error {
+	ctx, cancel := withTimeout(ctx, cfg.timeout)
+	defer cancel()
+
+	resp, err := post(ctx, cfg.httpClient, url, headers, body, provider, parseError)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", provider, err)
+	}
+
+	return nil
+}
+
+// post sends body as JSON and returns the response for a 2xx status; the
+// caller must close its body. Only ctx bounds reading it, so streams use
+// post directly. For any other status the body is handed to
+// parseError to extract the provider's error message.
+func post(ctx context.Context, httpClient *http.Client, url string, headers map[string]string, body interface{}, provider string, parseError func([]byte) string) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return do(httpClient, req, headers, provider, parseError)
+}
+
+// get sends a GET request within the configured timeout and discards the
+// body of a 2xx response.
+func get(ctx context.Context, cfg clientConfig, url string, headers map[string]string, provider string, parseError func([]byte) string) error {
+	ctx, cancel := withTimeout(ctx, cfg.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := do(cfg.httpClient, req, headers, provider, parseError)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// withTimeout bounds ctx by timeout; zero or less leaves it unbounded.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// do sends req with headers and turns a non-2xx status into an APIError.
+func do(httpClient *http.Client, req *http.Request, headers map[string]string, provider string, parseError func([]byte) string) (*http.Response, error) {
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s API: %w", provider, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		message := parseError(raw)
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		return nil, &APIError{Provider: provider, StatusCode: resp.StatusCode, Message: message}
+	}
+
+	return resp, nil
+}
+
+// readSSE calls fn for every event in a text/event-stream body. Multi-line
+// data fields are joined with newlines as the SSE spec requires.
+func readSSE(r io.Reader, fn func(event, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxSSELineSize)
+
+	var event string
+	var data []string
+	dispatch := func() error {
+		if len(data) == 0 {
+			event = ""
+			return nil
+		}
+		err := fn(event, strings.Join(data, "\n"))
+		event, data = "", nil
+		return err
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if err := dispatch(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, ":"):
+			// comment / keep-alive
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read event stream: %w", err)
+	}
+
+	return dispatch()
+}
@@ -0,0 +1,108 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// ToolCalls are the tools an assistant message asked to run.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolResults answer the ToolCalls of the previous assistant message.
+	// They are sent in a user message.
+	ToolResults []ToolResult `json:"tool_results,omitempty"`
+}
+
+// Tool is a function the model may call instead of answering. Parameters
+// is a JSON Schema object describing the arguments.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{}
+}
+
+// ToolCall is the model's request to run a tool. Arguments is a JSON
+// object matching the tool's Parameters.
+type ToolCall struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+
+	// signature is Gemini's thought signature, which has to be sent back
+	// with the call.
+	signature string
+}
+
+// ToolResult is the output of a ToolCall. IsError tells the model the call
+// failed and Content holds the reason.
+type ToolResult struct {
+	CallID  string `json:"call_id"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	IsError bool   `json:"is_error,omitempty"`
+}
+
+const DefaultMaxTokens = 1024
+
+// Options control generation. Zero values fall back to the provider
+// defaults, except MaxTokens which falls back to DefaultMaxTokens.
+type Options struct {
+	MaxTokens     int
+	Temperature   float64
+	StopSequences []string
+	// Tools the model may call. Calls are returned in Response.ToolCalls;
+	// only Chat supports tools.
+	Tools []Tool
+}
+
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type Response struct {
+	Content    string `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      Usage  `json:"usage"`
+	// ToolCalls is set when the model wants tools run before it answers.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+// DeltaFunc receives each chunk of generated text as it arrives. Returning
+// an error aborts the stream.
+type DeltaFunc func(text string) error
+
+// Client is the thin interface every LLM provider implements so the
+// provider can be swapped with LLM_PROVIDER.
+type Client interface {
+	Chat(ctx context.Context, systemPrompt string, messages []Message, opts Options) (*Response, error)
+	// ChatStream behaves like Chat but calls onDelta for each text chunk
+	// while the answer is generated. The returned Response holds the full
+	// text and usage totals. Cancelling ctx aborts the upstream request.
+	ChatStream(ctx context.Context, systemPrompt string, messages []Message, opts Options, onDelta DeltaFunc) (*Response, error)
+}
+
+// Pinger is implemented by clients that can check that the provider is
+// reachable and accepts the credentials, without generating anything.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// APIError is returned when a provider answers with a non-2xx status.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API error (status %d): %s", e.Provider, e.StatusCode, e.Message)
+}
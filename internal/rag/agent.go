@@ -0,0 +1,179 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+
+	"rag-therapist/internal/llm"
+	"rag-therapist/pkg/models"
+)
+
+const (
+	DefaultAgentMaxSteps  = 5
+	DefaultAgentMaxTokens = 50000
+)
+
+const agentSystemPrompt = `You are a helpful assistant that answers questions using the user's uploaded documents.
+Use the tools to find relevant excerpts before answering: search_documents finds excerpts, get_document_chunk reads the text around an excerpt and list_documents shows which documents exist.
+If the results do not answer the question, search again with other words or read the surrounding chunks.
+Base your answer on the excerpts you found. If they do not contain the answer, say so instead of guessing.
+The excerpts are numbered across all searches. ` + citationInstructions
+
+// budgetNote is sent with the last tool results once the budget is spent.
+const budgetNote = "The search budget is used up. Answer now with the excerpts found so far."
+
+// noAnswer is returned when the model spends its last step on tool calls.
+const noAnswer = "I could not find an answer in the documents within the search budget."
+
+// DocumentStore looks up documents for the agent's tools. It is
+// implemented by *storage.StorageService.
+type DocumentStore interface {
+	GetDocument(ctx context.Context, id int) (*models.Document, error)
+	ListDocuments(ctx context.Context, knowledgeBaseID, limit, offset int) ([]*models.Document, error)
+}
+
+// AgentBudget bounds an agent run. A step is one LLM call; tokens count
+// input and output across all steps. The step that reaches either limit
+// has to answer.
+type AgentBudget struct {
+	MaxSteps  int
+	MaxTokens int
+}
+
+var DefaultAgentBudget = AgentBudget{MaxSteps: DefaultAgentMaxSteps, MaxTokens: DefaultAgentMaxTokens}
+
+func (b AgentBudget) Validate() error {
+	if b.MaxSteps < 1 {
+		return fmt.Errorf("agent max steps must be at least 1")
+	}
+	if b.MaxTokens < 1 {
+		return fmt.Errorf("agent max tokens must be at least 1")
+	}
+	return nil
+}
+
+// TraceEntry records one tool call made by the agent and its result.
+type TraceEntry struct {
+	Step      int    `json:"step"`
+	Tool      string `json:"tool"`
+	Arguments string `json:"arguments"`
+	Result    string `json:"result"`
+	IsError   bool   `json:"is_error,omitempty"`
+}
+
+// Agent answers by letting the LLM search the knowledge bases with tools,
+// as often as its budget allows, instead of retrieving once up front.
+type Agent struct {
+	pipeline  *Pipeline
+	documents DocumentStore
+	budget    AgentBudget
+}
+
+type AgentOption func(*Agent)
+
+func WithAgentBudget(budget AgentBudget) AgentOption {
+	return func(a *Agent) {
+		a.budget = budget
+	}
+}
+
+// NewAgent returns an agent that searches with the pipeline's knowledge
+// bases, hybrid weights and LLM.
+func NewAgent(pipeline *Pipeline, documents DocumentStore, opts ...AgentOption) *Agent {
+	a := &Agent{
+		pipeline:  pipeline,
+		documents: documents,
+		budget:    DefaultAgentBudget,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Answer runs the tool loop for question. opts scope the tools like a
+// regular query: they search the given knowledge bases with the given
+// weights, lambda and filter. The history is sent as is; the model writes
+// its own search queries, so follow-ups are not rewritten. Sources are the
+// excerpts found by search_documents, numbered for citations in the order
+// they were found, and Trace lists every tool call.
+func (a *Agent) Answer(ctx context.Context, question string, opts QueryOptions) (*Answer, error) {
+	bases, err := a.pipeline.bases.Resolve(ctx, opts.KnowledgeBaseIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	tools := &agentTools{
+		pipeline:  a.pipeline,
+		documents: a.documents,
+		bases:     bases,
+		weights:   a.pipeline.hybridWeights(opts),
+		lambda:    a.pipeline.mmrLambda(opts),
+		filter:    opts.Filter,
+		numbers:   make(map[string]int),
+	}
+	answer := &Answer{Question: question}
+
+	messages := make([]llm.Message, 0, len(opts.History)+1)
+	messages = append(messages, opts.History...)
+	messages = append(messages, llm.Message{Role: llm.RoleUser, Content: question})
+
+	for step := 1; ; step++ {
+		final := step >= a.budget.MaxSteps || answer.Usage.InputTokens+answer.Usage.OutputTokens >= a.budget.MaxTokens
+		if final && step > 1 {
+			messages[len(messages)-1].Content = budgetNote
+		}
+
+		// Tools stay declared on the last step because providers reject
+		// tool calls in the history without them.
+		resp, err := a.pipeline.llm.Chat(ctx, agentSystemPrompt, messages, llm.Options{
+			MaxTokens: llm.DefaultMaxTokens,
+			Tools:     agentToolDefinitions,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate answer: %w", err)
+		}
+		answer.Usage = addUsage(answer.Usage, resp.Usage)
+
+		if len(resp.ToolCalls) == 0 || final {
+			answer.Response = resp.Content
+			if len(resp.ToolCalls) > 0 && answer.Response == "" {
+				answer.Response = noAnswer
+			}
+			for _, source := range tools.sources {
+				answer.Sources = append(answer.Sources, source.SearchResult)
+				answer.passages = append(answer.passages, hitPassage(source))
+			}
+			citeAnswer(ctx, answer, answer.passages, a.documents)
+			return answer, nil
+		}
+
+		messages = append(messages, llm.Message{Role: llm.RoleAssistant, Content: resp.Content, ToolCalls: resp.ToolCalls})
+
+		results := make([]llm.ToolResult, 0, len(resp.ToolCalls))
+		for _, call := range resp.ToolCalls {
+			result := llm.ToolResult{CallID: call.ID, Name: call.Name}
+
+			content, err := tools.call(ctx, call)
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			if err != nil {
+				result.Content = err.Error()
+				result.IsError = true
+			} else {
+				result.Content = content
+			}
+
+			results = append(results, result)
+			answer.Trace = append(answer.Trace, TraceEntry{
+				Step:      step,
+				Tool:      call.Name,
+				Arguments: string(call.Arguments),
+				Result:    result.Content,
+				IsError:   result.IsError,
+			})
+		}
+		messages = append(messages, llm.Message{Role: llm.RoleUser, ToolResults: results})
+	}
+}
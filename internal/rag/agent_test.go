@@ -0,0 +1,145 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"rag-therapist/internal/llm"
+)
+
+func TestAgentCallsToolsUntilItAnswers(t *testing.T) {
+	client := &fakeLLM{script: []llm.Response{
+		{ToolCalls: []llm.ToolCall{
+			toolCall("a", ToolSearchDocuments, `{"query": "grounding anxiety", "limit": 1}`),
+			toolCall("b", ToolListDocuments, `{}`),
+		}},
+		{Content: "Let me read around it.", ToolCalls: []llm.ToolCall{
+			toolCall("c", ToolGetDocumentChunk, `{"document_id": 1, "chunk_index": 1}`),
+			toolCall("d", ToolGetDocumentChunk, `{"document_id": 99, "chunk_index": 0}`),
+		}},
+		reply("Grounding exercises help with anxiety."),
+	}}
+	pipeline, storageService := newTestPipeline(t, client)
+	agent := NewAgent(pipeline, storageService)
+
+	answer, err := agent.Answer(context.Background(), "What helps with anxiety?", QueryOptions{})
+	if err != nil {
+		t.Fatalf("Answer failed: %v", err)
+	}
+
+	if answer.Response != "Grounding exercises help with anxiety." {
+		t.Errorf("unexpected response %q", answer.Response)
+	}
+	if answer.Usage.InputTokens != 30 {
+		t.Errorf("expected usage of all three calls, got %+v", answer.Usage)
+	}
+	if len(answer.Sources) != 1 || answer.Sources[0].ChunkIndex != 1 {
+		t.Errorf("expected the searched chunk as the only source, got %+v", answer.Sources)
+	}
+
+	if len(answer.Trace) != 4 {
+		t.Fatalf("expected 4 trace entries, got %+v", answer.Trace)
+	}
+	search, list, read, missing := answer.Trace[0], answer.Trace[1], answer.Trace[2], answer.Trace[3]
+	if search.Step != 1 || search.Tool != ToolSearchDocuments || !strings.Contains(search.Result, "Grounding exercises") {
+		t.Errorf("unexpected search trace %+v", search)
+	}
+	if list.Step != 1 || !strings.Contains(list.Result, "document 1: notes.pdf") {
+		t.Errorf("unexpected list trace %+v", list)
+	}
+	if read.Step != 2 || !strings.Contains(read.Result, "chunk 0") || !strings.Contains(read.Result, "chunk 1") {
+		t.Errorf("expected the chunk and its neighbor, got %+v", read)
+	}
+	if !missing.IsError || !strings.Contains(missing.Result, "document 99 not found") {
+		t.Errorf("expected an error for an unknown document, got %+v", missing)
+	}
+
+	if len(client.calls[0].tools) != 3 {
+		t.Errorf("expected the three tools to be offered, got %d", len(client.calls[0].tools))
+	}
+	sent := client.calls[2].messages
+	if len(sent) != 5 {
+		t.Fatalf("expected question, two tool rounds and their results, got %+v", sent)
+	}
+	if sent[3].Content != "Let me read around it." || len(sent[3].ToolCalls) != 2 {
+		t.Errorf("expected the assistant's tool calls in the history, got %+v", sent[3])
+	}
+	results := sent[4].ToolResults
+	if len(results) != 2 || results[0].CallID != "c" || !results[1].IsError {
+		t.Errorf("expected the tool results to answer the calls, got %+v", results)
+	}
+}
+
+func TestAgentBudget(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget AgentBudget
+	}{
+		{name: "steps", budget: AgentBudget{MaxSteps: 2, MaxTokens: 1000}},
+		{name: "tokens", budget: AgentBudget{MaxSteps: 5, MaxTokens: 11}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				var req struct {
+					Messages []struct {
+						Role    string          `json:"role"`
+						Content json.RawMessage `json:"content"`
+					} `json:"messages"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Fatalf("failed to decode request: %v", err)
+				}
+
+				if calls == 2 {
+					var blocks []struct {
+						Type      string `json:"type"`
+						Text      string `json:"text"`
+						ToolUseID string `json:"tool_use_id"`
+					}
+					last := req.Messages[len(req.Messages)-1]
+					if err := json.Unmarshal(last.Content, &blocks); err != nil {
+						t.Fatalf("expected content blocks in the last message: %v", err)
+					}
+					// Claude rejects a message whose tool_result blocks follow text.
+					if len(blocks) != 2 || blocks[0].Type != "tool_result" || blocks[0].ToolUseID != "toolu_1" ||
+						blocks[1].Type != "text" || blocks[1].Text != budgetNote {
+						t.Errorf("expected the tool result followed by the budget note, got %+v", blocks)
+					}
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{
+					"content": [{"type": "tool_use", "id": "toolu_%d", "name": %q, "input": {"query": "sleep"}}],
+					"stop_reason": "tool_use",
+					"usage": {"input_tokens": 10, "output_tokens": 1}
+				}`, calls, ToolSearchDocuments)
+			}))
+			defer server.Close()
+
+			client := llm.NewClaudeClient("test-key", "claude-test", llm.WithBaseURL(server.URL))
+			pipeline, storageService := newTestPipeline(t, client)
+			agent := NewAgent(pipeline, storageService, WithAgentBudget(tt.budget))
+
+			answer, err := agent.Answer(context.Background(), "How can I sleep better?", QueryOptions{})
+			if err != nil {
+				t.Fatalf("Answer failed: %v", err)
+			}
+
+			if calls != 2 {
+				t.Fatalf("expected the second call to be the last, got %d calls", calls)
+			}
+			if answer.Response != noAnswer || len(answer.Trace) != 1 {
+				t.Errorf("expected the fallback answer after one tool call, got %q with %d trace entries", answer.Response, len(answer.Trace))
+			}
+		})
+	}
+}
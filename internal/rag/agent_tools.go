@@ -0,0 +1,341 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"rag-therapist/internal/chunking"
+	"rag-therapist/internal/knowledge"
+	"rag-therapist/internal/llm"
+	"rag-therapist/internal/storage"
+	"rag-therapist/pkg/models"
+)
+
+const (
+	ToolSearchDocuments  = "search_documents"
+	ToolGetDocumentChunk = "get_document_chunk"
+	ToolListDocuments    = "list_documents"
+)
+
+const (
+	// maxSearchLimit caps the excerpts returned by one search.
+	maxSearchLimit = 20
+	// maxNeighbors caps the chunks read on each side of a chunk.
+	maxNeighbors = 3
+	// maxListedDocuments caps the documents listed per knowledge base.
+	maxListedDocuments = 100
+)
+
+var agentToolDefinitions = []llm.Tool{
+	{
+		Name:        ToolSearchDocuments,
+		Description: "Search the documents for excerpts relevant to a query, using both meaning and exact keywords. Returns the best excerpts with their document ID, chunk index and relevance.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "What to search for, as a question or keywords.",
+				},
+				"limit": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("How many excerpts to return, at most %d.", maxSearchLimit),
+				},
+				"document_ids": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "integer"},
+					"description": "Only search these documents.",
+				},
+			},
+			"required": []string{"query"},
+		},
+	},
+	{
+		Name:        ToolGetDocumentChunk,
+		Description: "Read a chunk of a document together with the chunks around it, e.g. to see the rest of an excerpt returned by search_documents.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"document_id": map[string]interface{}{
+					"type":        "integer",
+					"description": "The document ID.",
+				},
+				"chunk_index": map[string]interface{}{
+					"type":        "integer",
+					"description": "The chunk index within the document.",
+				},
+				"neighbors": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("How many chunks to include before and after, 0 to %d. Defaults to 1.", maxNeighbors),
+				},
+			},
+			"required": []string{"document_id", "chunk_index"},
+		},
+	},
+	{
+		Name:        ToolListDocuments,
+		Description: "List the documents that can be searched, with their IDs, file names, tags and processing status.",
+		Parameters: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+	},
+}
+
+// agentTools runs the agent's tool calls within the scope of one query.
+// Errors are returned to the model as failed tool results.
+type agentTools struct {
+	pipeline  *Pipeline
+	documents DocumentStore
+	bases     []*knowledge.Base
+	weights   storage.HybridWeights
+	lambda    float64
+	filter    *storage.SearchFilter
+
+	// sources are the excerpts found so far; an excerpt is numbered by
+	// its position, which the model cites.
+	sources []hit
+	numbers map[string]int
+}
+
+func (t *agentTools) call(ctx context.Context, call llm.ToolCall) (string, error) {
+	switch call.Name {
+	case ToolSearchDocuments:
+		return t.searchDocuments(ctx, call.Arguments)
+	case ToolGetDocumentChunk:
+		return t.getDocumentChunk(ctx, call.Arguments)
+	case ToolListDocuments:
+		return t.listDocuments(ctx)
+	}
+	return "", fmt.Errorf("unknown tool %q", call.Name)
+}
+
+func (t *agentTools) searchDocuments(ctx context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Query       string `json:"query"`
+		Limit       int    `json:"limit"`
+		DocumentIDs []int  `json:"document_ids"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return "", err
+	}
+
+	query := strings.TrimSpace(args.Query)
+	if query == "" {
+		return "", fmt.Errorf("query is required")
+	}
+
+	limit := args.Limit
+	if limit <= 0 {
+		limit = t.pipeline.topK
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	filter := t.filter
+	if len(args.DocumentIDs) > 0 {
+		narrowed := storage.SearchFilter{}
+		if t.filter != nil {
+			narrowed = *t.filter
+		}
+		narrowed.DocumentIDs = allowedDocumentIDs(t.filter, args.DocumentIDs)
+		if len(narrowed.DocumentIDs) == 0 {
+			return "No excerpts found: none of these documents can be searched.", nil
+		}
+		filter = &narrowed
+	}
+
+	results, err := t.pipeline.search(ctx, t.bases, query, t.weights, t.lambda, filter, limit)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "No excerpts found.", nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d excerpts:\n", len(results))
+	for _, result := range results {
+		fmt.Fprintf(&b, "\n[%d] %s, relevance %.2f\n%s\n", t.number(result), describeChunk(result.DocumentID, result.ChunkIndex, result.Metadata), result.Score, result.Content)
+	}
+	return b.String(), nil
+}
+
+func (t *agentTools) getDocumentChunk(ctx context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		DocumentID int  `json:"document_id"`
+		ChunkIndex int  `json:"chunk_index"`
+		Neighbors  *int `json:"neighbors"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return "", err
+	}
+
+	neighbors := 1
+	if args.Neighbors != nil {
+		neighbors = *args.Neighbors
+	}
+	if neighbors < 0 || neighbors > maxNeighbors {
+		return "", fmt.Errorf("neighbors must be between 0 and %d", maxNeighbors)
+	}
+
+	doc, err := t.documents.GetDocument(ctx, args.DocumentID)
+	if err != nil {
+		return "", fmt.Errorf("document %d not found", args.DocumentID)
+	}
+	base := findBase(t.bases, doc.KnowledgeBaseID)
+	if base == nil {
+		return "", fmt.Errorf("document %d is not in the knowledge bases being searched", args.DocumentID)
+	}
+
+	chunks, err := base.Vectors.GetChunks(ctx, doc.ID, args.ChunkIndex-neighbors, args.ChunkIndex+neighbors)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, chunk := range chunks {
+		if !t.filter.Matches(chunk) {
+			continue
+		}
+		fmt.Fprintf(&b, "[%s]\n%s\n\n", describeChunk(chunk.DocumentID, chunk.ChunkIndex, chunk.Metadata), chunk.Content)
+	}
+	if b.Len() == 0 {
+		return "", fmt.Errorf("chunk %d of document %d not found", args.ChunkIndex, args.DocumentID)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+func (t *agentTools) listDocuments(ctx context.Context) (string, error) {
+	var b strings.Builder
+	for _, base := range t.bases {
+		docs, err := t.documents.ListDocuments(ctx, base.ID, maxListedDocuments, 0)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&b, "Knowledge base %q:\n", base.Name)
+		listed := 0
+		for _, doc := range docs {
+			if !documentAllowed(t.filter, doc) {
+				continue
+			}
+			fmt.Fprintf(&b, "- document %d: %s (%s", doc.ID, doc.FileName, doc.Status)
+			if len(doc.Tags) > 0 {
+				fmt.Fprintf(&b, "; tags: %s", strings.Join(doc.Tags, ", "))
+			}
+			b.WriteString(")\n")
+			listed++
+		}
+		if listed == 0 {
+			b.WriteString("(no documents)\n")
+		}
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// number returns the citation number of result, adding it to the
+// answer's sources when it is found for the first time.
+func (t *agentTools) number(result hit) int {
+	if number, ok := t.numbers[result.ID]; ok {
+		return number
+	}
+	t.sources = append(t.sources, result)
+	t.numbers[result.ID] = len(t.sources)
+	return len(t.sources)
+}
+
+func decodeArguments(arguments json.RawMessage, v interface{}) error {
+	if len(arguments) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(arguments, v); err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+	return nil
+}
+
+// describeChunk names a chunk by document, file and pages for the model.
+func describeChunk(documentID, chunkIndex int, metadata map[string]string) string {
+	return describeChunks(documentID, chunkIndex, chunkIndex, metadata[chunking.MetaPageStart], metadata[chunking.MetaPageEnd], metadata)
+}
+
+// describeChunks names a range of chunks, from the first page of the
+// first chunk to the last page of the last one. The file name is taken
+// from metadata.
+func describeChunks(documentID, fromIndex, toIndex int, start, end string, metadata map[string]string) string {
+	description := fmt.Sprintf("document %d", documentID)
+	if name := metadata["file_name"]; name != "" {
+		description += fmt.Sprintf(" %q", name)
+	}
+	if toIndex > fromIndex {
+		description += fmt.Sprintf(", chunks %d-%d", fromIndex, toIndex)
+	} else {
+		description += fmt.Sprintf(", chunk %d", fromIndex)
+	}
+
+	switch {
+	case start != "" && end != "" && start != end:
+		description += fmt.Sprintf(", pages %s-%s", start, end)
+	case start != "":
+		description += fmt.Sprintf(", page %s", start)
+	}
+	return description
+}
+
+// allowedDocumentIDs keeps the requested documents that filter allows.
+func allowedDocumentIDs(filter *storage.SearchFilter, requested []int) []int {
+	if filter == nil || len(filter.DocumentIDs) == 0 {
+		return requested
+	}
+
+	allowed := make(map[int]bool, len(filter.DocumentIDs))
+	for _, id := range filter.DocumentIDs {
+		allowed[id] = true
+	}
+
+	var ids []int
+	for _, id := range requested {
+		if allowed[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// documentAllowed applies the document-level conditions of filter, its
+// document IDs and tags, to doc.
+func documentAllowed(filter *storage.SearchFilter, doc *models.Document) bool {
+	if filter == nil {
+		return true
+	}
+	if len(filter.DocumentIDs) > 0 && len(allowedDocumentIDs(filter, []int{doc.ID})) == 0 {
+		return false
+	}
+	if len(filter.Tags) == 0 {
+		return true
+	}
+	for _, tag := range doc.Tags {
+		for _, wanted := range filter.Tags {
+			if tag == wanted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findBase returns the searched knowledge base with the given ID.
+func findBase(bases []*knowledge.Base, id int) *knowledge.Base {
+	for _, base := range bases {
+		if base.ID == id {
+			return base
+		}
+	}
+	return nil
+}
+
+var _ DocumentStore = (*storage.StorageService)(nil)
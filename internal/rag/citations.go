@@ -0,0 +1,200 @@
+package rag
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"rag-therapist/internal/chunking"
+	"rag-therapist/pkg/models"
+)
+
+// citationInstructions ask the model to cite the numbered excerpts.
+const citationInstructions = `Cite the excerpts you use by their number in square brackets, e.g. [2] or [1, 3], right after the statement they support.
+When you rely on specific wording, quote it exactly in double quotes before the citation, e.g. "keep a regular bedtime" [2].`
+
+// citationPattern matches [2] and [1, 3].
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// quotePairs are the quotation marks recognized around quoted text.
+var quotePairs = [][2]string{{`"`, `"`}, {"“", "”"}}
+
+// citeAnswer parses the [n] citations in answer.Response, where n numbers
+// passages from 1. Citations of unknown excerpts are dropped. The hits of
+// every cited passage are recorded in answer.Cited. File names come from
+// documents, or the chunk metadata if documents is nil.
+func citeAnswer(ctx context.Context, answer *Answer, passages []passage, documents DocumentStore) {
+	answer.Cited = make(map[string]bool)
+	answer.Citations = nil
+
+	fileNames := make(map[int]string)
+	fileName := func(documentID int, metadata map[string]string) string {
+		if name, ok := fileNames[documentID]; ok {
+			return name
+		}
+		name := metadata["file_name"]
+		if documents != nil {
+			if doc, err := documents.GetDocument(ctx, documentID); err == nil {
+				name = doc.FileName
+			}
+		}
+		fileNames[documentID] = name
+		return name
+	}
+
+	seen := make(map[string]bool)
+	response := answer.Response
+	for _, match := range citationPattern.FindAllStringSubmatchIndex(response, -1) {
+		quoted := quotedBefore(response[:match[0]])
+		sentence := sentenceBefore(response[:match[0]])
+
+		for _, field := range strings.Split(response[match[2]:match[3]], ",") {
+			number, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || number < 1 || number > len(passages) {
+				continue
+			}
+			passage := passages[number-1]
+
+			quote, offset := quoted, strings.Index(passage.Content, quoted)
+			if quoted == "" || offset < 0 {
+				quote, offset = bestSentence(passage.Content, sentence)
+			}
+
+			key := strconv.Itoa(number) + "\x00" + quote
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			for _, h := range passage.hits {
+				answer.Cited[h.ID] = true
+			}
+
+			chunk := passage.chunkAt(offset)
+			citation := models.Citation{
+				Number:     number,
+				DocumentID: passage.DocumentID,
+				ChunkID:    chunk.ID,
+				FileName:   fileName(passage.DocumentID, chunk.Metadata),
+				Quote:      quote,
+			}
+			citation.Page, _ = strconv.Atoi(chunk.Metadata[chunking.MetaPageStart])
+			if end, _ := strconv.Atoi(chunk.Metadata[chunking.MetaPageEnd]); end > citation.Page {
+				citation.PageEnd = end
+			}
+			answer.Citations = append(answer.Citations, citation)
+		}
+	}
+}
+
+// quotedBefore returns the quoted text that text ends with, if any.
+func quotedBefore(text string) string {
+	text = strings.TrimRight(text, " \t")
+	for _, pair := range quotePairs {
+		if !strings.HasSuffix(text, pair[1]) {
+			continue
+		}
+		inner := text[:len(text)-len(pair[1])]
+		start := strings.LastIndex(inner, pair[0])
+		if start < 0 {
+			continue
+		}
+		return strings.TrimSpace(inner[start+len(pair[0]):])
+	}
+	return ""
+}
+
+// sentenceBefore returns the sentence of text that a citation at its end
+// belongs to.
+func sentenceBefore(text string) string {
+	sentences := splitSentences(text)
+	for i := len(sentences) - 1; i >= 0; i-- {
+		// Skip what is left of an earlier citation, e.g. "[1]".
+		sentence := strings.TrimSpace(citationPattern.ReplaceAllString(text[sentences[i][0]:sentences[i][1]], ""))
+		if sentence != "" {
+			return sentence
+		}
+	}
+	return ""
+}
+
+// bestSentence returns the sentence of content sharing the most words with
+// sentence, and its offset. Without any shared word it returns the first
+// sentence.
+func bestSentence(content, sentence string) (string, int) {
+	sentences := splitSentences(content)
+	if len(sentences) == 0 {
+		return "", 0
+	}
+
+	wanted := make(map[string]bool)
+	for _, word := range words(sentence) {
+		wanted[word] = true
+	}
+
+	best, bestShared := sentences[0], 0
+	for _, span := range sentences {
+		shared := 0
+		for _, word := range words(content[span[0]:span[1]]) {
+			if wanted[word] {
+				shared++
+			}
+		}
+		if shared > bestShared {
+			best, bestShared = span, shared
+		}
+	}
+	return content[best[0]:best[1]], best[0]
+}
+
+// splitSentences returns the [start, end) offsets of the sentences of text,
+// without surrounding whitespace. Sentences end at ., ! or ? followed by
+// whitespace, or at a line break.
+func splitSentences(text string) [][2]int {
+	var spans [][2]int
+	add := func(start, end int) {
+		for start < end && unicode.IsSpace(rune(text[start])) {
+			start++
+		}
+		for end > start && unicode.IsSpace(rune(text[end-1])) {
+			end--
+		}
+		if start < end {
+			spans = append(spans, [2]int{start, end})
+		}
+	}
+
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\n':
+			add(start, i)
+			start = i + 1
+		case '.', '!', '?':
+			if i+1 == len(text) || text[i+1] == ' ' || text[i+1] == '\n' {
+				add(start, i+1)
+				start = i + 1
+			}
+		}
+	}
+	add(start, len(text))
+	return spans
+}
+
+// words returns the lower-cased words of text with at least three
+// characters, which leaves out most stop words.
+func words(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var result []string
+	for _, field := range fields {
+		if len([]rune(field)) >= 3 {
+			result = append(result, field)
+		}
+	}
+	return result
+}
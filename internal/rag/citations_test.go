@@ -0,0 +1,121 @@
+package rag
+
+import (
+	"context"
+	"testing"
+
+	"rag-therapist/internal/llm"
+	"rag-therapist/internal/storage"
+	"rag-therapist/pkg/models"
+)
+
+// fakeDocuments knows the file names of documents by ID.
+type fakeDocuments map[int]string
+
+func (f fakeDocuments) GetDocument(ctx context.Context, id int) (*models.Document, error) {
+	name, ok := f[id]
+	if !ok {
+		return nil, storage.ErrDocumentNotFound
+	}
+	return &models.Document{ID: id, FileName: name}, nil
+}
+
+func (f fakeDocuments) ListDocuments(ctx context.Context, knowledgeBaseID, limit, offset int) ([]*models.Document, error) {
+	return nil, nil
+}
+
+func testPassages() []passage {
+	guide := hit{SearchResult: storage.SearchResult{ID: "doc_3_chunk_4", DocumentID: 3, ChunkIndex: 4}}
+	notes := hit{SearchResult: storage.SearchResult{ID: "doc_5_chunk_0", DocumentID: 5, ChunkIndex: 0}}
+
+	return []passage{
+		{
+			DocumentID: 3, FromIndex: 4, ToIndex: 5,
+			Content: "Stimulus control means using the bed only for sleep. Sleep restriction limits the time in bed.",
+			hits:    []hit{guide},
+			chunks: []passageChunk{
+				{ID: "doc_3_chunk_4", Index: 4, Metadata: map[string]string{"page_start": "12", "page_end": "12", "file_name": "old-name.pdf"}},
+				{ID: "doc_3_chunk_5", Index: 5, Metadata: map[string]string{"page_start": "13", "page_end": "14"}, offset: 53},
+			},
+		},
+		{
+			DocumentID: 5, FromIndex: 0, ToIndex: 0,
+			Content: "Grounding exercises help with anxiety.",
+			hits:    []hit{notes},
+			chunks:  []passageChunk{{ID: "doc_5_chunk_0", Index: 0, Metadata: map[string]string{"file_name": "notes.pdf"}}},
+		},
+	}
+}
+
+func TestCiteAnswer(t *testing.T) {
+	ctx := context.Background()
+	answer := &Answer{Response: `Limit your time in bed, as "Sleep restriction limits the time in bed." [1] Also see [7].`}
+	citeAnswer(ctx, answer, testPassages(), fakeDocuments{3: "cbt-i.pdf"})
+
+	if len(answer.Citations) != 1 {
+		t.Fatalf("expected the citation of an unknown excerpt to be dropped, got %+v", answer.Citations)
+	}
+	want := models.Citation{
+		Number:     1,
+		DocumentID: 3,
+		ChunkID:    "doc_3_chunk_5",
+		FileName:   "cbt-i.pdf",
+		Page:       13,
+		PageEnd:    14,
+		Quote:      "Sleep restriction limits the time in bed.",
+	}
+	if answer.Citations[0] != want {
+		t.Errorf("expected %+v, got %+v", want, answer.Citations[0])
+	}
+	if !answer.Cited["doc_3_chunk_4"] || answer.Cited["doc_5_chunk_0"] {
+		t.Errorf("expected only the first source to be cited, got %v", answer.Cited)
+	}
+}
+
+func TestCiteAnswerWithoutQuote(t *testing.T) {
+	ctx := context.Background()
+	answer := &Answer{Response: "Try grounding exercises against anxiety [2]. Use the bed only for sleep [1, 2]."}
+	citeAnswer(ctx, answer, testPassages(), nil)
+
+	if len(answer.Citations) != 2 {
+		t.Fatalf("expected a repeated citation to be merged, got %+v", answer.Citations)
+	}
+	first, second := answer.Citations[0], answer.Citations[1]
+	if first.Number != 2 || first.FileName != "notes.pdf" || first.Quote != "Grounding exercises help with anxiety." || first.Page != 0 {
+		t.Errorf("expected the excerpt's sentence and metadata file name, got %+v", first)
+	}
+	if second.Number != 1 || second.Quote != "Stimulus control means using the bed only for sleep." || second.Page != 12 || second.PageEnd != 0 {
+		t.Errorf("expected the best matching sentence on page 12, got %+v", second)
+	}
+}
+
+func TestQuotedBefore(t *testing.T) {
+	cases := map[string]string{
+		`The guide says "keep a regular bedtime" `: "keep a regular bedtime",
+		"It says “use the bed only for sleep”":     "use the bed only for sleep",
+		"No quote here ":    "",
+		`Unbalanced quote"`: "",
+	}
+	for text, want := range cases {
+		if got := quotedBefore(text); got != want {
+			t.Errorf("quotedBefore(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestAnswerReturnsCitations(t *testing.T) {
+	client := &fakeLLM{script: []llm.Response{reply("Keep a regular bedtime [1].")}}
+	pipeline, _ := newTestPipeline(t, client)
+
+	answer, err := pipeline.Answer(context.Background(), "What is sleep hygiene?", QueryOptions{})
+	if err != nil {
+		t.Fatalf("Answer failed: %v", err)
+	}
+
+	if len(answer.Citations) != 1 || answer.Citations[0].Quote != "Sleep hygiene means keeping a regular bedtime." {
+		t.Errorf("expected a citation of the sleep chunk, got %+v", answer.Citations)
+	}
+	if len(answer.Sources) == 0 || !answer.Cited[answer.Sources[0].ID] {
+		t.Errorf("expected the first source to be cited, got %v", answer.Cited)
+	}
+}
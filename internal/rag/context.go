@@ -0,0 +1,302 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"rag-therapist/internal/chunking"
+	"rag-therapist/internal/knowledge"
+	"rag-therapist/internal/storage"
+)
+
+const (
+	DefaultContextNeighbors = 0
+	DefaultContextMaxTokens = 6000
+	// MaxContextNeighbors caps the chunks added on each side of a hit.
+	MaxContextNeighbors = 5
+)
+
+const (
+	// minChunkOverlap is the shortest repeated text trimmed when joining
+	// consecutive chunks; shorter matches are likely coincidence.
+	minChunkOverlap = 16
+	// chunkGap marks left-out chunks inside a passage.
+	chunkGap = "\n[...]\n"
+)
+
+// ContextOptions control how search hits become the context sent to the
+// LLM. Each hit is expanded by Neighbors chunks on either side, overlapping
+// windows of the same document are merged into one passage, and passages
+// are added best first while they fit in MaxTokens (estimated).
+type ContextOptions struct {
+	Neighbors int
+	MaxTokens int
+}
+
+var DefaultContextOptions = ContextOptions{Neighbors: DefaultContextNeighbors, MaxTokens: DefaultContextMaxTokens}
+
+func (o ContextOptions) Validate() error {
+	if err := validateNeighbors(o.Neighbors); err != nil {
+		return err
+	}
+	if o.MaxTokens < 1 {
+		return fmt.Errorf("context max tokens must be at least 1")
+	}
+	return nil
+}
+
+func validateNeighbors(neighbors int) error {
+	if neighbors < 0 || neighbors > MaxContextNeighbors {
+		return fmt.Errorf("neighbors must be between 0 and %d", MaxContextNeighbors)
+	}
+	return nil
+}
+
+// passage is a run of consecutive chunks of one document, sent to the LLM
+// as a single excerpt.
+type passage struct {
+	DocumentID int
+	FromIndex  int
+	ToIndex    int
+	Content    string
+	// hits are the search results within the passage, best first.
+	hits []hit
+	// chunks are the chunks Content was joined from, in order.
+	chunks []passageChunk
+}
+
+// passageChunk is a chunk of a passage; its text starts at offset in the
+// passage content.
+type passageChunk struct {
+	ID       string
+	Index    int
+	Metadata map[string]string
+	offset   int
+}
+
+// chunkAt returns the chunk the passage content at offset belongs to.
+func (p passage) chunkAt(offset int) passageChunk {
+	chunk := p.chunks[0]
+	for _, c := range p.chunks[1:] {
+		if c.offset > offset {
+			break
+		}
+		chunk = c
+	}
+	return chunk
+}
+
+// describe names the passage by document, file, chunks and pages.
+func (p passage) describe() string {
+	first, last := p.chunks[0].Metadata, p.chunks[len(p.chunks)-1].Metadata
+	return describeChunks(p.DocumentID, p.FromIndex, p.ToIndex, first[chunking.MetaPageStart], last[chunking.MetaPageEnd], first)
+}
+
+// hitPassage is a passage of a single hit without neighbours.
+func hitPassage(h hit) passage {
+	return passage{
+		DocumentID: h.DocumentID,
+		FromIndex:  h.ChunkIndex,
+		ToIndex:    h.ChunkIndex,
+		Content:    h.Content,
+		hits:       []hit{h},
+		chunks:     []passageChunk{{ID: h.ID, Index: h.ChunkIndex, Metadata: h.Metadata}},
+	}
+}
+
+// window is the chunk range of a passage before its chunks are fetched.
+type window struct {
+	base       *knowledge.Base
+	documentID int
+	from, to   int
+	hits       []hit
+	// rank is the position of the best hit in the search results.
+	rank int
+}
+
+// assembleContext turns hits, ordered best first, into passages within
+// opts.MaxTokens. Neighbouring chunks that do not match filter are left
+// out. It also returns the hits that made it into the context, in their
+// original order.
+func assembleContext(ctx context.Context, hits []hit, opts ContextOptions, filter *storage.SearchFilter) ([]passage, []storage.SearchResult, error) {
+	remaining := opts.MaxTokens
+	var passages []passage
+
+	for _, w := range expansionWindows(hits, opts.Neighbors) {
+		candidate, err := w.passage(ctx, filter)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if tokens := estimateTokens(candidate.Content); tokens <= remaining {
+			passages = append(passages, candidate)
+			remaining -= tokens
+			continue
+		}
+
+		// The expanded passage is too long; fall back to the hits alone.
+		if opts.Neighbors == 0 && len(w.hits) == 1 {
+			continue
+		}
+		for _, h := range w.hits {
+			single := hitPassage(h)
+			if tokens := estimateTokens(single.Content); tokens <= remaining {
+				passages = append(passages, single)
+				remaining -= tokens
+			}
+		}
+	}
+
+	included := make(map[string]bool)
+	for _, p := range passages {
+		for _, h := range p.hits {
+			included[h.ID] = true
+		}
+	}
+	var sources []storage.SearchResult
+	for _, h := range hits {
+		if included[h.ID] {
+			sources = append(sources, h.SearchResult)
+		}
+	}
+
+	return passages, sources, nil
+}
+
+// expansionWindows widens every hit by neighbors chunks on both sides and
+// merges the windows of a document that overlap or touch. Windows are
+// ordered by their best hit.
+func expansionWindows(hits []hit, neighbors int) []window {
+	byDocument := make(map[int][]window)
+	var documentIDs []int
+	for rank, h := range hits {
+		if _, ok := byDocument[h.DocumentID]; !ok {
+			documentIDs = append(documentIDs, h.DocumentID)
+		}
+		from := h.ChunkIndex - neighbors
+		if from < 0 {
+			from = 0
+		}
+		byDocument[h.DocumentID] = append(byDocument[h.DocumentID], window{
+			base:       h.base,
+			documentID: h.DocumentID,
+			from:       from,
+			to:         h.ChunkIndex + neighbors,
+			hits:       []hit{h},
+			rank:       rank,
+		})
+	}
+
+	var merged []window
+	for _, id := range documentIDs {
+		windows := byDocument[id]
+		sort.SliceStable(windows, func(i, j int) bool {
+			return windows[i].from < windows[j].from
+		})
+
+		current := windows[0]
+		for _, w := range windows[1:] {
+			if w.from > current.to+1 {
+				merged = append(merged, current)
+				current = w
+				continue
+			}
+			if w.to > current.to {
+				current.to = w.to
+			}
+			current.hits = append(current.hits, w.hits...)
+			if w.rank < current.rank {
+				current.rank = w.rank
+			}
+		}
+		merged = append(merged, current)
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].rank < merged[j].rank
+	})
+	for _, w := range merged {
+		sort.SliceStable(w.hits, func(i, j int) bool {
+			return w.hits[i].Score > w.hits[j].Score
+		})
+	}
+	return merged
+}
+
+// passage fetches the chunks of the window and joins them. The hits are
+// used as they are, so a window without neighbours needs no fetch.
+func (w window) passage(ctx context.Context, filter *storage.SearchFilter) (passage, error) {
+	contents := make(map[int]storage.DocumentChunk)
+	for _, h := range w.hits {
+		contents[h.ChunkIndex] = storage.DocumentChunk{ID: h.ID, Content: h.Content, DocumentID: h.DocumentID, ChunkIndex: h.ChunkIndex, Metadata: h.Metadata}
+	}
+
+	if len(contents) < w.to-w.from+1 {
+		chunks, err := w.base.Vectors.GetChunks(ctx, w.documentID, w.from, w.to)
+		if err != nil {
+			return passage{}, fmt.Errorf("failed to expand document %d: %w", w.documentID, err)
+		}
+		for _, chunk := range chunks {
+			if _, ok := contents[chunk.ChunkIndex]; ok || !filter.Matches(chunk) {
+				continue
+			}
+			contents[chunk.ChunkIndex] = chunk
+		}
+	}
+
+	indexes := make([]int, 0, len(contents))
+	for index := range contents {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	var b strings.Builder
+	var chunks []passageChunk
+	for i, index := range indexes {
+		chunk := contents[index]
+		text := chunk.Content
+		switch {
+		case i == 0:
+		case index == indexes[i-1]+1:
+			text = trimOverlap(contents[indexes[i-1]].Content, text)
+		default:
+			b.WriteString(chunkGap)
+		}
+		chunks = append(chunks, passageChunk{ID: chunk.ID, Index: index, Metadata: chunk.Metadata, offset: b.Len()})
+		b.WriteString(text)
+	}
+
+	return passage{
+		DocumentID: w.documentID,
+		FromIndex:  indexes[0],
+		ToIndex:    indexes[len(indexes)-1],
+		Content:    b.String(),
+		hits:       w.hits,
+		chunks:     chunks,
+	}, nil
+}
+
+// trimOverlap returns next without the text it repeats from the end of
+// prev, as chunkers repeat some text between consecutive chunks. Without
+// such overlap the chunks are separated by a line break.
+func trimOverlap(prev, next string) string {
+	longest := len(prev)
+	if len(next) < longest {
+		longest = len(next)
+	}
+	for n := longest; n >= minChunkOverlap; n-- {
+		if strings.HasSuffix(prev, next[:n]) {
+			return next[n:]
+		}
+	}
+	return "\n" + next
+}
+
+// estimateTokens over-approximates the token count (~4 characters per
+// token for English) so the context stays within its budget without a
+// tokenizer.
+func estimateTokens(text string) int {
+	return len(text)/3 + 1
+}
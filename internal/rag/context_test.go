@@ -0,0 +1,148 @@
+package rag
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"rag-therapist/internal/knowledge"
+	"rag-therapist/internal/llm"
+	"rag-therapist/internal/storage"
+)
+
+// storeChapter stores a document whose consecutive chunks repeat the last
+// words of the previous chunk, as the chunkers do.
+func storeChapter(t *testing.T, base *knowledge.Base, documentID int) {
+	t.Helper()
+	ctx := context.Background()
+
+	chunks := []string{
+		"Chapter one introduces the course.",
+		"introduces the course. Stimulus control means using the bed only for sleep.",
+		"the bed only for sleep. Sleep restriction limits the time in bed to the actual sleep time.",
+		"to the actual sleep time. Both are core parts of CBT-I.",
+		"Chapter two covers relapse prevention.",
+	}
+	vectors := make([][]float32, len(chunks))
+	for i := range vectors {
+		vectors[i] = []float32{1, 0}
+	}
+	if err := base.Vectors.StoreDocumentChunks(ctx, documentID, chunks, vectors, nil); err != nil {
+		t.Fatalf("StoreDocumentChunks failed: %v", err)
+	}
+}
+
+func chapterHits(base *knowledge.Base, documentID int, indexes ...int) []hit {
+	ctx := context.Background()
+	var hits []hit
+	for rank, index := range indexes {
+		chunks, _ := base.Vectors.GetChunks(ctx, documentID, index, index)
+		hits = append(hits, hit{
+			SearchResult: storage.SearchResult{
+				ID:         storage.GenerateChunkID(documentID, index),
+				Content:    chunks[0].Content,
+				DocumentID: documentID,
+				ChunkIndex: index,
+				Score:      1 - float32(rank)/10,
+			},
+			base: base,
+		})
+	}
+	return hits
+}
+
+func TestAssembleContextMergesNeighbors(t *testing.T) {
+	ctx := context.Background()
+	pipeline, _ := newTestPipeline(t, &fakeLLM{})
+	base, _ := pipeline.bases.Default(ctx)
+	storeChapter(t, base, 7)
+
+	hits := chapterHits(base, 7, 2, 1)
+	passages, sources, err := assembleContext(ctx, hits, ContextOptions{Neighbors: 1, MaxTokens: 1000}, nil)
+	if err != nil {
+		t.Fatalf("assembleContext failed: %v", err)
+	}
+
+	if len(passages) != 1 || passages[0].FromIndex != 0 || passages[0].ToIndex != 3 {
+		t.Fatalf("expected one passage over chunks 0-3, got %+v", passages)
+	}
+	want := "Chapter one introduces the course. Stimulus control means using the bed only for sleep. Sleep restriction limits the time in bed to the actual sleep time. Both are core parts of CBT-I."
+	if passages[0].Content != want {
+		t.Errorf("expected the overlap to be trimmed, got %q", passages[0].Content)
+	}
+	if len(sources) != 2 || sources[0].ChunkIndex != 2 || sources[1].ChunkIndex != 1 {
+		t.Errorf("expected both hits as sources in search order, got %+v", sources)
+	}
+}
+
+func TestAssembleContextKeepsSeparateWindows(t *testing.T) {
+	ctx := context.Background()
+	pipeline, _ := newTestPipeline(t, &fakeLLM{})
+	base, _ := pipeline.bases.Default(ctx)
+	storeChapter(t, base, 7)
+
+	passages, _, err := assembleContext(ctx, chapterHits(base, 7, 4, 0), ContextOptions{Neighbors: 1, MaxTokens: 1000}, nil)
+	if err != nil {
+		t.Fatalf("assembleContext failed: %v", err)
+	}
+
+	if len(passages) != 2 {
+		t.Fatalf("expected two passages, got %+v", passages)
+	}
+	if passages[0].FromIndex != 3 || passages[0].ToIndex != 4 || passages[1].FromIndex != 0 || passages[1].ToIndex != 1 {
+		t.Errorf("expected the passage of the best hit first, got %+v", passages)
+	}
+}
+
+func TestAssembleContextTokenBudget(t *testing.T) {
+	ctx := context.Background()
+	pipeline, _ := newTestPipeline(t, &fakeLLM{})
+	base, _ := pipeline.bases.Default(ctx)
+	storeChapter(t, base, 7)
+
+	// Chunks 1-3 need about 60 tokens, chunk 2 alone about 31.
+	hits := chapterHits(base, 7, 2)
+	passages, sources, err := assembleContext(ctx, hits, ContextOptions{Neighbors: 1, MaxTokens: 40}, nil)
+	if err != nil {
+		t.Fatalf("assembleContext failed: %v", err)
+	}
+
+	total := 0
+	for _, p := range passages {
+		total += estimateTokens(p.Content)
+	}
+	if total > 40 {
+		t.Errorf("expected the context within 40 tokens, got %d", total)
+	}
+	if len(passages) == 0 || passages[0].FromIndex != 2 || passages[0].ToIndex != 2 {
+		t.Fatalf("expected the best hit without neighbours first, got %+v", passages)
+	}
+	if len(sources) != 1 {
+		t.Errorf("expected the hit as the only source, got %+v", sources)
+	}
+}
+
+func TestAnswerExpandsNeighbors(t *testing.T) {
+	client := &fakeLLM{script: []llm.Response{reply("Use the bed only for sleep.")}}
+	pipeline, _ := newTestPipeline(t, client)
+
+	neighbors := 1
+	_, err := pipeline.Answer(context.Background(), "What is grounding?", QueryOptions{Neighbors: &neighbors})
+	if err != nil {
+		t.Fatalf("Answer failed: %v", err)
+	}
+
+	prompt := client.calls[0].messages[0].Content
+	if !strings.Contains(prompt, "[1] document 1, chunks 0-1\n") || strings.Contains(prompt, "[2]") {
+		t.Errorf("expected the hits to be merged into one passage, got %q", prompt)
+	}
+}
+
+func TestTrimOverlap(t *testing.T) {
+	if got := trimOverlap("one two three four five", "three four five six"); got != "\nthree four five six" {
+		t.Errorf("expected a short repeat to be kept, got %q", got)
+	}
+	if got := trimOverlap("the first sentence ends here.", "sentence ends here. The next one"); got != " The next one" {
+		t.Errorf("expected the repeated text to be trimmed, got %q", got)
+	}
+}
@@ -0,0 +1,341 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"rag-therapist/internal/knowledge"
+	"rag-therapist/internal/llm"
+	"rag-therapist/internal/storage"
+	"rag-therapist/pkg/models"
+)
+
+const DefaultTopK = 5
+
+const systemPrompt = `You are a helpful assistant that answers questions using excerpts from the user's uploaded documents.
+Base your answer on the provided context. If the context does not contain the answer, say so instead of guessing.
+` + citationInstructions
+
+type Answer struct {
+	// Question is what retrieval searched for: the question itself, or a
+	// follow-up rewritten to stand on its own.
+	Question string
+	Response string
+	Sources  []storage.SearchResult
+	Usage    llm.Usage
+	// Trace lists the tool calls of an agent run, in order.
+	Trace []TraceEntry
+	// Citations are the valid [n] references in Response, in order.
+	Citations []models.Citation
+	// Cited holds the IDs of the sources the response cites.
+	Cited map[string]bool
+
+	// passages are the numbered context excerpts citations refer to.
+	passages []passage
+}
+
+// QueryOptions tune retrieval for a single question. Nil fields fall back
+// to the pipeline defaults.
+type QueryOptions struct {
+	// KnowledgeBaseIDs are searched together; empty means the default
+	// knowledge base.
+	KnowledgeBaseIDs []int
+	// Weights of the vector and keyword rankings in hybrid search.
+	VectorWeight  *float64
+	KeywordWeight *float64
+	// Filter restricts retrieval to matching chunks, e.g. to a set of
+	// documents.
+	Filter *storage.SearchFilter
+	// History holds the earlier turns of the conversation, oldest first.
+	// With history, the question is rewritten into a standalone question
+	// before retrieval and the turns are sent to the LLM ahead of it.
+	History []llm.Message
+	// Neighbors is the number of chunks added to the context on each side
+	// of a search hit.
+	Neighbors *int
+	// MMRLambda trades relevance (1) against diversity (0) of the hits.
+	MMRLambda *float64
+}
+
+type Pipeline struct {
+	bases     *knowledge.Registry
+	llm       llm.Client
+	documents DocumentStore
+	topK      int
+	weights   storage.HybridWeights
+	lambda    float64
+	context   ContextOptions
+}
+
+type Option func(*Pipeline)
+
+// WithHybridWeights sets the default weights of the vector and keyword
+// rankings, used when a question does not set its own.
+func WithHybridWeights(weights storage.HybridWeights) Option {
+	return func(p *Pipeline) {
+		p.weights = weights
+	}
+}
+
+// WithDocumentStore looks up the file names of cited documents. Without
+// it, citations use the file name stored with the chunks.
+func WithDocumentStore(documents DocumentStore) Option {
+	return func(p *Pipeline) {
+		p.documents = documents
+	}
+}
+
+// WithMMRLambda sets the default maximal marginal relevance lambda, used
+// when a question does not set its own; 1 turns diversification off.
+func WithMMRLambda(lambda float64) Option {
+	return func(p *Pipeline) {
+		p.lambda = lambda
+	}
+}
+
+// WithContextOptions sets how search hits are expanded into the context
+// and the token budget of the context.
+func WithContextOptions(opts ContextOptions) Option {
+	return func(p *Pipeline) {
+		p.context = opts
+	}
+}
+
+func NewPipeline(bases *knowledge.Registry, client llm.Client, opts ...Option) *Pipeline {
+	p := &Pipeline{
+		bases:   bases,
+		llm:     client,
+		topK:    DefaultTopK,
+		weights: storage.DefaultHybridWeights,
+		lambda:  storage.DefaultMMRLambda,
+		context: DefaultContextOptions,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func (p *Pipeline) Answer(ctx context.Context, question string, opts QueryOptions) (*Answer, error) {
+	answer, messages, err := p.retrieve(ctx, question, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.llm.Chat(ctx, systemPrompt, messages, llm.Options{MaxTokens: llm.DefaultMaxTokens})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate answer: %w", err)
+	}
+
+	answer.Response = resp.Content
+	answer.Usage = addUsage(answer.Usage, resp.Usage)
+	citeAnswer(ctx, answer, answer.passages, p.documents)
+	return answer, nil
+}
+
+// AnswerStream retrieves context, reports it through onSources and then
+// streams the generated answer through onDelta. The returned Answer holds
+// the complete response once generation has finished.
+func (p *Pipeline) AnswerStream(ctx context.Context, question string, opts QueryOptions, onSources func([]storage.SearchResult) error, onDelta llm.DeltaFunc) (*Answer, error) {
+	answer, messages, err := p.retrieve(ctx, question, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := onSources(answer.Sources); err != nil {
+		return nil, err
+	}
+
+	resp, err := p.llm.ChatStream(ctx, systemPrompt, messages, llm.Options{MaxTokens: llm.DefaultMaxTokens}, onDelta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate answer: %w", err)
+	}
+
+	answer.Response = resp.Content
+	answer.Usage = addUsage(answer.Usage, resp.Usage)
+	citeAnswer(ctx, answer, answer.passages, p.documents)
+	return answer, nil
+}
+
+// ValidateOptions reports whether opts can be used for a query, so callers
+// can reject bad input before any work is done. Bad options are in the
+// storage.ErrInvalid category and unknown knowledge bases are reported
+// with storage.ErrKnowledgeBaseNotFound; anything else is a failure to
+// open the knowledge bases.
+func (p *Pipeline) ValidateOptions(ctx context.Context, opts QueryOptions) error {
+	if err := p.validateQuery(opts); err != nil {
+		return storage.Invalid(err)
+	}
+	_, err := p.bases.Resolve(ctx, opts.KnowledgeBaseIDs)
+	return err
+}
+
+func (p *Pipeline) validateQuery(opts QueryOptions) error {
+	if err := p.hybridWeights(opts).Validate(); err != nil {
+		return err
+	}
+	if err := opts.Filter.Validate(); err != nil {
+		return err
+	}
+	if err := storage.ValidateMMRLambda(p.mmrLambda(opts)); err != nil {
+		return err
+	}
+	if opts.Neighbors != nil {
+		return validateNeighbors(*opts.Neighbors)
+	}
+	return nil
+}
+
+func (p *Pipeline) hybridWeights(opts QueryOptions) storage.HybridWeights {
+	weights := p.weights
+	if opts.VectorWeight != nil {
+		weights.Vector = *opts.VectorWeight
+	}
+	if opts.KeywordWeight != nil {
+		weights.Keyword = *opts.KeywordWeight
+	}
+	return weights
+}
+
+func (p *Pipeline) mmrLambda(opts QueryOptions) float64 {
+	if opts.MMRLambda != nil {
+		return *opts.MMRLambda
+	}
+	return p.lambda
+}
+
+func (p *Pipeline) contextOptions(opts QueryOptions) ContextOptions {
+	expansion := p.context
+	if opts.Neighbors != nil {
+		expansion.Neighbors = *opts.Neighbors
+	}
+	return expansion
+}
+
+// retrieve searches for the question and returns the partial answer
+// holding the sources, together with the messages to send to the LLM.
+func (p *Pipeline) retrieve(ctx context.Context, question string, opts QueryOptions) (*Answer, []llm.Message, error) {
+	weights := p.hybridWeights(opts)
+
+	bases, err := p.bases.Resolve(ctx, opts.KnowledgeBaseIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	answer := &Answer{Question: question}
+	if len(opts.History) > 0 {
+		standalone, usage, err := p.rewriteQuestion(ctx, opts.History, question)
+		if err != nil {
+			return nil, nil, err
+		}
+		answer.Question = standalone
+		answer.Usage = usage
+	}
+
+	hits, err := p.search(ctx, bases, answer.Question, weights, p.mmrLambda(opts), opts.Filter, p.topK)
+	if err != nil {
+		return nil, nil, err
+	}
+	passages, sources, err := assembleContext(ctx, hits, p.contextOptions(opts), opts.Filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	answer.Sources = sources
+	answer.passages = passages
+
+	messages := make([]llm.Message, 0, len(opts.History)+1)
+	messages = append(messages, opts.History...)
+	messages = append(messages, llm.Message{Role: llm.RoleUser, Content: buildPrompt(question, passages)})
+
+	return answer, messages, nil
+}
+
+// hit is a search result, the knowledge base it was found in and its
+// rank there, from 0.
+type hit struct {
+	storage.SearchResult
+	base *knowledge.Base
+	rank int
+}
+
+// search runs a hybrid search for query in each knowledge base,
+// diversified unless lambda is 1, and returns the best limit results
+// overall.
+func (p *Pipeline) search(ctx context.Context, bases []*knowledge.Base, query string, weights storage.HybridWeights, lambda float64, filter *storage.SearchFilter, limit int) ([]hit, error) {
+	// Knowledge bases sharing an embedding model share the query embedding.
+	queryEmbeddings := make(map[string][]float32)
+
+	var sources []hit
+	for _, base := range bases {
+		var queryEmbedding []float32
+		if weights.Vector > 0 {
+			key := fmt.Sprintf("%s/%d", base.EmbeddingModel, base.EmbeddingDimensions)
+			queryEmbedding = queryEmbeddings[key]
+			if queryEmbedding == nil {
+				var err error
+				queryEmbedding, err = base.Embedder.EmbedQuery(ctx, query)
+				if err != nil {
+					return nil, fmt.Errorf("failed to embed query: %w", err)
+				}
+				queryEmbeddings[key] = queryEmbedding
+			}
+		}
+
+		results, err := base.Vectors.DiverseSearch(ctx, query, queryEmbedding, limit, weights, filter, lambda)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search knowledge base %d: %w", base.ID, err)
+		}
+		for rank, result := range results {
+			sources = append(sources, hit{SearchResult: result, base: base, rank: rank})
+		}
+	}
+
+	if len(bases) > 1 {
+		sort.SliceStable(sources, mergeOrder(sources, weights))
+		if len(sources) > limit {
+			sources = sources[:limit]
+		}
+	}
+
+	return sources, nil
+}
+
+// mergeOrder orders hits from several knowledge bases. Fused scores are
+// relative to each base's own ranking, where the first hit scores about 1
+// however relevant it is, so they are not compared across bases. Hits are
+// merged by embedding similarity instead, with the fused score breaking
+// ties; keyword-only hits have no similarity and follow. Without a vector
+// search nothing is comparable, and the rankings are fused by reciprocal
+// rank, which takes the bases' hits in turns.
+func mergeOrder(hits []hit, weights storage.HybridWeights) func(i, j int) bool {
+	if weights.Vector == 0 {
+		return func(i, j int) bool {
+			return hits[i].rank < hits[j].rank
+		}
+	}
+	return func(i, j int) bool {
+		if hits[i].Similarity != hits[j].Similarity {
+			return hits[i].Similarity > hits[j].Similarity
+		}
+		return hits[i].Score > hits[j].Score
+	}
+}
+
+func buildPrompt(question string, passages []passage) string {
+	var b strings.Builder
+
+	b.WriteString("Context:\n")
+	if len(passages) == 0 {
+		b.WriteString("(no relevant document excerpts found)\n")
+	}
+	for i, passage := range passages {
+		fmt.Fprintf(&b, "\n[%d] %s\n%s\n", i+1, passage.describe(), passage.Content)
+	}
+
+	b.WriteString("\nQuestion: ")
+	b.WriteString(question)
+
+	return b.String()
+}
@@ -0,0 +1,250 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"rag-therapist/internal/config"
+	"rag-therapist/internal/embeddings"
+	"rag-therapist/internal/knowledge"
+	"rag-therapist/internal/llm"
+	"rag-therapist/internal/storage"
+	"rag-therapist/pkg/models"
+)
+
+// fakeEmbedder embeds every text as the same vector.
+type fakeEmbedder struct{}
+
+func (fakeEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i := range texts {
+		vectors[i] = []float32{1, 0}
+	}
+	return vectors, nil
+}
+
+func (fakeEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	return []float32{1, 0}, nil
+}
+
+func (fakeEmbedder) Dimensions() int   { return 2 }
+func (fakeEmbedder) ModelName() string { return "fake-embedding" }
+
+type llmCall struct {
+	systemPrompt string
+	messages     []llm.Message
+	tools        []llm.Tool
+}
+
+// fakeLLM plays back a script of responses, one per call, and records the
+// calls. Every response uses 10 input and 1 output tokens.
+type fakeLLM struct {
+	script []llm.Response
+	calls  []llmCall
+}
+
+func reply(text string) llm.Response {
+	return llm.Response{Content: text}
+}
+
+func toolCall(id, name, arguments string) llm.ToolCall {
+	return llm.ToolCall{ID: id, Name: name, Arguments: json.RawMessage(arguments)}
+}
+
+func (f *fakeLLM) Chat(ctx context.Context, systemPrompt string, messages []llm.Message, opts llm.Options) (*llm.Response, error) {
+	// Later calls append to the slice, so keep a copy of what was sent.
+	sent := append([]llm.Message(nil), messages...)
+	f.calls = append(f.calls, llmCall{systemPrompt: systemPrompt, messages: sent, tools: opts.Tools})
+
+	if len(f.script) == 0 {
+		return nil, fmt.Errorf("unexpected LLM call %d", len(f.calls))
+	}
+	resp := f.script[0]
+	f.script = f.script[1:]
+	resp.Usage = llm.Usage{InputTokens: 10, OutputTokens: 1}
+	return &resp, nil
+}
+
+func (f *fakeLLM) ChatStream(ctx context.Context, systemPrompt string, messages []llm.Message, opts llm.Options, onDelta llm.DeltaFunc) (*llm.Response, error) {
+	resp, err := f.Chat(ctx, systemPrompt, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+	return resp, onDelta(resp.Content)
+}
+
+// newTestPipeline returns a pipeline over a default knowledge base holding
+// one document, notes.pdf, with a chunk about sleep and one about anxiety.
+func newTestPipeline(t *testing.T, client llm.Client) (*Pipeline, *storage.StorageService) {
+	t.Helper()
+	ctx := context.Background()
+
+	cfg := &config.Config{
+		EmbeddingModel: "fake-embedding",
+		ChunkStrategy:  "recursive",
+		ChunkSize:      500,
+		ChunkOverlap:   50,
+		VectorStore:    storage.VectorStoreEmbedded,
+		VectorDistance: string(storage.DistanceCosine),
+		DataDir:        t.TempDir(),
+	}
+
+	storageService, err := storage.NewStorageService(cfg.DataDir)
+	if err != nil {
+		t.Fatalf("NewStorageService failed: %v", err)
+	}
+	t.Cleanup(func() { storageService.Close() })
+
+	bases := knowledge.NewRegistry(cfg, storageService, knowledge.WithEmbedderFactory(func(kb *models.KnowledgeBase) (embeddings.Embedder, error) {
+		return fakeEmbedder{}, nil
+	}))
+	t.Cleanup(func() { bases.Close() })
+
+	base, err := bases.EnsureDefault(ctx)
+	if err != nil {
+		t.Fatalf("EnsureDefault failed: %v", err)
+	}
+
+	doc, err := storageService.StoreDocument(ctx, base.ID, "notes.pdf", strings.NewReader("%PDF-1.4 notes"), nil)
+	if err != nil {
+		t.Fatalf("StoreDocument failed: %v", err)
+	}
+	chunks := []string{
+		"Sleep hygiene means keeping a regular bedtime.",
+		"Grounding exercises help with anxiety.",
+	}
+	if err := base.Vectors.StoreDocumentChunks(ctx, doc.ID, chunks, [][]float32{{1, 0}, {1, 0}}, nil); err != nil {
+		t.Fatalf("StoreDocumentChunks failed: %v", err)
+	}
+
+	return NewPipeline(bases, client, WithHybridWeights(storage.HybridWeights{Vector: 0, Keyword: 1})), storageService
+}
+
+func TestAnswerWithoutHistoryDoesNotRewrite(t *testing.T) {
+	client := &fakeLLM{script: []llm.Response{reply("Keep a regular bedtime.")}}
+	pipeline, _ := newTestPipeline(t, client)
+
+	answer, err := pipeline.Answer(context.Background(), "What is sleep hygiene?", QueryOptions{})
+	if err != nil {
+		t.Fatalf("Answer failed: %v", err)
+	}
+
+	if len(client.calls) != 1 {
+		t.Fatalf("expected a single LLM call, got %d", len(client.calls))
+	}
+	if answer.Question != "What is sleep hygiene?" || answer.Response != "Keep a regular bedtime." {
+		t.Errorf("unexpected answer %+v", answer)
+	}
+}
+
+func TestAnswerRewritesFollowUp(t *testing.T) {
+	client := &fakeLLM{script: []llm.Response{
+		reply("How do grounding exercises help with anxiety?"),
+		reply("They bring attention to the present."),
+	}}
+	pipeline, _ := newTestPipeline(t, client)
+
+	history := []llm.Message{
+		{Role: llm.RoleUser, Content: "What helps with anxiety?"},
+		{Role: llm.RoleAssistant, Content: "Grounding exercises."},
+	}
+	answer, err := pipeline.Answer(context.Background(), "How do they work?", QueryOptions{History: history})
+	if err != nil {
+		t.Fatalf("Answer failed: %v", err)
+	}
+
+	if len(client.calls) != 2 {
+		t.Fatalf("expected a rewrite and an answer call, got %d", len(client.calls))
+	}
+
+	rewrite := client.calls[0]
+	if rewrite.systemPrompt != rewriteSystemPrompt || !strings.Contains(rewrite.messages[0].Content, "Assistant: Grounding exercises.") {
+		t.Errorf("expected the rewrite prompt to show the conversation, got %+v", rewrite)
+	}
+
+	if answer.Question != "How do grounding exercises help with anxiety?" {
+		t.Errorf("expected the rewritten question, got %q", answer.Question)
+	}
+	if len(answer.Sources) == 0 || answer.Sources[0].ChunkIndex != 1 {
+		t.Errorf("expected retrieval with the rewritten question to find the anxiety chunk, got %+v", answer.Sources)
+	}
+	if answer.Usage.InputTokens != 20 {
+		t.Errorf("expected usage of both calls, got %+v", answer.Usage)
+	}
+
+	messages := client.calls[1].messages
+	if len(messages) != 3 || messages[0].Content != history[0].Content || messages[1].Content != history[1].Content {
+		t.Fatalf("expected the history ahead of the question, got %+v", messages)
+	}
+	if !strings.Contains(messages[2].Content, "Question: How do they work?") {
+		t.Errorf("expected the prompt to ask the original question, got %q", messages[2].Content)
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	ctx := context.Background()
+	pipeline, storageService := newTestPipeline(t, &fakeLLM{})
+
+	negative := -1.0
+	err := pipeline.ValidateOptions(ctx, QueryOptions{VectorWeight: &negative})
+	if !errors.Is(err, storage.ErrInvalid) || err.Error() != "hybrid weights must not be negative" {
+		t.Errorf("expected bad weights in the ErrInvalid category with their message, got %v", err)
+	}
+
+	err = pipeline.ValidateOptions(ctx, QueryOptions{KnowledgeBaseIDs: []int{999}})
+	if !errors.Is(err, storage.ErrKnowledgeBaseNotFound) || errors.Is(err, storage.ErrInvalid) {
+		t.Errorf("expected ErrKnowledgeBaseNotFound, got %v", err)
+	}
+
+	// A stored knowledge base that cannot be opened is not the client's
+	// fault.
+	broken := models.KnowledgeBase{Name: "broken", EmbeddingModel: "fake-embedding", ChunkStrategy: "unknown", ChunkSize: 500}
+	if err := storageService.CreateKnowledgeBase(ctx, &broken); err != nil {
+		t.Fatalf("CreateKnowledgeBase failed: %v", err)
+	}
+	err = pipeline.ValidateOptions(ctx, QueryOptions{KnowledgeBaseIDs: []int{broken.ID}})
+	if err == nil || errors.Is(err, storage.ErrInvalid) || errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected an uncategorized error for a broken knowledge base, got %v", err)
+	}
+}
+
+func TestSearchMergesKnowledgeBasesBySimilarity(t *testing.T) {
+	ctx := context.Background()
+	pipeline, storageService := newTestPipeline(t, &fakeLLM{})
+
+	// The weak knowledge base holds a chunk unlike the query, which still
+	// is the best hit within that base.
+	weak := pipeline.bases.NewKnowledgeBase("weak")
+	if err := storageService.CreateKnowledgeBase(ctx, &weak); err != nil {
+		t.Fatalf("CreateKnowledgeBase failed: %v", err)
+	}
+	weakBase, err := pipeline.bases.Get(ctx, weak.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	doc, err := storageService.StoreDocument(ctx, weak.ID, "unrelated.pdf", strings.NewReader("%PDF-1.4 unrelated"), nil)
+	if err != nil {
+		t.Fatalf("StoreDocument failed: %v", err)
+	}
+	if err := weakBase.Vectors.StoreDocumentChunks(ctx, doc.ID, []string{"Tax returns are due in April."}, [][]float32{{0, 1}}, nil); err != nil {
+		t.Fatalf("StoreDocumentChunks failed: %v", err)
+	}
+
+	strongBase, err := pipeline.bases.Default(ctx)
+	if err != nil {
+		t.Fatalf("Default failed: %v", err)
+	}
+
+	weights := storage.HybridWeights{Vector: 1}
+	hits, err := pipeline.search(ctx, []*knowledge.Base{weakBase, strongBase}, "sleep", weights, 1, nil, 2)
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if len(hits) != 2 || hits[0].base != strongBase || hits[1].base != strongBase {
+		t.Errorf("expected both hits from the matching knowledge base, got %+v", hits)
+	}
+}
@@ -0,0 +1,74 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"rag-therapist/internal/llm"
+)
+
+const rewriteSystemPrompt = `You rewrite follow-up messages into standalone questions for a document search.
+Use the conversation to resolve references such as "it", "that one" or "the second one", so the question can be understood without the conversation.
+Keep the language and meaning of the follow-up. If it already stands on its own, return it unchanged.
+Reply with the question only.`
+
+const (
+	// rewriteMaxTokens bounds the rewritten question.
+	rewriteMaxTokens = 256
+	// rewriteTurnChars truncates each earlier turn shown to the rewriter;
+	// long answers add cost but rarely help resolve a reference.
+	rewriteTurnChars = 1000
+)
+
+// rewriteQuestion asks the LLM to turn a follow-up into a question that can
+// be searched for without the conversation history.
+func (p *Pipeline) rewriteQuestion(ctx context.Context, history []llm.Message, question string) (string, llm.Usage, error) {
+	prompt := buildRewritePrompt(history, question)
+
+	resp, err := p.llm.Chat(ctx, rewriteSystemPrompt, []llm.Message{
+		{Role: llm.RoleUser, Content: prompt},
+	}, llm.Options{MaxTokens: rewriteMaxTokens})
+	if err != nil {
+		return "", llm.Usage{}, fmt.Errorf("failed to rewrite follow-up question: %w", err)
+	}
+
+	standalone := strings.TrimSpace(resp.Content)
+	if standalone == "" {
+		standalone = question
+	}
+	return standalone, resp.Usage, nil
+}
+
+func buildRewritePrompt(history []llm.Message, question string) string {
+	var b strings.Builder
+
+	b.WriteString("Conversation:\n")
+	for _, msg := range history {
+		speaker := "User"
+		if msg.Role == llm.RoleAssistant {
+			speaker = "Assistant"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", speaker, truncate(msg.Content, rewriteTurnChars))
+	}
+
+	b.WriteString("\nFollow-up: ")
+	b.WriteString(question)
+
+	return b.String()
+}
+
+func truncate(text string, maxChars int) string {
+	runes := []rune(text)
+	if len(runes) <= maxChars {
+		return text
+	}
+	return string(runes[:maxChars]) + "..."
+}
+
+func addUsage(a, b llm.Usage) llm.Usage {
+	return llm.Usage{
+		InputTokens:  a.InputTokens + b.InputTokens,
+		OutputTokens: a.OutputTokens + b.OutputTokens,
+	}
+}
@@ -0,0 +1,602 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	chroma "github.com/amikos-tech/chroma-go"
+	chhttp "github.com/amikos-tech/chroma-go/pkg/commons/http"
+	"github.com/amikos-tech/chroma-go/types"
+)
+
+// chromaReconnectPolicy spaces out connection attempts while Chroma is
+// down, so requests fail fast instead of each waiting on the server.
+var chromaReconnectPolicy = RetryPolicy{BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+
+// ChromaVectorStore keeps chunks in a collection on a Chroma server. It
+// connects on first use and reconnects after Chroma goes away: while the
+// server is unreachable calls fail with ErrVectorStoreUnavailable, and a
+// collection lost in a restart is created again.
+type ChromaVectorStore struct {
+	client *chroma.Client
+	name   string
+	metric DistanceMetric
+
+	mu         sync.Mutex
+	collection *chroma.Collection
+	// dialing is closed when the connection attempt in progress, if any,
+	// is over. The attempt runs without holding mu.
+	dialing chan struct{}
+	// failures counts connection attempts failed in a row; the next one
+	// is not made before retryAt.
+	failures int
+	retryAt  time.Time
+	lastErr  error
+}
+
+// NewChromaVectorStore creates a client for the server at chromaURL. It
+// does not connect; EnsureCollection does.
+func NewChromaVectorStore(chromaURL string) (*ChromaVectorStore, error) {
+	client, err := chroma.NewClient(chroma.WithBasePath(chromaURL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create chroma client: %w", err)
+	}
+
+	return &ChromaVectorStore{
+		client: client,
+	}, nil
+}
+
+// EnsureCollection selects the named collection and opens it, creating it
+// with metric if it does not exist. The metric is recorded by Chroma in
+// the collection's hnsw:space metadata; an existing collection keeps the
+// metric it was created with, and a warning is logged if that is not
+// metric. If Chroma cannot be reached the error wraps
+// ErrVectorStoreUnavailable, and the store stays usable: it connects
+// again on a later call.
+func (vs *ChromaVectorStore) EnsureCollection(ctx context.Context, name string, metric DistanceMetric) error {
+	vs.mu.Lock()
+	vs.name = name
+	vs.metric = metric
+	vs.collection = nil
+	vs.failures = 0
+	vs.retryAt = time.Time{}
+	vs.mu.Unlock()
+
+	_, err := vs.connect(ctx)
+	return err
+}
+
+// connect returns the open collection, opening it first if needed. Only
+// one call dials at a time; the others wait for its outcome. After a
+// failed attempt it returns the last error until the backoff has passed.
+func (vs *ChromaVectorStore) connect(ctx context.Context) (*chroma.Collection, error) {
+	for {
+		vs.mu.Lock()
+		if vs.collection != nil {
+			collection := vs.collection
+			vs.mu.Unlock()
+			return collection, nil
+		}
+		if time.Now().Before(vs.retryAt) {
+			err := vs.lastErr
+			vs.mu.Unlock()
+			return nil, err
+		}
+		if dialing := vs.dialing; dialing != nil {
+			vs.mu.Unlock()
+			select {
+			case <-dialing:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		dialing := make(chan struct{})
+		vs.dialing = dialing
+		name, metric := vs.name, vs.metric
+		vs.mu.Unlock()
+
+		collection, err := vs.openCollection(ctx, name, metric)
+
+		vs.mu.Lock()
+		vs.dialing = nil
+		close(dialing)
+		switch {
+		case vs.name != name || vs.metric != metric:
+			// EnsureCollection selected another collection meanwhile.
+			vs.mu.Unlock()
+			continue
+		case err != nil && ctx.Err() != nil:
+			// The caller gave up; that says nothing about the server.
+		case err != nil:
+			vs.failed(err)
+		default:
+			if vs.failures > 0 {
+				slog.Info("Reconnected to chroma", "collection", name, "failed_attempts", vs.failures)
+			}
+			vs.collection = collection
+			vs.failures = 0
+			vs.retryAt = time.Time{}
+			vs.lastErr = nil
+		}
+		vs.mu.Unlock()
+		return collection, err
+	}
+}
+
+// failed records a failed connection attempt and schedules the next one.
+// The caller holds vs.mu.
+func (vs *ChromaVectorStore) failed(err error) {
+	vs.failures++
+	vs.retryAt = time.Now().Add(chromaReconnectPolicy.Backoff(vs.failures))
+	vs.lastErr = err
+	if vs.failures == 1 {
+		slog.Warn("Failed to open chroma collection, will retry", "collection", vs.name, "error", err)
+	}
+}
+
+func (vs *ChromaVectorStore) openCollection(ctx context.Context, name string, metric DistanceMetric) (*chroma.Collection, error) {
+	// Check if collection exists
+	collection, err := vs.client.GetCollection(ctx, name, nil)
+	if err != nil {
+		// Collection doesn't exist, create it
+		collection, err = vs.client.CreateCollection(ctx, name, nil, true, nil, types.DistanceFunction(metric))
+		if err != nil {
+			if chromaUnavailable(err) {
+				return nil, fmt.Errorf("%w: failed to open collection %s: %v", ErrVectorStoreUnavailable, name, err)
+			}
+			return nil, fmt.Errorf("failed to create collection %s: %w", name, err)
+		}
+	}
+
+	// The collection's distances and index only make sense for the metric
+	// it was created with, so that one is used.
+	existing, err := collectionMetric(collection)
+	if err != nil {
+		return nil, err
+	}
+	if existing != metric {
+		slog.Warn("Collection uses a different distance metric than configured, keeping it",
+			"collection", name, "distance", existing, "configured", metric)
+	}
+
+	return collection, nil
+}
+
+// collectionMetric returns the distance metric collection is indexed with.
+// Chroma defaults to l2 when no space was given.
+func collectionMetric(collection *chroma.Collection) (DistanceMetric, error) {
+	space, _ := collection.Metadata[types.HNSWSpace].(string)
+	metric, err := types.ToDistanceFunction(space)
+	if err != nil {
+		return "", fmt.Errorf("collection %s has an unsupported distance metric: %w", collection.Name, err)
+	}
+	return DistanceMetric(metric), nil
+}
+
+// chromaUnavailable reports whether err means Chroma did not handle the
+// request: no response at all, or a server error. Any other response is
+// Chroma refusing the request, e.g. an invalid collection name.
+func chromaUnavailable(err error) bool {
+	var chromaErr *chhttp.ChromaError
+	if !errors.As(err, &chromaErr) {
+		return true
+	}
+	return chromaErr.ErrorCode == 0 || chromaErr.ErrorCode >= http.StatusInternalServerError
+}
+
+// withCollection runs op on the open collection. When op fails in a way
+// that suggests the server or the collection is gone, Chroma is asked
+// whether it is still up. If it is not, the collection is closed and the
+// error wraps ErrVectorStoreUnavailable. If it is, the collection is
+// opened again and, should it have been recreated after a restart, op is
+// retried once on the new one. Other errors, such as a rejected filter,
+// are returned as they are.
+func (vs *ChromaVectorStore) withCollection(ctx context.Context, op func(collection *chroma.Collection) error) error {
+	collection, err := vs.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	opErr := op(collection)
+	if opErr == nil || ctx.Err() != nil || !needsReconnect(opErr) {
+		return opErr
+	}
+
+	if _, err := vs.client.Heartbeat(ctx); err != nil {
+		vs.disconnect(collection, err)
+		return fmt.Errorf("%w: %v", ErrVectorStoreUnavailable, opErr)
+	}
+
+	vs.disconnect(collection, nil)
+	reopened, err := vs.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if reopened.ID == collection.ID {
+		return opErr
+	}
+	return op(reopened)
+}
+
+// needsReconnect reports whether err from an operation means that Chroma
+// or the collection may be gone: no response at all, an unavailable
+// response, or a collection Chroma no longer knows.
+func needsReconnect(err error) bool {
+	var chromaErr *chhttp.ChromaError
+	if !errors.As(err, &chromaErr) {
+		return false
+	}
+
+	switch chromaErr.ErrorCode {
+	case 0, http.StatusNotFound, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return chromaErr.ErrorID == "NotFoundError" || chromaErr.ErrorID == "InvalidCollection"
+}
+
+// disconnect closes collection unless it was replaced meanwhile. A non-nil
+// cause counts as a failed connection attempt.
+func (vs *ChromaVectorStore) disconnect(collection *chroma.Collection, cause error) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	if vs.collection != collection {
+		return
+	}
+	vs.collection = nil
+	if cause != nil {
+		vs.failed(fmt.Errorf("%w: %v", ErrVectorStoreUnavailable, cause))
+	}
+}
+
+func (vs *ChromaVectorStore) AddChunks(ctx context.Context, chunks []DocumentChunk, embeddings [][]float32) error {
+	if len(chunks) != len(embeddings) {
+		return fmt.Errorf("chunks and embeddings length mismatch: %d vs %d", len(chunks), len(embeddings))
+	}
+
+	var ids []string
+	var documents []string
+	var metadatas []map[string]interface{}
+	var embeddingsList [][]float32
+
+	for i, chunk := range chunks {
+		ids = append(ids, chunk.ID)
+		documents = append(documents, chunk.Content)
+
+		// Convert metadata to interface{} map
+		metadata := make(map[string]interface{})
+		metadata["document_id"] = strconv.Itoa(chunk.DocumentID)
+		metadata["chunk_index"] = strconv.Itoa(chunk.ChunkIndex)
+
+		// Add custom metadata. Page ranges and upload times are stored as
+		// numbers so that SearchFilter can compare them.
+		for k, v := range chunk.Metadata {
+			metadata[k] = chromaMetadataValue(k, v)
+		}
+
+		metadatas = append(metadatas, metadata)
+		embeddingsList = append(embeddingsList, embeddings[i])
+	}
+
+	// Convert embeddings to proper type
+	chromaEmbeddings := types.NewEmbeddingsFromFloat32(embeddingsList)
+
+	err := vs.withCollection(ctx, func(collection *chroma.Collection) error {
+		_, err := collection.Add(ctx, chromaEmbeddings, metadatas, documents, ids)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add chunks to collection: %w", err)
+	}
+
+	return nil
+}
+
+func (vs *ChromaVectorStore) SearchSimilar(ctx context.Context, queryEmbedding []float32, limit int, filter *SearchFilter) ([]SearchResult, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+
+	// Convert embedding to proper type
+	embedding := types.NewEmbeddingFromFloat32(queryEmbedding)
+
+	options := []types.CollectionQueryOption{
+		types.WithQueryEmbedding(embedding),
+		types.WithNResults(int32(limit)),
+		types.WithInclude(types.IDocuments, types.IMetadatas, types.IDistances),
+	}
+	if where := filter.chromaWhere(); where != nil {
+		options = append(options, types.WithWhereMap(where))
+	}
+
+	var results *chroma.QueryResults
+	var metric DistanceMetric
+	err := vs.withCollection(ctx, func(collection *chroma.Collection) error {
+		var err error
+		if metric, err = collectionMetric(collection); err != nil {
+			return err
+		}
+		results, err = collection.QueryWithOptions(ctx, options...)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query collection: %w", err)
+	}
+
+	var searchResults []SearchResult
+
+	if len(results.Documents) == 0 || len(results.Documents[0]) == 0 {
+		return searchResults, nil
+	}
+
+	for i := 0; i < len(results.Documents[0]); i++ {
+		var documentID int
+		var chunkIndex int
+		var metadata map[string]string
+
+		if len(results.Metadatas) > 0 && len(results.Metadatas[0]) > i {
+			meta := results.Metadatas[0][i]
+			metadata = make(map[string]string)
+
+			if docIDStr, ok := meta["document_id"].(string); ok {
+				if docID, err := strconv.Atoi(docIDStr); err == nil {
+					documentID = docID
+				}
+			}
+
+			if chunkIndexStr, ok := meta["chunk_index"].(string); ok {
+				if chunkIdx, err := strconv.Atoi(chunkIndexStr); err == nil {
+					chunkIndex = chunkIdx
+				}
+			}
+
+			// Extract other metadata
+			for k, v := range meta {
+				if k != "document_id" && k != "chunk_index" {
+					if strVal, ok := chromaMetadataString(v); ok {
+						metadata[k] = strVal
+					}
+				}
+			}
+		}
+
+		var score float32
+		if len(results.Distances) > 0 && len(results.Distances[0]) > i {
+			// Convert distance to a 0..1 similarity score (lower distance = higher similarity)
+			score = metric.Similarity(results.Distances[0][i])
+		}
+
+		searchResult := SearchResult{
+			ID:         results.Ids[0][i],
+			Content:    results.Documents[0][i],
+			DocumentID: documentID,
+			ChunkIndex: chunkIndex,
+			Score:      score,
+			Metadata:   metadata,
+		}
+
+		searchResults = append(searchResults, searchResult)
+	}
+
+	return searchResults, nil
+}
+
+// chromaMetadataString converts a metadata value read back from Chroma to
+// the string form used in DocumentChunk.Metadata. Numbers arrive as
+// float64 after JSON decoding.
+func chromaMetadataString(v interface{}) (string, bool) {
+	switch value := v.(type) {
+	case string:
+		return value, true
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(value), true
+	case bool:
+		return strconv.FormatBool(value), true
+	}
+	return "", false
+}
+
+// GetChunks looks the chunks up by metadata. document_id and chunk_index
+// are stored as strings, so the range is matched as a list of indexes.
+func (vs *ChromaVectorStore) GetChunks(ctx context.Context, documentID, fromIndex, toIndex int) ([]DocumentChunk, error) {
+	if toIndex < fromIndex {
+		return nil, nil
+	}
+
+	indexes := make([]interface{}, 0, toIndex-fromIndex+1)
+	for i := fromIndex; i <= toIndex; i++ {
+		indexes = append(indexes, strconv.Itoa(i))
+	}
+	where := map[string]interface{}{
+		"$and": []interface{}{
+			map[string]interface{}{"document_id": strconv.Itoa(documentID)},
+			map[string]interface{}{"chunk_index": map[string]interface{}{"$in": indexes}},
+		},
+	}
+
+	var results *chroma.GetResults
+	err := vs.withCollection(ctx, func(collection *chroma.Collection) error {
+		var err error
+		results, err = collection.GetWithOptions(ctx,
+			types.WithWhereMap(where),
+			types.WithInclude(types.IDocuments, types.IMetadatas),
+		)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chunks: %w", err)
+	}
+
+	var chunks []DocumentChunk
+	for i, id := range results.Ids {
+		chunk := DocumentChunk{ID: id, DocumentID: documentID, Metadata: make(map[string]string)}
+		if i < len(results.Documents) {
+			chunk.Content = results.Documents[i]
+		}
+		if i < len(results.Metadatas) {
+			for k, v := range results.Metadatas[i] {
+				strVal, ok := chromaMetadataString(v)
+				if !ok {
+					continue
+				}
+				switch k {
+				case "document_id":
+				case "chunk_index":
+					chunk.ChunkIndex, _ = strconv.Atoi(strVal)
+				default:
+					chunk.Metadata[k] = strVal
+				}
+			}
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].ChunkIndex < chunks[j].ChunkIndex
+	})
+	return chunks, nil
+}
+
+// GetEmbeddings fetches the embeddings by ID; query results do not
+// include them.
+func (vs *ChromaVectorStore) GetEmbeddings(ctx context.Context, chunkIDs []string) (map[string][]float32, error) {
+	if len(chunkIDs) == 0 {
+		return nil, nil
+	}
+
+	var results *chroma.GetResults
+	err := vs.withCollection(ctx, func(collection *chroma.Collection) error {
+		var err error
+		results, err = collection.GetWithOptions(ctx,
+			types.WithIds(chunkIDs),
+			types.WithInclude(types.IEmbeddings),
+		)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get embeddings: %w", err)
+	}
+
+	embeddings := make(map[string][]float32, len(results.Ids))
+	for i, id := range results.Ids {
+		if i >= len(results.Embeddings) || results.Embeddings[i] == nil {
+			continue
+		}
+		if values := results.Embeddings[i].GetFloat32(); values != nil {
+			embeddings[id] = *values
+		}
+	}
+	return embeddings, nil
+}
+
+func (vs *ChromaVectorStore) DeleteChunks(ctx context.Context, chunkIDs []string) error {
+	err := vs.withCollection(ctx, func(collection *chroma.Collection) error {
+		_, err := collection.Delete(ctx, chunkIDs, nil, nil)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete chunks: %w", err)
+	}
+
+	return nil
+}
+
+func (vs *ChromaVectorStore) DeleteByDocumentID(ctx context.Context, documentID int) error {
+	where := map[string]interface{}{
+		"document_id": strconv.Itoa(documentID),
+	}
+
+	err := vs.withCollection(ctx, func(collection *chroma.Collection) error {
+		_, err := collection.Delete(ctx, nil, where, nil)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete chunks by document ID: %w", err)
+	}
+
+	return nil
+}
+
+// Heartbeat checks that Chroma is up and the collection open. A
+// successful heartbeat skips the reconnect backoff, so the collection is
+// reopened as soon as Chroma is back.
+func (vs *ChromaVectorStore) Heartbeat(ctx context.Context) error {
+	if _, err := vs.client.Heartbeat(ctx); err != nil {
+		vs.mu.Lock()
+		if vs.collection != nil {
+			vs.collection = nil
+			vs.failed(fmt.Errorf("%w: %v", ErrVectorStoreUnavailable, err))
+		}
+		vs.mu.Unlock()
+		return fmt.Errorf("%w: chroma heartbeat failed: %v", ErrVectorStoreUnavailable, err)
+	}
+
+	vs.mu.Lock()
+	vs.retryAt = time.Time{}
+	vs.mu.Unlock()
+
+	_, err := vs.connect(ctx)
+	return err
+}
+
+func (vs *ChromaVectorStore) GetCollectionInfo(ctx context.Context) (map[string]interface{}, error) {
+	var count int32
+	var metric DistanceMetric
+	err := vs.withCollection(ctx, func(collection *chroma.Collection) error {
+		var err error
+		if metric, err = collectionMetric(collection); err != nil {
+			return err
+		}
+		count, err = collection.Count(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection count: %w", err)
+	}
+
+	info := map[string]interface{}{
+		"name":     vs.name,
+		"count":    count,
+		"distance": string(metric),
+	}
+
+	return info, nil
+}
+
+func (vs *ChromaVectorStore) DeleteCollection(ctx context.Context, collectionName string) error {
+	_, err := vs.client.DeleteCollection(ctx, collectionName)
+	if err != nil {
+		return fmt.Errorf("failed to delete collection: %w", err)
+	}
+
+	return nil
+}
+
+func (vs *ChromaVectorStore) Drop(ctx context.Context) error {
+	if err := vs.DeleteCollection(ctx, vs.name); err != nil {
+		return err
+	}
+
+	vs.mu.Lock()
+	vs.collection = nil
+	vs.mu.Unlock()
+	return nil
+}
+
+// Close is a no-op; the Chroma client holds no resources that need
+// releasing.
+func (vs *ChromaVectorStore) Close() error {
+	return nil
+}
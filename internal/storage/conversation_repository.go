@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"rag-therapist/pkg/models"
+)
+
+var ErrConversationNotFound = newError(ErrNotFound, "conversation not found")
+
+const conversationColumns = `c.id, c.title, (SELECT COUNT(*) FROM messages m WHERE m.conversation_id = c.id), c.created_at, c.updated_at`
+
+const messageColumns = `id, conversation_id, role, content, standalone_question, sources, citations, created_at`
+
+type ConversationRepository struct {
+	db *Database
+}
+
+func NewConversationRepository(db *Database) *ConversationRepository {
+	return &ConversationRepository{db: db}
+}
+
+func (r *ConversationRepository) Insert(ctx context.Context, conv *models.Conversation) error {
+	now := time.Now().UTC()
+	result, err := r.db.db.ExecContext(ctx, `
+		INSERT INTO conversations (title, created_at, updated_at)
+		VALUES (?, ?, ?)
+	`, conv.Title, now, now)
+	if err != nil {
+		return dbError("failed to insert conversation", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return dbError("failed to get last insert id", err)
+	}
+
+	conv.ID = int(id)
+	conv.MessageCount = 0
+	conv.CreatedAt = now
+	conv.UpdatedAt = now
+	return nil
+}
+
+func (r *ConversationRepository) GetByID(ctx context.Context, id int) (*models.Conversation, error) {
+	row := r.db.db.QueryRowContext(ctx, `SELECT `+conversationColumns+` FROM conversations c WHERE c.id = ?`, id)
+
+	conv, err := scanConversation(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, dbError("failed to scan conversation", err)
+	}
+	return conv, nil
+}
+
+// List returns a page of conversations, most recently active first.
+func (r *ConversationRepository) List(ctx context.Context, limit, offset int) ([]*models.Conversation, error) {
+	rows, err := r.db.db.QueryContext(ctx, `
+		SELECT `+conversationColumns+`
+		FROM conversations c
+		ORDER BY c.updated_at DESC, c.id DESC
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, dbError("failed to query conversations", err)
+	}
+	defer rows.Close()
+
+	var conversations []*models.Conversation
+	for rows.Next() {
+		conv, err := scanConversation(rows)
+		if err != nil {
+			return nil, dbError("failed to scan conversation", err)
+		}
+		conversations = append(conversations, conv)
+	}
+
+	return conversations, rows.Err()
+}
+
+func (r *ConversationRepository) Count(ctx context.Context) (int, error) {
+	var count int
+	if err := r.db.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM conversations`).Scan(&count); err != nil {
+		return 0, dbError("failed to count conversations", err)
+	}
+	return count, nil
+}
+
+func (r *ConversationRepository) Rename(ctx context.Context, id int, title string) error {
+	result, err := r.db.db.ExecContext(ctx, `UPDATE conversations SET title = ?, updated_at = ? WHERE id = ?`, title, time.Now().UTC(), id)
+	if err != nil {
+		return dbError("failed to rename conversation", err)
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrConversationNotFound
+	}
+	return nil
+}
+
+// Delete removes a conversation together with its messages.
+func (r *ConversationRepository) Delete(ctx context.Context, id int) error {
+	result, err := r.db.db.ExecContext(ctx, `DELETE FROM conversations WHERE id = ?`, id)
+	if err != nil {
+		return dbError("failed to delete conversation", err)
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrConversationNotFound
+	}
+	return nil
+}
+
+// AddMessages appends messages to a conversation in one transaction and
+// marks the conversation as updated.
+func (r *ConversationRepository) AddMessages(ctx context.Context, conversationID int, messages ...*models.Message) error {
+	tx, err := r.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError("failed to begin message insert", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	result, err := tx.ExecContext(ctx, `UPDATE conversations SET updated_at = ? WHERE id = ?`, now, conversationID)
+	if err != nil {
+		return dbError("failed to update conversation", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrConversationNotFound
+	}
+
+	for _, msg := range messages {
+		sources, err := encodeMessageSources(msg.Sources)
+		if err != nil {
+			return err
+		}
+		citations, err := encodeMessageCitations(msg.Citations)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO messages (conversation_id, role, content, standalone_question, sources, citations, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, conversationID, msg.Role, msg.Content, msg.StandaloneQuestion, sources, citations, now)
+		if err != nil {
+			return dbError("failed to insert message", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return dbError("failed to get last insert id", err)
+		}
+
+		msg.ID = int(id)
+		msg.ConversationID = conversationID
+		msg.CreatedAt = now
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dbError("failed to commit message insert", err)
+	}
+	return nil
+}
+
+// ListMessages returns the last limit messages of a conversation, oldest
+// first. A limit of 0 returns all of them.
+func (r *ConversationRepository) ListMessages(ctx context.Context, conversationID, limit int) ([]*models.Message, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := r.db.db.QueryContext(ctx, `
+		SELECT `+messageColumns+` FROM (
+			SELECT `+messageColumns+` FROM messages
+			WHERE conversation_id = ?
+			ORDER BY id DESC
+			LIMIT ?
+		) ORDER BY id ASC
+	`, conversationID, limit)
+	if err != nil {
+		return nil, dbError("failed to query messages", err)
+	}
+	defer rows.Close()
+
+	var messages []*models.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, dbError("failed to scan message", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+func scanConversation(row rowScanner) (*models.Conversation, error) {
+	var conv models.Conversation
+
+	if err := row.Scan(&conv.ID, &conv.Title, &conv.MessageCount, &conv.CreatedAt, &conv.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	return &conv, nil
+}
+
+func scanMessage(row rowScanner) (*models.Message, error) {
+	var msg models.Message
+	var sources, citations string
+
+	err := row.Scan(&msg.ID, &msg.ConversationID, &msg.Role, &msg.Content, &msg.StandaloneQuestion, &sources, &citations, &msg.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(sources), &msg.Sources); err != nil {
+		return nil, fmt.Errorf("failed to decode message sources: %w", err)
+	}
+	if len(msg.Sources) == 0 {
+		msg.Sources = nil
+	}
+	if err := json.Unmarshal([]byte(citations), &msg.Citations); err != nil {
+		return nil, fmt.Errorf("failed to decode message citations: %w", err)
+	}
+	if len(msg.Citations) == 0 {
+		msg.Citations = nil
+	}
+
+	return &msg, nil
+}
+
+func encodeMessageSources(sources []models.MessageSource) (string, error) {
+	if sources == nil {
+		sources = []models.MessageSource{}
+	}
+	encoded, err := json.Marshal(sources)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode message sources: %w", err)
+	}
+	return string(encoded), nil
+}
+
+func encodeMessageCitations(citations []models.Citation) (string, error) {
+	if citations == nil {
+		citations = []models.Citation{}
+	}
+	encoded, err := json.Marshal(citations)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode message citations: %w", err)
+	}
+	return string(encoded), nil
+}
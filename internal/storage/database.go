@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"path/filepath"
@@ -12,45 +13,101 @@ type Database struct {
 	db *sql.DB
 }
 
+// querier is implemented by both *sql.DB and *sql.Tx, so a repository
+// method can run on its own or inside a caller's transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// NewDatabase opens the database and applies any pending migrations.
 func NewDatabase(dataDir string) (*Database, error) {
+	database, err := OpenDatabase(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := database.Migrate(); err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	return database, nil
+}
+
+// OpenDatabase opens the database without migrating it. It fails with
+// ErrSchemaTooNew if the schema was written by a newer version of the
+// application.
+func OpenDatabase(dataDir string) (*Database, error) {
 	dbPath := filepath.Join(dataDir, "rag-therapist.db")
-	
-	db, err := sql.Open("sqlite", dbPath)
+
+	// WAL lets readers proceed while a worker writes, and the busy timeout
+	// makes concurrent writers wait for the lock instead of failing with
+	// "database is locked".
+	dsn := dbPath + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	database := &Database{db: db}
-	
-	if err := database.createTables(); err != nil {
-		return nil, fmt.Errorf("failed to create tables: %w", err)
+
+	if err := database.initSchemaVersion(); err != nil {
+		db.Close()
+		return nil, err
 	}
 
 	return database, nil
 }
 
-func (d *Database) createTables() error {
-	query := `
-	CREATE TABLE IF NOT EXISTS documents (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		file_name TEXT NOT NULL,
-		file_path TEXT NOT NULL UNIQUE,
-		file_size INTEGER NOT NULL,
-		content_hash TEXT NOT NULL,
-		uploaded_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		processed_at DATETIME,
-		status TEXT NOT NULL DEFAULT 'pending'
-	);
+func (d *Database) tableExists(table string) (bool, error) {
+	var count int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	return count > 0, nil
+}
+
+func (d *Database) columnExists(table, column string) (bool, error) {
+	var count int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	return count > 0, nil
+}
+
+// Ping checks that the database file can be queried.
+func (d *Database) Ping(ctx context.Context) error {
+	var one int
+	if err := d.db.QueryRowContext(ctx, `SELECT 1`).Scan(&one); err != nil {
+		return fmt.Errorf("failed to query database: %w", err)
+	}
+	return nil
+}
 
-	CREATE INDEX IF NOT EXISTS idx_documents_status ON documents(status);
-	CREATE INDEX IF NOT EXISTS idx_documents_uploaded_at ON documents(uploaded_at);
-	CREATE INDEX IF NOT EXISTS idx_documents_content_hash ON documents(content_hash);
-	`
+// inTx runs fn in a transaction and commits it if fn succeeds. Errors
+// from fn are returned unchanged.
+func (d *Database) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError("failed to begin transaction", err)
+	}
+	defer tx.Rollback()
 
-	_, err := d.db.Exec(query)
-	return err
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dbError("failed to commit transaction", err)
+	}
+	return nil
 }
 
 func (d *Database) Close() error {
 	return d.db.Close()
-}
\ No newline at end of file
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DistanceMetric is the distance function a collection is indexed with.
+// Distances follow Chroma's definitions so both backends agree:
+//
+//	cosine  1 - cos(a, b)     in [0, 2]
+//	l2      squared L2 |a-b|² in [0, ∞)
+//	ip      1 - a·b           in [0, 2] for unit vectors
+type DistanceMetric string
+
+const (
+	DistanceCosine       DistanceMetric = "cosine"
+	DistanceL2           DistanceMetric = "l2"
+	DistanceInnerProduct DistanceMetric = "ip"
+)
+
+func ParseDistanceMetric(s string) (DistanceMetric, error) {
+	switch metric := DistanceMetric(strings.ToLower(strings.TrimSpace(s))); metric {
+	case DistanceCosine, DistanceL2, DistanceInnerProduct:
+		return metric, nil
+	default:
+		return "", fmt.Errorf("unknown distance metric %q (expected %q, %q or %q)", s, DistanceCosine, DistanceL2, DistanceInnerProduct)
+	}
+}
+
+// Similarity converts a distance into a similarity in [0, 1], where 1 is
+// an exact match:
+//
+//	cosine  1 - d/2, i.e. (1 + cos) / 2
+//	l2      1 / (1 + d)
+//	ip      1 - d/2, i.e. (1 + a·b) / 2, clamped for non-unit vectors
+//
+// For unit-length embeddings such as OpenAI's, cosine and ip give the same
+// value.
+func (m DistanceMetric) Similarity(distance float32) float32 {
+	var similarity float32
+	switch m {
+	case DistanceL2:
+		similarity = 1 / (1 + distance)
+	default:
+		similarity = 1 - distance/2
+	}
+
+	return float32(math.Max(0, math.Min(1, float64(similarity))))
+}
+
+// distance computes the metric between two vectors of equal length.
+func (m DistanceMetric) distance(a, b []float32) float32 {
+	switch m {
+	case DistanceL2:
+		var sum float32
+		for i := range a {
+			d := a[i] - b[i]
+			sum += d * d
+		}
+		return sum
+
+	case DistanceInnerProduct:
+		return 1 - dot(a, b)
+
+	default:
+		normA, normB := math.Sqrt(float64(dot(a, a))), math.Sqrt(float64(dot(b, b)))
+		if normA == 0 || normB == 0 {
+			return 1
+		}
+		return 1 - float32(float64(dot(a, b))/(normA*normB))
+	}
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
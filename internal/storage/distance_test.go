@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistanceSimilarityRange(t *testing.T) {
+	vectors := [][]float32{{1, 0}, {0, 1}, {-1, 0}, {3, 4}, {-20, 7}}
+
+	for _, metric := range []DistanceMetric{DistanceCosine, DistanceL2, DistanceInnerProduct} {
+		for _, a := range vectors {
+			for _, b := range vectors {
+				similarity := metric.Similarity(metric.distance(a, b))
+				if similarity < 0 || similarity > 1 || math.IsNaN(float64(similarity)) {
+					t.Errorf("%s similarity of %v and %v is %v, expected 0..1", metric, a, b, similarity)
+				}
+			}
+		}
+	}
+}
+
+func TestDistanceSimilarityValues(t *testing.T) {
+	tests := []struct {
+		metric DistanceMetric
+		a, b   []float32
+		want   float32
+	}{
+		{DistanceCosine, []float32{1, 0}, []float32{2, 0}, 1},
+		{DistanceCosine, []float32{1, 0}, []float32{0, 1}, 0.5},
+		{DistanceCosine, []float32{1, 0}, []float32{-1, 0}, 0},
+		{DistanceL2, []float32{1, 0}, []float32{1, 0}, 1},
+		{DistanceL2, []float32{1, 0}, []float32{0, 1}, 1.0 / 3},
+		{DistanceInnerProduct, []float32{1, 0}, []float32{1, 0}, 1},
+		{DistanceInnerProduct, []float32{1, 0}, []float32{0, 1}, 0.5},
+	}
+
+	for _, tt := range tests {
+		got := tt.metric.Similarity(tt.metric.distance(tt.a, tt.b))
+		if math.Abs(float64(got-tt.want)) > 1e-6 {
+			t.Errorf("%s similarity of %v and %v = %v, expected %v", tt.metric, tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestParseDistanceMetric(t *testing.T) {
+	if metric, err := ParseDistanceMetric(" Cosine "); err != nil || metric != DistanceCosine {
+		t.Errorf("expected cosine, got %q, %v", metric, err)
+	}
+	if _, err := ParseDistanceMetric("manhattan"); err == nil {
+		t.Error("expected an error for an unknown metric")
+	}
+}
@@ -1,13 +1,25 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"rag-therapist/pkg/models"
 )
 
+var ErrDocumentNotFound = newError(ErrNotFound, "document not found")
+
+// ErrDuplicateDocument is returned when a file is uploaded to a knowledge
+// base that already holds it.
+var ErrDuplicateDocument = newError(ErrDuplicate, "document already uploaded to this knowledge base")
+
+// ErrDocumentProcessing is returned when a document cannot be deleted
+// because a worker is processing it.
+var ErrDocumentProcessing = newError(ErrConflict, "document is currently being processed")
+
 type DocumentRepository struct {
 	db *Database
 }
@@ -16,160 +28,295 @@ func NewDocumentRepository(db *Database) *DocumentRepository {
 	return &DocumentRepository{db: db}
 }
 
-func (r *DocumentRepository) Insert(doc *models.Document) error {
+// Insert adds doc and sets its ID. A document with the same content in
+// the same knowledge base is refused with ErrDuplicateDocument.
+func (r *DocumentRepository) Insert(ctx context.Context, doc *models.Document) error {
+	return r.insert(ctx, r.db.db, doc)
+}
+
+// InsertTx is Insert as part of the transaction tx.
+func (r *DocumentRepository) InsertTx(ctx context.Context, tx *sql.Tx, doc *models.Document) error {
+	return r.insert(ctx, tx, doc)
+}
+
+func (r *DocumentRepository) insert(ctx context.Context, q querier, doc *models.Document) error {
 	query := `
-		INSERT INTO documents (file_name, file_path, file_size, content_hash, uploaded_at, status)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO documents (knowledge_base_id, file_name, file_path, file_size, content_hash, uploaded_at, status, tags)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`
+
+	tags, err := encodeTags(doc.Tags)
+	if err != nil {
+		return err
+	}
 	
-	result, err := r.db.db.Exec(query, doc.FileName, doc.FilePath, doc.FileSize, doc.ContentHash, doc.UploadedAt, doc.Status)
+	result, err := q.ExecContext(ctx, query, doc.KnowledgeBaseID, doc.FileName, doc.FilePath, doc.FileSize, doc.ContentHash, doc.UploadedAt, doc.Status, tags)
 	if err != nil {
-		return fmt.Errorf("failed to insert document: %w", err)
+		if isUniqueViolation(err) {
+			return ErrDuplicateDocument
+		}
+		return dbError("failed to insert document", err)
 	}
 
 	id, err := result.LastInsertId()
 	if err != nil {
-		return fmt.Errorf("failed to get last insert id: %w", err)
+		return dbError("failed to get last insert id", err)
 	}
 
 	doc.ID = int(id)
 	return nil
 }
 
-func (r *DocumentRepository) GetByID(id int) (*models.Document, error) {
+func (r *DocumentRepository) GetByID(ctx context.Context, id int) (*models.Document, error) {
 	query := `
-		SELECT id, file_name, file_path, file_size, content_hash, uploaded_at, processed_at, status
+		SELECT id, knowledge_base_id, file_name, file_path, file_size, content_hash, uploaded_at, processed_at, status, error_message, tags
 		FROM documents WHERE id = ?
 	`
 	
-	row := r.db.db.QueryRow(query, id)
+	row := r.db.db.QueryRowContext(ctx, query, id)
 	
-	var doc models.Document
-	var processedAt sql.NullTime
-	
-	err := row.Scan(&doc.ID, &doc.FileName, &doc.FilePath, &doc.FileSize, &doc.ContentHash, &doc.UploadedAt, &processedAt, &doc.Status)
+	doc, err := scanDocument(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("document not found")
+			return nil, ErrDocumentNotFound
 		}
-		return nil, fmt.Errorf("failed to scan document: %w", err)
-	}
-
-	if processedAt.Valid {
-		doc.ProcessedAt = &processedAt.Time
+		return nil, dbError("failed to scan document", err)
 	}
 
-	return &doc, nil
+	return doc, nil
 }
 
-func (r *DocumentRepository) GetByContentHash(hash string) (*models.Document, error) {
+// GetByContentHash finds a file already uploaded to a knowledge base.
+func (r *DocumentRepository) GetByContentHash(ctx context.Context, hash string, knowledgeBaseID int) (*models.Document, error) {
 	query := `
-		SELECT id, file_name, file_path, file_size, content_hash, uploaded_at, processed_at, status
-		FROM documents WHERE content_hash = ?
+		SELECT id, knowledge_base_id, file_name, file_path, file_size, content_hash, uploaded_at, processed_at, status, error_message, tags
+		FROM documents WHERE content_hash = ? AND knowledge_base_id = ?
 	`
 	
-	row := r.db.db.QueryRow(query, hash)
+	row := r.db.db.QueryRowContext(ctx, query, hash, knowledgeBaseID)
 	
-	var doc models.Document
-	var processedAt sql.NullTime
-	
-	err := row.Scan(&doc.ID, &doc.FileName, &doc.FilePath, &doc.FileSize, &doc.ContentHash, &doc.UploadedAt, &processedAt, &doc.Status)
+	doc, err := scanDocument(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("document not found")
+			return nil, ErrDocumentNotFound
 		}
-		return nil, fmt.Errorf("failed to scan document: %w", err)
+		return nil, dbError("failed to scan document", err)
 	}
 
-	if processedAt.Valid {
-		doc.ProcessedAt = &processedAt.Time
-	}
-
-	return &doc, nil
+	return doc, nil
 }
 
-func (r *DocumentRepository) List(limit, offset int) ([]*models.Document, error) {
+// List returns a page of documents, newest first. A knowledgeBaseID of 0
+// lists documents from all knowledge bases.
+func (r *DocumentRepository) List(ctx context.Context, knowledgeBaseID, limit, offset int) ([]*models.Document, error) {
 	query := `
-		SELECT id, file_name, file_path, file_size, content_hash, uploaded_at, processed_at, status
-		FROM documents ORDER BY uploaded_at DESC LIMIT ? OFFSET ?
+		SELECT id, knowledge_base_id, file_name, file_path, file_size, content_hash, uploaded_at, processed_at, status, error_message, tags
+		FROM documents WHERE ? = 0 OR knowledge_base_id = ? ORDER BY uploaded_at DESC LIMIT ? OFFSET ?
 	`
 	
-	rows, err := r.db.db.Query(query, limit, offset)
+	rows, err := r.db.db.QueryContext(ctx, query, knowledgeBaseID, knowledgeBaseID, limit, offset)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query documents: %w", err)
+		return nil, dbError("failed to query documents", err)
 	}
 	defer rows.Close()
 
 	var documents []*models.Document
 	for rows.Next() {
-		var doc models.Document
-		var processedAt sql.NullTime
-		
-		err := rows.Scan(&doc.ID, &doc.FileName, &doc.FilePath, &doc.FileSize, &doc.ContentHash, &doc.UploadedAt, &processedAt, &doc.Status)
+		doc, err := scanDocument(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan document: %w", err)
-		}
-
-		if processedAt.Valid {
-			doc.ProcessedAt = &processedAt.Time
+			return nil, dbError("failed to scan document", err)
 		}
 
-		documents = append(documents, &doc)
+		documents = append(documents, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError("failed to read documents", err)
 	}
 
 	return documents, nil
 }
 
-func (r *DocumentRepository) UpdateStatus(id int, status string, processedAt *time.Time) error {
-	query := `UPDATE documents SET status = ?, processed_at = ? WHERE id = ?`
+// Count counts the documents in a knowledge base, or in all of them when
+// knowledgeBaseID is 0.
+func (r *DocumentRepository) Count(ctx context.Context, knowledgeBaseID int) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM documents WHERE ? = 0 OR knowledge_base_id = ?`
+	if err := r.db.db.QueryRowContext(ctx, query, knowledgeBaseID, knowledgeBaseID).Scan(&count); err != nil {
+		return 0, dbError("failed to count documents", err)
+	}
+
+	return count, nil
+}
+
+// CountByStatus counts the documents of all knowledge bases per status.
+func (r *DocumentRepository) CountByStatus(ctx context.Context) (map[string]int, error) {
+	rows, err := r.db.db.QueryContext(ctx, `SELECT status, COUNT(*) FROM documents GROUP BY status`)
+	if err != nil {
+		return nil, dbError("failed to count documents", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, dbError("failed to scan document count", err)
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (r *DocumentRepository) UpdateStatus(ctx context.Context, id int, status string, processedAt *time.Time) error {
+	return r.updateStatus(ctx, r.db.db, id, status, processedAt)
+}
+
+// UpdateStatusTx is UpdateStatus as part of the transaction tx.
+func (r *DocumentRepository) UpdateStatusTx(ctx context.Context, tx *sql.Tx, id int, status string, processedAt *time.Time) error {
+	return r.updateStatus(ctx, tx, id, status, processedAt)
+}
+
+func (r *DocumentRepository) updateStatus(ctx context.Context, q querier, id int, status string, processedAt *time.Time) error {
+	query := `UPDATE documents SET status = ?, processed_at = ?, error_message = NULL WHERE id = ?`
 	
-	_, err := r.db.db.Exec(query, status, processedAt, id)
+	result, err := q.ExecContext(ctx, query, status, processedAt, id)
 	if err != nil {
-		return fmt.Errorf("failed to update document status: %w", err)
+		return dbError("failed to update document status", err)
+	}
+
+	return documentUpdated(result, "failed to update document status")
+}
+
+func (r *DocumentRepository) MarkFailed(ctx context.Context, id int, reason string, processedAt time.Time) error {
+	query := `UPDATE documents SET status = ?, processed_at = ?, error_message = ? WHERE id = ?`
+
+	result, err := r.db.db.ExecContext(ctx, query, models.DocumentStatusFailed, processedAt, reason, id)
+	if err != nil {
+		return dbError("failed to mark document as failed", err)
+	}
+
+	return documentUpdated(result, "failed to mark document as failed")
+}
+
+// MarkRetrying puts a document back to pending after a failed attempt
+// that will be retried, keeping the reason it failed.
+func (r *DocumentRepository) MarkRetrying(ctx context.Context, id int, reason string) error {
+	query := `UPDATE documents SET status = ?, processed_at = NULL, error_message = ? WHERE id = ?`
+
+	result, err := r.db.db.ExecContext(ctx, query, models.DocumentStatusPending, reason, id)
+	if err != nil {
+		return dbError("failed to mark document for retry", err)
+	}
+
+	return documentUpdated(result, "failed to mark document for retry")
+}
+
+// documentUpdated returns ErrDocumentNotFound when an update by id
+// matched no document.
+func documentUpdated(result sql.Result, msg string) error {
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return dbError(msg, err)
+	}
+	if updated == 0 {
+		return ErrDocumentNotFound
 	}
 
 	return nil
 }
 
-func (r *DocumentRepository) Delete(id int) error {
-	query := `DELETE FROM documents WHERE id = ?`
+// Delete removes a document unless it is being processed. The status is
+// checked in the same statement, so a worker cannot claim the document
+// between the check and the delete and store chunks for a document that
+// no longer exists.
+func (r *DocumentRepository) Delete(ctx context.Context, id int) error {
+	query := `DELETE FROM documents WHERE id = ? AND status != ?`
 	
-	_, err := r.db.db.Exec(query, id)
+	result, err := r.db.db.ExecContext(ctx, query, id, models.DocumentStatusProcessing)
+	if err != nil {
+		return dbError("failed to delete document", err)
+	}
+
+	deleted, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to delete document: %w", err)
+		return dbError("failed to delete document", err)
+	}
+	if deleted == 0 {
+		if _, err := r.GetByID(ctx, id); err != nil {
+			return err
+		}
+		return ErrDocumentProcessing
 	}
 
 	return nil
 }
 
-func (r *DocumentRepository) GetByStatus(status string) ([]*models.Document, error) {
+func (r *DocumentRepository) GetByStatus(ctx context.Context, status string) ([]*models.Document, error) {
 	query := `
-		SELECT id, file_name, file_path, file_size, content_hash, uploaded_at, processed_at, status
+		SELECT id, knowledge_base_id, file_name, file_path, file_size, content_hash, uploaded_at, processed_at, status, error_message, tags
 		FROM documents WHERE status = ? ORDER BY uploaded_at ASC
 	`
 	
-	rows, err := r.db.db.Query(query, status)
+	rows, err := r.db.db.QueryContext(ctx, query, status)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query documents by status: %w", err)
+		return nil, dbError("failed to query documents by status", err)
 	}
 	defer rows.Close()
 
 	var documents []*models.Document
 	for rows.Next() {
-		var doc models.Document
-		var processedAt sql.NullTime
-		
-		err := rows.Scan(&doc.ID, &doc.FileName, &doc.FilePath, &doc.FileSize, &doc.ContentHash, &doc.UploadedAt, &processedAt, &doc.Status)
+		doc, err := scanDocument(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan document: %w", err)
-		}
-
-		if processedAt.Valid {
-			doc.ProcessedAt = &processedAt.Time
+			return nil, dbError("failed to scan document", err)
 		}
 
-		documents = append(documents, &doc)
+		documents = append(documents, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError("failed to read documents", err)
 	}
 
 	return documents, nil
-}
\ No newline at end of file
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDocument(row rowScanner) (*models.Document, error) {
+	var doc models.Document
+	var processedAt sql.NullTime
+	var knowledgeBaseID sql.NullInt64
+	var errorMessage sql.NullString
+	var tags string
+
+	err := row.Scan(&doc.ID, &knowledgeBaseID, &doc.FileName, &doc.FilePath, &doc.FileSize, &doc.ContentHash, &doc.UploadedAt, &processedAt, &doc.Status, &errorMessage, &tags)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(tags), &doc.Tags); err != nil {
+		return nil, fmt.Errorf("failed to decode document tags: %w", err)
+	}
+
+	if processedAt.Valid {
+		doc.ProcessedAt = &processedAt.Time
+	}
+	doc.KnowledgeBaseID = int(knowledgeBaseID.Int64)
+	doc.ErrorMessage = errorMessage.String
+
+	return &doc, nil
+}
+
+func encodeTags(tags []string) (string, error) {
+	if tags == nil {
+		tags = []string{}
+	}
+	encoded, err := json.Marshal(tags)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode document tags: %w", err)
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,506 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Compaction rewrites the log once it holds more dead records (replaced
+// or deleted) than live ones, and at least this many.
+const embeddedCompactThreshold = 1000
+
+// Scans over every record check for cancellation this often.
+const embeddedCancelCheckInterval = 1024
+
+const (
+	embeddedOpConfig = "config"
+	embeddedOpAdd    = "add"
+	embeddedOpDelete = "delete"
+)
+
+// EmbeddedVectorStore is an in-process vector store that needs no external
+// service. Chunks are held in memory and searched with an exact scan, which
+// is fast enough for tens of thousands of chunks. Every change is appended
+// to a JSON-lines log in the data directory and replayed on startup; the
+// log is compacted when it is mostly dead records. The first entry records
+// the collection's distance metric.
+type EmbeddedVectorStore struct {
+	mu         sync.RWMutex
+	name       string
+	path       string
+	file       *os.File
+	metric     DistanceMetric
+	records    map[string]*embeddedRecord
+	dimensions int
+	dead       int
+}
+
+type embeddedRecord struct {
+	Chunk     DocumentChunk `json:"chunk"`
+	Embedding []float32     `json:"embedding"`
+}
+
+type embeddedLogEntry struct {
+	Op       string           `json:"op"`
+	Distance DistanceMetric   `json:"distance,omitempty"`
+	Records  []embeddedRecord `json:"records,omitempty"`
+	IDs      []string         `json:"ids,omitempty"`
+}
+
+// NewEmbeddedVectorStore opens the collection stored under dir, creating
+// it with the given metric if needed. An existing collection keeps the
+// metric it was created with, and a warning is logged if that is not
+// metric.
+func NewEmbeddedVectorStore(dir, collection string, metric DistanceMetric) (*EmbeddedVectorStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create vector store directory: %w", err)
+	}
+
+	vs := &EmbeddedVectorStore{
+		name:    collection,
+		path:    filepath.Join(dir, collection+".jsonl"),
+		records: make(map[string]*embeddedRecord),
+	}
+
+	if err := vs.load(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(vs.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vector store log: %w", err)
+	}
+	vs.file = file
+
+	switch {
+	case vs.metric == "":
+		vs.mu.Lock()
+		err = vs.write(embeddedLogEntry{Op: embeddedOpConfig, Distance: metric})
+		vs.mu.Unlock()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	case vs.metric != metric:
+		slog.Warn("Collection uses a different distance metric than configured, keeping it",
+			"collection", collection, "distance", vs.metric, "configured", metric)
+	}
+
+	return vs, nil
+}
+
+// load replays the log. A torn last line, left by a crash during a write,
+// is dropped and truncated away; corruption anywhere else is an error.
+func (vs *EmbeddedVectorStore) load() error {
+	file, err := os.Open(vs.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open vector store log: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				return vs.truncate(offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read vector store log: %w", err)
+		}
+
+		var entry embeddedLogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			if _, peekErr := reader.Peek(1); errors.Is(peekErr, io.EOF) {
+				return vs.truncate(offset)
+			}
+			return fmt.Errorf("corrupt vector store log %s at line %d: %w", vs.path, lineNumber, err)
+		}
+
+		if err := vs.apply(entry); err != nil {
+			return fmt.Errorf("invalid vector store log %s at line %d: %w", vs.path, lineNumber, err)
+		}
+		offset += int64(len(line))
+
+		// Logs written before the metric was recorded used squared L2.
+		if vs.metric == "" {
+			vs.metric = DistanceL2
+		}
+	}
+}
+
+func (vs *EmbeddedVectorStore) truncate(size int64) error {
+	if err := os.Truncate(vs.path, size); err != nil {
+		return fmt.Errorf("failed to drop incomplete vector store log entry: %w", err)
+	}
+	return nil
+}
+
+func (vs *EmbeddedVectorStore) apply(entry embeddedLogEntry) error {
+	switch entry.Op {
+	case embeddedOpConfig:
+		if vs.metric != "" && vs.metric != entry.Distance {
+			return fmt.Errorf("conflicting distance metrics %s and %s", vs.metric, entry.Distance)
+		}
+		vs.metric = entry.Distance
+	case embeddedOpAdd:
+		for i := range entry.Records {
+			record := entry.Records[i]
+			if vs.dimensions == 0 {
+				vs.dimensions = len(record.Embedding)
+			}
+			if _, exists := vs.records[record.Chunk.ID]; exists {
+				vs.dead++
+			}
+			vs.records[record.Chunk.ID] = &record
+		}
+	case embeddedOpDelete:
+		for _, id := range entry.IDs {
+			if _, exists := vs.records[id]; exists {
+				delete(vs.records, id)
+				vs.dead++
+			}
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", entry.Op)
+	}
+
+	if len(vs.records) == 0 {
+		vs.dimensions = 0
+	}
+	return nil
+}
+
+// write appends entry to the log, applies it and compacts if worthwhile.
+// A failed append is cut off again, so a partial line never ends up in
+// the middle of the log where load cannot repair it. A failed compaction
+// is only logged: the entry is already stored, and compaction is tried
+// again on the next write. The caller must hold the write lock.
+func (vs *EmbeddedVectorStore) write(entry embeddedLogEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode vector store entry: %w", err)
+	}
+
+	info, err := vs.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat vector store log: %w", err)
+	}
+
+	if _, err := vs.file.Write(append(line, '\n')); err != nil {
+		return errors.Join(fmt.Errorf("failed to write vector store log: %w", err), vs.truncate(info.Size()))
+	}
+	if err := vs.file.Sync(); err != nil {
+		return errors.Join(fmt.Errorf("failed to sync vector store log: %w", err), vs.truncate(info.Size()))
+	}
+
+	if err := vs.apply(entry); err != nil {
+		return err
+	}
+
+	if vs.dead >= embeddedCompactThreshold && vs.dead > len(vs.records) {
+		if err := vs.compact(); err != nil {
+			slog.Error("Failed to compact vector store log", "collection", vs.name, "error", err)
+		}
+	}
+	return nil
+}
+
+// compact rewrites the log with only the live records. The new log is
+// written next to the old one and renamed over it, so a crash leaves one
+// of the two intact. Its handle is kept for later appends, so on any
+// error the store goes on with the old log.
+func (vs *EmbeddedVectorStore) compact() error {
+	tmpPath := vs.path + ".tmp"
+
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create compacted vector store log: %w", err)
+	}
+	defer os.Remove(tmpPath)
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	if err := encoder.Encode(embeddedLogEntry{Op: embeddedOpConfig, Distance: vs.metric}); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write compacted vector store log: %w", err)
+	}
+	for _, record := range vs.records {
+		if err := encoder.Encode(embeddedLogEntry{Op: embeddedOpAdd, Records: []embeddedRecord{*record}}); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write compacted vector store log: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write compacted vector store log: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync compacted vector store log: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, vs.path); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to replace vector store log: %w", err)
+	}
+
+	vs.file.Close()
+	vs.file = tmp
+	vs.dead = 0
+
+	return nil
+}
+
+func (vs *EmbeddedVectorStore) AddChunks(ctx context.Context, chunks []DocumentChunk, embeddings [][]float32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(chunks) != len(embeddings) {
+		return fmt.Errorf("chunks and embeddings length mismatch: %d vs %d", len(chunks), len(embeddings))
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	dimensions := vs.dimensions
+	if dimensions == 0 {
+		dimensions = len(embeddings[0])
+	}
+
+	records := make([]embeddedRecord, len(chunks))
+	for i, chunk := range chunks {
+		if len(embeddings[i]) != dimensions {
+			return fmt.Errorf("embedding dimension mismatch for chunk %s: got %d, collection uses %d", chunk.ID, len(embeddings[i]), dimensions)
+		}
+		records[i] = embeddedRecord{Chunk: chunk, Embedding: embeddings[i]}
+	}
+
+	return vs.write(embeddedLogEntry{Op: embeddedOpAdd, Records: records})
+}
+
+// SearchSimilar computes the distance to every chunk matching filter and
+// returns the closest ones, scored with the metric's 0..1 similarity.
+func (vs *EmbeddedVectorStore) SearchSimilar(ctx context.Context, queryEmbedding []float32, limit int, filter *SearchFilter) ([]SearchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	if vs.dimensions != 0 && len(queryEmbedding) != vs.dimensions {
+		return nil, fmt.Errorf("query embedding has %d dimensions, collection uses %d", len(queryEmbedding), vs.dimensions)
+	}
+
+	type scored struct {
+		record   *embeddedRecord
+		distance float32
+	}
+
+	candidates := make([]scored, 0, len(vs.records))
+	scanned := 0
+	for _, record := range vs.records {
+		if scanned++; scanned%embeddedCancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if !filter.Matches(record.Chunk) {
+			continue
+		}
+		candidates = append(candidates, scored{record: record, distance: vs.metric.distance(queryEmbedding, record.Embedding)})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].record.Chunk.ID < candidates[j].record.Chunk.ID
+	})
+	if limit < len(candidates) {
+		candidates = candidates[:limit]
+	}
+
+	var results []SearchResult
+	for _, candidate := range candidates {
+		chunk := candidate.record.Chunk
+
+		metadata := make(map[string]string, len(chunk.Metadata))
+		for k, v := range chunk.Metadata {
+			metadata[k] = v
+		}
+
+		results = append(results, SearchResult{
+			ID:         chunk.ID,
+			Content:    chunk.Content,
+			DocumentID: chunk.DocumentID,
+			ChunkIndex: chunk.ChunkIndex,
+			Score:      vs.metric.Similarity(candidate.distance),
+			Metadata:   metadata,
+		})
+	}
+
+	return results, nil
+}
+
+func (vs *EmbeddedVectorStore) GetChunks(ctx context.Context, documentID, fromIndex, toIndex int) ([]DocumentChunk, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	var chunks []DocumentChunk
+	scanned := 0
+	for _, record := range vs.records {
+		if scanned++; scanned%embeddedCancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		chunk := record.Chunk
+		if chunk.DocumentID != documentID || chunk.ChunkIndex < fromIndex || chunk.ChunkIndex > toIndex {
+			continue
+		}
+
+		metadata := make(map[string]string, len(chunk.Metadata))
+		for k, v := range chunk.Metadata {
+			metadata[k] = v
+		}
+		chunk.Metadata = metadata
+		chunks = append(chunks, chunk)
+	}
+
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].ChunkIndex < chunks[j].ChunkIndex
+	})
+	return chunks, nil
+}
+
+func (vs *EmbeddedVectorStore) GetEmbeddings(ctx context.Context, chunkIDs []string) (map[string][]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	embeddings := make(map[string][]float32, len(chunkIDs))
+	for i, id := range chunkIDs {
+		if i > 0 && i%embeddedCancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if record, ok := vs.records[id]; ok {
+			embeddings[id] = append([]float32(nil), record.Embedding...)
+		}
+	}
+	return embeddings, nil
+}
+
+func (vs *EmbeddedVectorStore) DeleteChunks(ctx context.Context, chunkIDs []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if len(chunkIDs) == 0 {
+		return nil
+	}
+
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	return vs.write(embeddedLogEntry{Op: embeddedOpDelete, IDs: chunkIDs})
+}
+
+func (vs *EmbeddedVectorStore) DeleteByDocumentID(ctx context.Context, documentID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	var ids []string
+	for id, record := range vs.records {
+		if record.Chunk.DocumentID == documentID {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Strings(ids)
+
+	return vs.write(embeddedLogEntry{Op: embeddedOpDelete, IDs: ids})
+}
+
+// Heartbeat always succeeds; the store runs in process.
+func (vs *EmbeddedVectorStore) Heartbeat(ctx context.Context) error {
+	return nil
+}
+
+func (vs *EmbeddedVectorStore) GetCollectionInfo(ctx context.Context) (map[string]interface{}, error) {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	info := map[string]interface{}{
+		"name":     vs.name,
+		"count":    int32(len(vs.records)),
+		"distance": string(vs.metric),
+	}
+
+	return info, nil
+}
+
+// Drop closes the store and removes its log.
+func (vs *EmbeddedVectorStore) Drop(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	vs.file.Close()
+	vs.records = make(map[string]*embeddedRecord)
+	vs.dimensions = 0
+
+	if err := os.Remove(vs.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove vector store log: %w", err)
+	}
+	return nil
+}
+
+func (vs *EmbeddedVectorStore) Close() error {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	return vs.file.Close()
+}
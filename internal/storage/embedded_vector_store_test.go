@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openEmbeddedStore(t *testing.T, dir string) *EmbeddedVectorStore {
+	t.Helper()
+
+	vs, err := NewEmbeddedVectorStore(dir, "chunks", DistanceCosine)
+	if err != nil {
+		t.Fatalf("NewEmbeddedVectorStore failed: %v", err)
+	}
+	t.Cleanup(func() { vs.Close() })
+	return vs
+}
+
+func embeddedCount(t *testing.T, vs *EmbeddedVectorStore) int32 {
+	t.Helper()
+	ctx := context.Background()
+
+	info, err := vs.GetCollectionInfo(ctx)
+	if err != nil {
+		t.Fatalf("GetCollectionInfo failed: %v", err)
+	}
+	return info["count"].(int32)
+}
+
+func testChunk(documentID, index int) DocumentChunk {
+	return DocumentChunk{
+		ID:         GenerateChunkID(documentID, index),
+		Content:    fmt.Sprintf("chunk %d of document %d", index, documentID),
+		DocumentID: documentID,
+		ChunkIndex: index,
+		Metadata:   map[string]string{"file_name": "test.pdf"},
+	}
+}
+
+func TestEmbeddedVectorStorePersists(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	vs := openEmbeddedStore(t, dir)
+	chunks := []DocumentChunk{testChunk(1, 0), testChunk(1, 1), testChunk(2, 0)}
+	embeddings := [][]float32{{1, 0}, {0, 1}, {1, 1}}
+	if err := vs.AddChunks(ctx, chunks, embeddings); err != nil {
+		t.Fatalf("AddChunks failed: %v", err)
+	}
+	if err := vs.DeleteByDocumentID(ctx, 2); err != nil {
+		t.Fatalf("DeleteByDocumentID failed: %v", err)
+	}
+	vs.Close()
+
+	reopened := openEmbeddedStore(t, dir)
+	if count := embeddedCount(t, reopened); count != 2 {
+		t.Fatalf("expected 2 chunks after reopening, got %d", count)
+	}
+
+	results, err := reopened.SearchSimilar(ctx, []float32{0.9, 0.1}, 1, nil)
+	if err != nil {
+		t.Fatalf("SearchSimilar failed: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != GenerateChunkID(1, 0) || results[0].Metadata["file_name"] != "test.pdf" {
+		t.Errorf("unexpected results after reopening: %+v", results)
+	}
+}
+
+func TestEmbeddedVectorStoreDropsTornWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	vs := openEmbeddedStore(t, dir)
+	if err := vs.AddChunks(ctx, []DocumentChunk{testChunk(1, 0)}, [][]float32{{1, 0}}); err != nil {
+		t.Fatalf("AddChunks failed: %v", err)
+	}
+	vs.Close()
+
+	// Simulate a crash half way through appending an entry.
+	file, err := os.OpenFile(filepath.Join(dir, "chunks.jsonl"), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	file.WriteString(`{"op":"add","records":[{"chunk":{"id":"doc_1_ch`)
+	file.Close()
+
+	reopened := openEmbeddedStore(t, dir)
+	if count := embeddedCount(t, reopened); count != 1 {
+		t.Fatalf("expected the complete entry to survive, got %d chunks", count)
+	}
+
+	// New writes must land after the truncated entry, not glued to it.
+	if err := reopened.AddChunks(ctx, []DocumentChunk{testChunk(1, 1)}, [][]float32{{0, 1}}); err != nil {
+		t.Fatalf("AddChunks failed: %v", err)
+	}
+	reopened.Close()
+
+	if count := embeddedCount(t, openEmbeddedStore(t, dir)); count != 2 {
+		t.Errorf("expected 2 chunks, got %d", count)
+	}
+}
+
+func TestEmbeddedVectorStoreCompacts(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	vs := openEmbeddedStore(t, dir)
+
+	// Re-adding the same chunks over and over leaves dead records behind.
+	for i := 0; i <= embeddedCompactThreshold; i++ {
+		if err := vs.AddChunks(ctx, []DocumentChunk{testChunk(1, 0)}, [][]float32{{1, float32(i)}}); err != nil {
+			t.Fatalf("AddChunks failed: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "chunks.jsonl"))
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines > 2 {
+		t.Errorf("expected the log to be compacted to the config and one record, got %d lines", lines)
+	}
+
+	reopened := openEmbeddedStore(t, dir)
+	results, _ := reopened.SearchSimilar(ctx, []float32{1, embeddedCompactThreshold}, 1, nil)
+	if len(results) != 1 || results[0].Score != 1 {
+		t.Errorf("expected the latest embedding to survive compaction, got %+v", results)
+	}
+}
+
+func TestEmbeddedVectorStoreSurvivesFailedCompaction(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	vs := openEmbeddedStore(t, dir)
+
+	// A directory in the way makes every compaction fail.
+	tmpPath := filepath.Join(dir, "chunks.jsonl.tmp")
+	if err := os.Mkdir(tmpPath, 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+
+	for i := 0; i <= embeddedCompactThreshold; i++ {
+		if err := vs.AddChunks(ctx, []DocumentChunk{testChunk(1, 0)}, [][]float32{{1, float32(i)}}); err != nil {
+			t.Fatalf("expected the write to succeed although compaction failed, got %v", err)
+		}
+	}
+
+	reopened, err := NewEmbeddedVectorStore(dir, "chunks", DistanceCosine)
+	if err != nil {
+		t.Fatalf("NewEmbeddedVectorStore failed: %v", err)
+	}
+	results, _ := reopened.SearchSimilar(ctx, []float32{1, embeddedCompactThreshold}, 1, nil)
+	reopened.Close()
+	if len(results) != 1 || results[0].Score != 1 {
+		t.Fatalf("expected the latest embedding to be stored, got %+v", results)
+	}
+
+	// Once the directory is gone the next write compacts.
+	os.Remove(tmpPath)
+	if err := vs.AddChunks(ctx, []DocumentChunk{testChunk(1, 1)}, [][]float32{{0, 1}}); err != nil {
+		t.Fatalf("AddChunks failed: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "chunks.jsonl"))
+	if lines := bytes.Count(data, []byte("\n")); lines > 3 {
+		t.Errorf("expected the log to be compacted, got %d lines", lines)
+	}
+	if err := vs.AddChunks(ctx, []DocumentChunk{testChunk(1, 2)}, [][]float32{{1, 1}}); err != nil {
+		t.Fatalf("AddChunks after compaction failed: %v", err)
+	}
+	if count := embeddedCount(t, openEmbeddedStore(t, dir)); count != 3 {
+		t.Errorf("expected 3 chunks after reopening, got %d", count)
+	}
+}
+
+func TestEmbeddedVectorStoreChecksCancellation(t *testing.T) {
+	vs := openEmbeddedStore(t, t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := vs.GetChunks(ctx, 1, 0, 10); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected GetChunks to fail with context.Canceled, got %v", err)
+	}
+	if _, err := vs.GetEmbeddings(ctx, []string{GenerateChunkID(1, 0)}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected GetEmbeddings to fail with context.Canceled, got %v", err)
+	}
+}
+
+func TestEmbeddedVectorStoreRejectsDimensionMismatch(t *testing.T) {
+	ctx := context.Background()
+	vs := openEmbeddedStore(t, t.TempDir())
+
+	if err := vs.AddChunks(ctx, []DocumentChunk{testChunk(1, 0)}, [][]float32{{1, 0, 0}}); err != nil {
+		t.Fatalf("AddChunks failed: %v", err)
+	}
+	if err := vs.AddChunks(ctx, []DocumentChunk{testChunk(1, 1)}, [][]float32{{1, 0}}); err == nil {
+		t.Error("expected an error adding an embedding of a different size")
+	}
+	if _, err := vs.SearchSimilar(ctx, []float32{1, 0}, 1, nil); err == nil {
+		t.Error("expected an error searching with a query of a different size")
+	}
+}
+
+func TestEmbeddedVectorStoreKeepsItsMetric(t *testing.T) {
+	dir := t.TempDir()
+	openEmbeddedStore(t, dir).Close()
+
+	vs, err := NewEmbeddedVectorStore(dir, "chunks", DistanceL2)
+	if err != nil {
+		t.Fatalf("expected a collection with another metric to open, got %v", err)
+	}
+	defer vs.Close()
+
+	if vs.metric != DistanceCosine {
+		t.Errorf("expected the collection to keep %s, got %s", DistanceCosine, vs.metric)
+	}
+}
+
+func TestEmbeddedVectorStoreLegacyLogIsL2(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// Logs written before the metric was recorded start with data.
+	legacy := `{"op":"add","records":[{"chunk":{"id":"doc_1_chunk_0","document_id":1},"embedding":[1,0]}]}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "chunks.jsonl"), []byte(legacy), 0644); err != nil {
+		t.Fatalf("failed to write legacy log: %v", err)
+	}
+
+	vs, err := NewEmbeddedVectorStore(dir, "chunks", DistanceCosine)
+	if err != nil {
+		t.Fatalf("NewEmbeddedVectorStore failed: %v", err)
+	}
+	defer vs.Close()
+
+	// Under cosine the two vectors would match exactly; squared L2 puts
+	// them 1 apart.
+	results, _ := vs.SearchSimilar(ctx, []float32{2, 0}, 1, nil)
+	if len(results) != 1 || results[0].Score != 0.5 {
+		t.Errorf("expected the legacy log to be searched with l2 (score 0.5), got %+v", results)
+	}
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Every error the storage package expects callers to handle belongs to one
+// of these categories, so callers can handle a whole category without
+// knowing each error: errors.Is(ErrDocumentNotFound, ErrNotFound) is true.
+var (
+	// ErrNotFound is returned when the requested record does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned when a record would duplicate an existing
+	// one, such as a second upload of the same file.
+	ErrDuplicate = errors.New("already exists")
+	// ErrConflict is returned when the record is not in a state that
+	// allows the operation.
+	ErrConflict = errors.New("conflict")
+	// ErrInvalid is returned when the input itself is rejected, such as an
+	// upload that is not a PDF.
+	ErrInvalid = errors.New("invalid")
+	// ErrUnavailable is returned when the database or vector store cannot
+	// serve the request right now; retrying later may succeed.
+	ErrUnavailable = errors.New("unavailable")
+)
+
+// categorizedError is an error with its own message that belongs to one
+// of the categories above, optionally wrapping the error it came from.
+type categorizedError struct {
+	category error
+	message  string
+	cause    error
+}
+
+func newError(category error, message string) error {
+	return &categorizedError{category: category, message: message}
+}
+
+// Invalid puts err, which describes bad input, in the ErrInvalid category
+// without changing its message.
+func Invalid(err error) error {
+	return &categorizedError{category: ErrInvalid, message: err.Error(), cause: err}
+}
+
+func (e *categorizedError) Error() string {
+	return e.message
+}
+
+func (e *categorizedError) Unwrap() []error {
+	if e.cause == nil {
+		return []error{e.category}
+	}
+	return []error{e.category, e.cause}
+}
+
+// dbError wraps an error from the database with message. Errors that may
+// go away on a retry, such as the query timeout or a locked database, are
+// also marked as ErrUnavailable.
+func dbError(message string, err error) error {
+	if isTransient(err) {
+		return fmt.Errorf("%s: %w: %w", message, ErrUnavailable, err)
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
+
+func isTransient(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return true
+	}
+	return false
+}
@@ -1,16 +1,53 @@
 package storage
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
+// DefaultMaxDocumentSize is the largest upload accepted unless
+// WithMaxDocumentSize says otherwise.
+const DefaultMaxDocumentSize = 50 << 20
+
+const (
+	// The PDF header must start the file, after at most a byte order mark
+	// and some whitespace, which fit in the first kilobyte.
+	sniffLength       = 1024
+	maxFileNameLength = 100
+	defaultFileName   = "document.pdf"
+
+	// MaxDocumentNameLength caps the name sent by the client, kept as the
+	// document's file name, in bytes.
+	MaxDocumentNameLength = 255
+)
+
+var (
+	pdfMagic = []byte("%PDF-")
+	utf8BOM  = []byte("\xEF\xBB\xBF")
+)
+
+var (
+	ErrDocumentTooLarge    = newError(ErrInvalid, "document is too large")
+	ErrUnsupportedDocument = newError(ErrInvalid, "document is not a PDF")
+	ErrInvalidDocument     = newError(ErrInvalid, "document rejected")
+)
+
+// DocumentCheck inspects a saved upload and returns why it cannot be
+// processed, if it cannot.
+type DocumentCheck func(path string) error
+
 type FileStorage struct {
 	dataDir string
+	maxSize int64
+	check   DocumentCheck
 }
 
 func NewFileStorage(dataDir string) (*FileStorage, error) {
@@ -25,10 +62,47 @@ func NewFileStorage(dataDir string) (*FileStorage, error) {
 
 	return &FileStorage{
 		dataDir: dataDir,
+		maxSize: DefaultMaxDocumentSize,
 	}, nil
 }
 
+// CheckWritable creates and removes a file in the directories uploads are
+// written to.
+func (fs *FileStorage) CheckWritable() error {
+	for _, dir := range []string{fs.dataDir, filepath.Join(fs.dataDir, "documents")} {
+		file, err := os.CreateTemp(dir, "healthcheck_*.tmp")
+		if err != nil {
+			return fmt.Errorf("directory %s is not writable: %w", dir, err)
+		}
+		file.Close()
+		if err := os.Remove(file.Name()); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", file.Name(), err)
+		}
+	}
+	return nil
+}
+
+// SaveDocument streams an upload into the documents directory under a
+// sanitized version of fileName and returns its path, SHA-256 hash and
+// size. Content that does not look like a PDF, is over the size limit or
+// fails the document check is not kept and is reported as
+// ErrUnsupportedDocument, ErrDocumentTooLarge or ErrInvalidDocument.
 func (fs *FileStorage) SaveDocument(fileName string, content io.Reader) (string, string, int64, error) {
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(content, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", "", 0, fmt.Errorf("failed to read content: %w", err)
+	}
+	if !looksLikePDF(head[:n]) {
+		return "", "", 0, ErrUnsupportedDocument
+	}
+
+	content = io.MultiReader(bytes.NewReader(head[:n]), content)
+	if fs.maxSize > 0 {
+		// Reading one byte past the limit is enough to know it is exceeded.
+		content = io.LimitReader(content, fs.maxSize+1)
+	}
+
 	hash := sha256.New()
 	
 	tempFile, err := os.CreateTemp(fs.dataDir, "upload_*.tmp")
@@ -45,19 +119,106 @@ func (fs *FileStorage) SaveDocument(fileName string, content io.Reader) (string,
 	}
 	tempFile.Close()
 
+	if fs.maxSize > 0 && size > fs.maxSize {
+		return "", "", 0, fmt.Errorf("%w: the limit is %d bytes", ErrDocumentTooLarge, fs.maxSize)
+	}
+	if fs.check != nil {
+		if err := fs.check(tempFile.Name()); err != nil {
+			return "", "", 0, fmt.Errorf("%w: %w", ErrInvalidDocument, err)
+		}
+	}
+
 	contentHash := fmt.Sprintf("%x", hash.Sum(nil))
 	
-	timestamp := time.Now().Format("20060102_150405")
-	safeFileName := fmt.Sprintf("%s_%s", timestamp, fileName)
-	finalPath := filepath.Join(fs.dataDir, "documents", safeFileName)
+	finalPath, err := fs.reservePath(fileName)
+	if err != nil {
+		return "", "", 0, err
+	}
 
 	if err := os.Rename(tempFile.Name(), finalPath); err != nil {
+		os.Remove(finalPath)
 		return "", "", 0, fmt.Errorf("failed to move file to final location: %w", err)
 	}
 
 	return finalPath, contentHash, size, nil
 }
 
+// looksLikePDF reports whether head starts with the PDF header, allowing
+// for a byte order mark and whitespace before it.
+func looksLikePDF(head []byte) bool {
+	head = bytes.TrimPrefix(head, utf8BOM)
+	head = bytes.TrimLeft(head, " \t\r\n\f")
+	return bytes.HasPrefix(head, pdfMagic)
+}
+
+// reservePath creates an empty file under a name no other upload uses, so
+// two uploads of the same file name in the same second never overwrite
+// each other.
+func (fs *FileStorage) reservePath(fileName string) (string, error) {
+	timestamp := time.Now().Format("20060102_150405")
+	fileName = sanitizeFileName(fileName)
+
+	for n := 1; ; n++ {
+		safeFileName := fmt.Sprintf("%s_%s", timestamp, fileName)
+		if n > 1 {
+			safeFileName = fmt.Sprintf("%s_%d_%s", timestamp, n, fileName)
+		}
+		path := filepath.Join(fs.dataDir, "documents", safeFileName)
+
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to create document file: %w", err)
+		}
+		file.Close()
+		return path, nil
+	}
+}
+
+// sanitizeFileName reduces a client-supplied file name to one that stays
+// inside the documents directory: the last path element only, with
+// anything but ASCII letters, digits, dots, dashes and underscores
+// replaced, no leading dots and at most maxFileNameLength bytes.
+func sanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+
+	safe := []byte(name)
+	for i, c := range safe {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '.', c == '-', c == '_':
+		default:
+			safe[i] = '_'
+		}
+	}
+	name = truncateFileName(strings.TrimLeft(string(safe), "."), maxFileNameLength)
+	if name == "" {
+		return defaultFileName
+	}
+	return name
+}
+
+// truncateFileName shortens name to at most limit bytes. It keeps the
+// extension, unless that is over half the limit, and never splits a UTF-8
+// character.
+func truncateFileName(name string, limit int) string {
+	if len(name) <= limit {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	if len(ext) > limit/2 {
+		ext = ""
+	}
+
+	cut := limit - len(ext)
+	for cut > 0 && !utf8.RuneStart(name[cut]) {
+		cut--
+	}
+	return name[:cut] + ext
+}
+
 func (fs *FileStorage) DeleteDocument(filePath string) error {
 	return os.Remove(filePath)
 }
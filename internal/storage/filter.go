@@ -0,0 +1,346 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"rag-therapist/internal/chunking"
+)
+
+// Chunk metadata written by the ingestion pipeline and understood by
+// SearchFilter, in addition to the chunking.Meta* keys.
+const (
+	// MetaUploadedAt is the document's upload time in Unix seconds.
+	MetaUploadedAt = "uploaded_at"
+	// MetaTagPrefix marks document tags: a chunk of a document tagged
+	// "x" has metadata "tag:x" = "true".
+	MetaTagPrefix = "tag:"
+)
+
+// NormalizeTags lowercases and trims tags, dropping empty ones and
+// duplicates, so that tag filters match regardless of spelling.
+func NormalizeTags(tags []string) []string {
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// numericMetadataKeys are stored as numbers by backends that support range
+// queries, so that page and date ranges can be filtered on.
+var numericMetadataKeys = map[string]bool{
+	chunking.MetaPageStart: true,
+	chunking.MetaPageEnd:   true,
+	chunking.MetaCharStart: true,
+	chunking.MetaCharEnd:   true,
+	MetaUploadedAt:         true,
+}
+
+// SearchFilter restricts a search to matching chunks. All set conditions
+// must hold; the zero value matches everything.
+type SearchFilter struct {
+	// DocumentIDs limits results to these documents.
+	DocumentIDs []int
+	// Tags matches chunks of documents with any of these tags.
+	Tags []string
+	// PageFrom and PageTo match chunks that overlap the inclusive page
+	// range; 0 leaves that end open.
+	PageFrom int
+	PageTo   int
+	// UploadedAfter and UploadedBefore bound the document upload time,
+	// inclusive.
+	UploadedAfter  *time.Time
+	UploadedBefore *time.Time
+	// Metadata matches chunks whose metadata value for each key is one of
+	// the listed values.
+	Metadata map[string][]string
+}
+
+func (f *SearchFilter) IsEmpty() bool {
+	return f == nil ||
+		len(f.DocumentIDs) == 0 && len(f.Tags) == 0 && f.PageFrom == 0 && f.PageTo == 0 &&
+			f.UploadedAfter == nil && f.UploadedBefore == nil && len(f.Metadata) == 0
+}
+
+func (f *SearchFilter) Validate() error {
+	if f == nil {
+		return nil
+	}
+	if f.PageFrom < 0 || f.PageTo < 0 {
+		return fmt.Errorf("page numbers must be positive")
+	}
+	if f.PageFrom > 0 && f.PageTo > 0 && f.PageFrom > f.PageTo {
+		return fmt.Errorf("page_from must not be after page_to")
+	}
+	if f.UploadedAfter != nil && f.UploadedBefore != nil && f.UploadedAfter.After(*f.UploadedBefore) {
+		return fmt.Errorf("uploaded_after must not be after uploaded_before")
+	}
+	for key, values := range f.Metadata {
+		if key == "" {
+			return fmt.Errorf("metadata keys must not be empty")
+		}
+		if len(values) == 0 {
+			return fmt.Errorf("metadata filter %q needs at least one value", key)
+		}
+		if numericMetadataKeys[key] {
+			for _, value := range values {
+				if _, err := strconv.Atoi(value); err != nil {
+					return fmt.Errorf("metadata filter %q needs integer values", key)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Matches evaluates the filter against a chunk in memory, for backends
+// without a query language.
+func (f *SearchFilter) Matches(chunk DocumentChunk) bool {
+	if f.IsEmpty() {
+		return true
+	}
+
+	if len(f.DocumentIDs) > 0 && !containsInt(f.DocumentIDs, chunk.DocumentID) {
+		return false
+	}
+
+	if len(f.Tags) > 0 {
+		tagged := false
+		for _, tag := range f.Tags {
+			if chunk.Metadata[MetaTagPrefix+tag] == "true" {
+				tagged = true
+				break
+			}
+		}
+		if !tagged {
+			return false
+		}
+	}
+
+	if f.PageFrom > 0 && !metadataAtLeast(chunk.Metadata, chunking.MetaPageEnd, int64(f.PageFrom)) {
+		return false
+	}
+	if f.PageTo > 0 && !metadataAtMost(chunk.Metadata, chunking.MetaPageStart, int64(f.PageTo)) {
+		return false
+	}
+	if f.UploadedAfter != nil && !metadataAtLeast(chunk.Metadata, MetaUploadedAt, f.UploadedAfter.Unix()) {
+		return false
+	}
+	if f.UploadedBefore != nil && !metadataAtMost(chunk.Metadata, MetaUploadedAt, f.UploadedBefore.Unix()) {
+		return false
+	}
+
+	for key, values := range f.Metadata {
+		value, ok := chunkMetadataValue(chunk, key)
+		if !ok || !containsString(values, value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// chromaWhere translates the filter into a Chroma where clause, or nil if
+// there is nothing to filter on.
+func (f *SearchFilter) chromaWhere() map[string]interface{} {
+	if f.IsEmpty() {
+		return nil
+	}
+
+	var conditions []map[string]interface{}
+
+	if len(f.DocumentIDs) > 0 {
+		ids := make([]interface{}, len(f.DocumentIDs))
+		for i, id := range f.DocumentIDs {
+			ids[i] = strconv.Itoa(id)
+		}
+		conditions = append(conditions, map[string]interface{}{"document_id": map[string]interface{}{"$in": ids}})
+	}
+
+	if len(f.Tags) > 0 {
+		var tags []map[string]interface{}
+		for _, tag := range f.Tags {
+			tags = append(tags, map[string]interface{}{MetaTagPrefix + tag: map[string]interface{}{"$eq": "true"}})
+		}
+		conditions = append(conditions, chromaCombine("$or", tags))
+	}
+
+	if f.PageFrom > 0 {
+		conditions = append(conditions, map[string]interface{}{chunking.MetaPageEnd: map[string]interface{}{"$gte": f.PageFrom}})
+	}
+	if f.PageTo > 0 {
+		conditions = append(conditions, map[string]interface{}{chunking.MetaPageStart: map[string]interface{}{"$lte": f.PageTo}})
+	}
+	if f.UploadedAfter != nil {
+		conditions = append(conditions, map[string]interface{}{MetaUploadedAt: map[string]interface{}{"$gte": f.UploadedAfter.Unix()}})
+	}
+	if f.UploadedBefore != nil {
+		conditions = append(conditions, map[string]interface{}{MetaUploadedAt: map[string]interface{}{"$lte": f.UploadedBefore.Unix()}})
+	}
+
+	for _, key := range sortedKeys(f.Metadata) {
+		values := make([]interface{}, len(f.Metadata[key]))
+		for i, value := range f.Metadata[key] {
+			values[i] = chromaMetadataValue(key, value)
+		}
+		conditions = append(conditions, map[string]interface{}{key: map[string]interface{}{"$in": values}})
+	}
+
+	return chromaCombine("$and", conditions)
+}
+
+// chromaCombine joins conditions with op; Chroma rejects $and and $or with
+// fewer than two operands.
+func chromaCombine(op string, conditions []map[string]interface{}) map[string]interface{} {
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+
+	operands := make([]interface{}, len(conditions))
+	for i, condition := range conditions {
+		operands[i] = condition
+	}
+	return map[string]interface{}{op: operands}
+}
+
+// chromaMetadataValue converts a metadata value to the type it is stored
+// with in Chroma.
+func chromaMetadataValue(key, value string) interface{} {
+	if numericMetadataKeys[key] {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return value
+}
+
+// sqlWhere translates the filter into a condition on the chunks_fts
+// table, whose metadata column holds the chunk metadata as JSON.
+func (f *SearchFilter) sqlWhere() (string, []interface{}) {
+	if f.IsEmpty() {
+		return "", nil
+	}
+
+	var conditions []string
+	var args []interface{}
+
+	if len(f.DocumentIDs) > 0 {
+		conditions = append(conditions, "document_id IN ("+placeholders(len(f.DocumentIDs))+")")
+		for _, id := range f.DocumentIDs {
+			args = append(args, id)
+		}
+	}
+
+	if len(f.Tags) > 0 {
+		var tags []string
+		for _, tag := range f.Tags {
+			tags = append(tags, "json_extract(metadata, ?) = 'true'")
+			args = append(args, jsonPath(MetaTagPrefix+tag))
+		}
+		conditions = append(conditions, "("+strings.Join(tags, " OR ")+")")
+	}
+
+	numeric := func(key, op string, value int64) {
+		conditions = append(conditions, "CAST(json_extract(metadata, ?) AS INTEGER) "+op+" ?")
+		args = append(args, jsonPath(key), value)
+	}
+	if f.PageFrom > 0 {
+		numeric(chunking.MetaPageEnd, ">=", int64(f.PageFrom))
+	}
+	if f.PageTo > 0 {
+		numeric(chunking.MetaPageStart, "<=", int64(f.PageTo))
+	}
+	if f.UploadedAfter != nil {
+		numeric(MetaUploadedAt, ">=", f.UploadedAfter.Unix())
+	}
+	if f.UploadedBefore != nil {
+		numeric(MetaUploadedAt, "<=", f.UploadedBefore.Unix())
+	}
+
+	for _, key := range sortedKeys(f.Metadata) {
+		values := f.Metadata[key]
+		column := "json_extract(metadata, ?)"
+		args = append(args, jsonPath(key))
+
+		switch key {
+		case "document_id", "chunk_index":
+			column = "CAST(" + key + " AS TEXT)"
+			args = args[:len(args)-1]
+		}
+
+		conditions = append(conditions, column+" IN ("+placeholders(len(values))+")")
+		for _, value := range values {
+			args = append(args, value)
+		}
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// jsonPath quotes key as a JSON path member, so keys containing dots or
+// colons (like tag:x) are not misread as paths.
+func jsonPath(key string) string {
+	return `$."` + strings.ReplaceAll(key, `"`, `\"`) + `"`
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func chunkMetadataValue(chunk DocumentChunk, key string) (string, bool) {
+	switch key {
+	case "document_id":
+		return strconv.Itoa(chunk.DocumentID), true
+	case "chunk_index":
+		return strconv.Itoa(chunk.ChunkIndex), true
+	}
+	value, ok := chunk.Metadata[key]
+	return value, ok
+}
+
+func metadataAtLeast(metadata map[string]string, key string, min int64) bool {
+	n, err := strconv.ParseInt(metadata[key], 10, 64)
+	return err == nil && n >= min
+}
+
+func metadataAtMost(metadata map[string]string, key string, max int64) bool {
+	n, err := strconv.ParseInt(metadata[key], 10, 64)
+	return err == nil && n <= max
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"rag-therapist/internal/chunking"
+)
+
+// filterTestChunks are three chunks from two documents: document 1 is
+// tagged "guideline" and covers pages 1-2 and 3, document 2 is tagged
+// "leaflet" and was uploaded a day later.
+func filterTestChunks() ([]DocumentChunk, [][]float32) {
+	uploaded := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC).Unix()
+	chunks := []DocumentChunk{
+		{
+			ID: "doc_1_chunk_0", Content: "Anxiety treatment guideline, first steps.", DocumentID: 1, ChunkIndex: 0,
+			Metadata: map[string]string{
+				"file_name": "guideline.pdf", MetaTagPrefix + "guideline": "true", MetaUploadedAt: strconv.FormatInt(uploaded, 10),
+				chunking.MetaPageStart: "1", chunking.MetaPageEnd: "2",
+			},
+		},
+		{
+			ID: "doc_1_chunk_1", Content: "Anxiety treatment guideline, medication.", DocumentID: 1, ChunkIndex: 1,
+			Metadata: map[string]string{
+				"file_name": "guideline.pdf", MetaTagPrefix + "guideline": "true", MetaUploadedAt: strconv.FormatInt(uploaded, 10),
+				chunking.MetaPageStart: "3", chunking.MetaPageEnd: "3",
+			},
+		},
+		{
+			ID: "doc_2_chunk_0", Content: "Anxiety leaflet for patients.", DocumentID: 2, ChunkIndex: 0,
+			Metadata: map[string]string{
+				"file_name": "leaflet.pdf", MetaTagPrefix + "leaflet": "true", MetaUploadedAt: strconv.FormatInt(uploaded+86400, 10),
+				chunking.MetaPageStart: "1", chunking.MetaPageEnd: "1",
+			},
+		},
+	}
+	embeddings := [][]float32{{1, 0}, {0.9, 0.1}, {0.8, 0.2}}
+	return chunks, embeddings
+}
+
+func filterCases() map[string]struct {
+	filter *SearchFilter
+	want   []string
+} {
+	after := time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2024, 1, 15, 23, 0, 0, 0, time.UTC)
+
+	return map[string]struct {
+		filter *SearchFilter
+		want   []string
+	}{
+		"none":      {nil, []string{"doc_1_chunk_0", "doc_1_chunk_1", "doc_2_chunk_0"}},
+		"documents": {&SearchFilter{DocumentIDs: []int{2}}, []string{"doc_2_chunk_0"}},
+		"tags":      {&SearchFilter{Tags: []string{"guideline", "other"}}, []string{"doc_1_chunk_0", "doc_1_chunk_1"}},
+		"pages":     {&SearchFilter{PageFrom: 2, PageTo: 3}, []string{"doc_1_chunk_0", "doc_1_chunk_1"}},
+		"page from": {&SearchFilter{PageFrom: 3}, []string{"doc_1_chunk_1"}},
+		"after":     {&SearchFilter{UploadedAfter: &after}, []string{"doc_2_chunk_0"}},
+		"before":    {&SearchFilter{UploadedBefore: &before}, []string{"doc_1_chunk_0", "doc_1_chunk_1"}},
+		"metadata":  {&SearchFilter{Metadata: map[string][]string{"file_name": {"leaflet.pdf", "missing.pdf"}}}, []string{"doc_2_chunk_0"}},
+		"combined":  {&SearchFilter{DocumentIDs: []int{1, 2}, PageTo: 1, Tags: []string{"guideline"}}, []string{"doc_1_chunk_0"}},
+		"no match":  {&SearchFilter{DocumentIDs: []int{3}}, nil},
+	}
+}
+
+func resultIDs(results []SearchResult) []string {
+	var ids []string
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestVectorStoreFilters(t *testing.T) {
+	ctx := context.Background()
+	for name, open := range vectorStoreBackends() {
+		t.Run(name, func(t *testing.T) {
+			vs := open(t)
+			chunks, embeddings := filterTestChunks()
+			if err := vs.AddChunks(ctx, chunks, embeddings); err != nil {
+				t.Fatalf("AddChunks failed: %v", err)
+			}
+
+			for caseName, tc := range filterCases() {
+				results, err := vs.SearchSimilar(ctx, []float32{1, 0}, 10, tc.filter)
+				if err != nil {
+					t.Fatalf("%s: SearchSimilar failed: %v", caseName, err)
+				}
+				if got := resultIDs(results); !reflect.DeepEqual(got, tc.want) {
+					t.Errorf("%s: expected %v, got %v", caseName, tc.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestKeywordIndexFilters(t *testing.T) {
+	ctx := context.Background()
+	database, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer database.Close()
+
+	index := NewKeywordIndex(database)
+	chunks, _ := filterTestChunks()
+	if err := index.IndexChunks(ctx, chunks); err != nil {
+		t.Fatalf("IndexChunks failed: %v", err)
+	}
+
+	for caseName, tc := range filterCases() {
+		results, err := index.Search(ctx, "anxiety", 10, tc.filter)
+		if err != nil {
+			t.Fatalf("%s: Search failed: %v", caseName, err)
+		}
+		if got := resultIDs(results); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: expected %v, got %v", caseName, tc.want, got)
+		}
+	}
+}
+
+func TestSearchFilterChromaWhere(t *testing.T) {
+	if where := (&SearchFilter{}).chromaWhere(); where != nil {
+		t.Errorf("expected no where clause for an empty filter, got %v", where)
+	}
+
+	where := (&SearchFilter{DocumentIDs: []int{1, 2}}).chromaWhere()
+	want := map[string]interface{}{"document_id": map[string]interface{}{"$in": []interface{}{"1", "2"}}}
+	if !reflect.DeepEqual(where, want) {
+		t.Errorf("expected %v, got %v", want, where)
+	}
+
+	where = (&SearchFilter{DocumentIDs: []int{1}, PageFrom: 4}).chromaWhere()
+	and, ok := where["$and"].([]interface{})
+	if !ok || len(and) != 2 {
+		t.Errorf("expected two conditions joined with $and, got %v", where)
+	}
+}
+
+func TestSearchFilterValidate(t *testing.T) {
+	after := time.Now()
+	before := after.Add(-time.Hour)
+
+	invalid := map[string]*SearchFilter{
+		"negative page":   {PageFrom: -1},
+		"reversed pages":  {PageFrom: 5, PageTo: 2},
+		"reversed dates":  {UploadedAfter: &after, UploadedBefore: &before},
+		"no values":       {Metadata: map[string][]string{"file_name": nil}},
+		"non-numeric key": {Metadata: map[string][]string{chunking.MetaPageStart: {"one"}}},
+	}
+	for name, filter := range invalid {
+		if err := filter.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if err := (&SearchFilter{PageFrom: 2, PageTo: 2, Tags: []string{"x"}}).Validate(); err != nil {
+		t.Errorf("expected a valid filter, got %v", err)
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	got := NormalizeTags([]string{" CBT ", "cbt", "", "Anxiety"})
+	if want := []string{"cbt", "anxiety"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// rrfK dampens the influence of the very top ranks in reciprocal rank
+// fusion; 60 is the value from the original RRF paper.
+const rrfK = 60
+
+// Each ranking contributes this many candidates per requested result, so
+// a chunk ranked low by one method can still be lifted by the other.
+const (
+	hybridCandidateFactor = 4
+	hybridMinCandidates   = 20
+)
+
+// HybridWeights scale the vector and keyword rankings in HybridSearch. A
+// weight of 0 switches that ranking off.
+type HybridWeights struct {
+	Vector  float64
+	Keyword float64
+}
+
+var DefaultHybridWeights = HybridWeights{Vector: 1, Keyword: 1}
+
+func (w HybridWeights) Validate() error {
+	if w.Vector < 0 || w.Keyword < 0 {
+		return fmt.Errorf("hybrid weights must not be negative")
+	}
+	if w.Vector == 0 && w.Keyword == 0 {
+		return fmt.Errorf("at least one hybrid weight must be positive")
+	}
+	return nil
+}
+
+// HybridSearch ranks chunks by both embedding similarity and BM25 keyword
+// relevance and fuses the two rankings with weighted reciprocal rank
+// fusion: score = sum of weight / (rrfK + rank). Scores are divided by the
+// best possible score, so a chunk ranked first by every enabled method
+// scores 1. Without a keyword index this is a plain vector search. Both
+// rankings only consider chunks matching filter, which may be nil.
+func (vs *VectorService) HybridSearch(ctx context.Context, queryText string, queryEmbedding []float32, limit int, weights HybridWeights, filter *SearchFilter) ([]SearchResult, error) {
+	if err := weights.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+	if vs.keywords == nil {
+		weights.Keyword = 0
+		if weights.Vector == 0 {
+			return nil, nil
+		}
+	}
+
+	candidates := limit * hybridCandidateFactor
+	if candidates < hybridMinCandidates {
+		candidates = hybridMinCandidates
+	}
+
+	ctx, cancel := vs.withTimeout(ctx)
+	defer cancel()
+
+	var rankings [][]SearchResult
+	var rankingWeights []float64
+
+	if weights.Vector > 0 {
+		results, err := vs.store.SearchSimilar(ctx, queryEmbedding, candidates, filter)
+		if err != nil {
+			return nil, err
+		}
+		for i := range results {
+			results[i].Similarity = results[i].Score
+		}
+		rankings = append(rankings, results)
+		rankingWeights = append(rankingWeights, weights.Vector)
+	}
+
+	if weights.Keyword > 0 {
+		results, err := vs.keywords.Search(ctx, queryText, candidates, filter)
+		if err != nil {
+			return nil, err
+		}
+		rankings = append(rankings, results)
+		rankingWeights = append(rankingWeights, weights.Keyword)
+	}
+
+	return fuseRankings(rankings, rankingWeights, limit), nil
+}
+
+func fuseRankings(rankings [][]SearchResult, weights []float64, limit int) []SearchResult {
+	scores := make(map[string]float64)
+	results := make(map[string]SearchResult)
+	var order []string
+
+	var maxScore float64
+	for i, ranking := range rankings {
+		maxScore += weights[i] / (rrfK + 1)
+
+		for rank, result := range ranking {
+			if _, seen := results[result.ID]; !seen {
+				results[result.ID] = result
+				order = append(order, result.ID)
+			}
+			scores[result.ID] += weights[i] / float64(rrfK+rank+1)
+		}
+	}
+
+	// Stable so ties keep the order of the first ranking that found them.
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+	if limit < len(order) {
+		order = order[:limit]
+	}
+
+	fused := make([]SearchResult, len(order))
+	for i, id := range order {
+		result := results[id]
+		result.Score = float32(scores[id] / maxScore)
+		fused[i] = result
+	}
+
+	return fused
+}
@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newHybridTestService(t *testing.T) *VectorService {
+	t.Helper()
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	database, err := NewDatabase(dir)
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	store, err := NewEmbeddedVectorStore(dir, "chunks", DistanceCosine)
+	if err != nil {
+		t.Fatalf("NewEmbeddedVectorStore failed: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	vs := NewVectorService(store, WithKeywordIndex(NewKeywordIndex(database)))
+
+	chunks := []string{
+		"Therapy options for generalised anxiety disorder.",
+		"Coping strategies and relaxation for anxious patients.",
+		"Sertraline dosage starts at 50mg daily, see section 4.2.1.",
+	}
+	// The sertraline chunk is far from the query embedding used below, so
+	// only keyword search finds it.
+	embeddings := [][]float32{{1, 0}, {0.9, 0.1}, {0, 1}}
+	if err := vs.StoreDocumentChunks(ctx, 1, chunks, embeddings, map[string]string{"file_name": "guide.pdf"}); err != nil {
+		t.Fatalf("StoreDocumentChunks failed: %v", err)
+	}
+
+	return vs
+}
+
+func TestHybridSearchFindsExactTerms(t *testing.T) {
+	ctx := context.Background()
+	vs := newHybridTestService(t)
+	query := []float32{1, 0}
+
+	vectorOnly, err := vs.HybridSearch(ctx, "sertraline dose", query, 1, HybridWeights{Vector: 1}, nil)
+	if err != nil {
+		t.Fatalf("HybridSearch failed: %v", err)
+	}
+	if len(vectorOnly) != 1 || vectorOnly[0].ChunkIndex != 0 {
+		t.Fatalf("expected vector search to rank chunk 0 first, got %+v", vectorOnly)
+	}
+
+	hybrid, err := vs.HybridSearch(ctx, "sertraline dose", query, 1, HybridWeights{Vector: 1, Keyword: 2}, nil)
+	if err != nil {
+		t.Fatalf("HybridSearch failed: %v", err)
+	}
+	if len(hybrid) != 1 || hybrid[0].ChunkIndex != 2 {
+		t.Fatalf("expected the keyword match to win, got %+v", hybrid)
+	}
+	if hybrid[0].Metadata["file_name"] != "guide.pdf" || hybrid[0].DocumentID != 1 {
+		t.Errorf("expected metadata from the keyword index, got %+v", hybrid[0])
+	}
+	if vectorOnly[0].Similarity != 1 {
+		t.Errorf("expected vector similarity 1 for an identical embedding, got %v", vectorOnly[0].Similarity)
+	}
+
+	sections, err := vs.HybridSearch(ctx, "section 4.2.1", nil, 3, HybridWeights{Keyword: 1}, nil)
+	if err != nil {
+		t.Fatalf("HybridSearch failed: %v", err)
+	}
+	if len(sections) != 1 || sections[0].ChunkIndex != 2 || sections[0].Score != 1 {
+		t.Errorf("expected a single perfect keyword match, got %+v", sections)
+	}
+
+	if _, err := vs.HybridSearch(ctx, `NEAR(anxiety "therapy" AND C++ *`, nil, 3, HybridWeights{Keyword: 1}, nil); err != nil {
+		t.Errorf("expected FTS5 syntax in the query to be treated as text, got %v", err)
+	}
+}
+
+func TestHybridSearchScoresAreNormalized(t *testing.T) {
+	ctx := context.Background()
+	vs := newHybridTestService(t)
+
+	results, err := vs.HybridSearch(ctx, "generalised anxiety therapy", []float32{1, 0}, 3, DefaultHybridWeights, nil)
+	if err != nil {
+		t.Fatalf("HybridSearch failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	if results[0].ChunkIndex != 0 || results[0].Score != 1 {
+		t.Errorf("expected chunk 0 ranked first by both methods to score 1, got %+v", results[0])
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Score <= 0 || results[i].Score > results[i-1].Score {
+			t.Errorf("scores must be positive and descending, got %v after %v", results[i].Score, results[i-1].Score)
+		}
+	}
+}
+
+func TestHybridSearchDeletesKeywordEntries(t *testing.T) {
+	ctx := context.Background()
+	vs := newHybridTestService(t)
+
+	if err := vs.DeleteDocumentChunks(ctx, 1); err != nil {
+		t.Fatalf("DeleteDocumentChunks failed: %v", err)
+	}
+
+	results, err := vs.HybridSearch(ctx, "sertraline", nil, 3, HybridWeights{Keyword: 1}, nil)
+	if err != nil {
+		t.Fatalf("HybridSearch failed: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("expected no keyword matches after deleting the document, got %+v", results)
+	}
+}
+
+func TestHybridWeightsValidate(t *testing.T) {
+	for _, weights := range []HybridWeights{{}, {Vector: -1, Keyword: 1}} {
+		if err := weights.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", weights)
+		}
+	}
+}
+
+func TestFTSQueryQuotesUserInput(t *testing.T) {
+	tests := map[string]string{
+		"sertraline dose":      `"sertraline" OR "dose"`,
+		`NEAR(a b) "quoted" ?`: `"NEAR(a" OR "b)" OR """quoted"""`,
+		"Dose dose":            `"Dose"`,
+		"?! --":                "",
+	}
+
+	for input, want := range tests {
+		if got := ftsQuery(input); got != want {
+			t.Errorf("ftsQuery(%q) = %q, expected %q", input, got, want)
+		}
+	}
+}
+
+func TestKeywordIndexForKnowledgeBase(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	handouts := testKnowledgeBase("handouts")
+	if err := s.CreateKnowledgeBase(ctx, &handouts); err != nil {
+		t.Fatalf("CreateKnowledgeBase failed: %v", err)
+	}
+
+	guideline := storeTestDocument(t, s, "guideline.pdf")
+	leaflet, err := s.StoreDocument(ctx, handouts.ID, "leaflet.pdf", strings.NewReader("%PDF-1.4 leaflet"), nil)
+	if err != nil {
+		t.Fatalf("StoreDocument failed: %v", err)
+	}
+
+	index := s.KeywordIndex()
+	err = index.IndexChunks(ctx, []DocumentChunk{
+		{ID: GenerateChunkID(guideline.ID, 0), Content: "Sertraline in the guideline.", DocumentID: guideline.ID},
+		{ID: GenerateChunkID(leaflet.ID, 0), Content: "Sertraline in the leaflet.", DocumentID: leaflet.ID},
+	})
+	if err != nil {
+		t.Fatalf("IndexChunks failed: %v", err)
+	}
+
+	all, _ := index.Search(ctx, "sertraline", 10, nil)
+	if len(all) != 2 {
+		t.Errorf("expected both chunks without a scope, got %d", len(all))
+	}
+
+	scoped, err := index.ForKnowledgeBase(handouts.ID).Search(ctx, "sertraline", 10, nil)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(scoped) != 1 || scoped[0].DocumentID != leaflet.ID {
+		t.Errorf("expected only the handouts chunk, got %+v", scoped)
+	}
+}
+
+func TestVectorServiceTimeout(t *testing.T) {
+	vs := newHybridTestService(t)
+	query := []float32{1, 0}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := vs.HybridSearch(ctx, "sertraline", query, 3, HybridWeights{Vector: 1, Keyword: 1}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled for a cancelled request, got %v", err)
+	}
+
+	WithVectorTimeout(time.Nanosecond)(vs)
+	if _, err := vs.SearchRelevantChunks(context.Background(), query, 3, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded after the timeout, got %v", err)
+	}
+	if err := vs.StoreDocumentChunks(context.Background(), 9, []string{"late"}, [][]float32{query}, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded when storing, got %v", err)
+	}
+}
+
+func TestSearchRejectsInvalidLimit(t *testing.T) {
+	ctx := context.Background()
+	vs := newHybridTestService(t)
+	query := []float32{1, 0}
+
+	for _, limit := range []int{0, -1} {
+		if _, err := vs.SearchRelevantChunks(ctx, query, limit, nil); !errors.Is(err, ErrInvalidLimit) || !errors.Is(err, ErrInvalid) {
+			t.Errorf("SearchRelevantChunks(limit %d): expected ErrInvalidLimit, got %v", limit, err)
+		}
+		if _, err := vs.HybridSearch(ctx, "anxiety", query, limit, DefaultHybridWeights, nil); !errors.Is(err, ErrInvalidLimit) {
+			t.Errorf("HybridSearch(limit %d): expected ErrInvalidLimit, got %v", limit, err)
+		}
+		if _, err := vs.DiverseSearch(ctx, "anxiety", query, limit, DefaultHybridWeights, nil, 0.5); !errors.Is(err, ErrInvalidLimit) {
+			t.Errorf("DiverseSearch(limit %d): expected ErrInvalidLimit, got %v", limit, err)
+		}
+	}
+}
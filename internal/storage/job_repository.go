@@ -0,0 +1,307 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"rag-therapist/pkg/models"
+)
+
+// ErrLeaseLost is returned when a worker updates a job whose lease it no
+// longer holds, because the lease expired and another worker claimed it.
+var ErrLeaseLost = newError(ErrConflict, "job lease lost")
+
+const jobColumns = `id, document_id, status, attempts, max_attempts, last_error, next_run_at,
+	lease_owner, lease_expires_at, created_at, updated_at, finished_at`
+
+// JobRepository stores the ingestion queue. All timestamps are written in
+// UTC so that they compare correctly as text inside SQLite.
+type JobRepository struct {
+	db *Database
+}
+
+func NewJobRepository(db *Database) *JobRepository {
+	return &JobRepository{db: db}
+}
+
+// Enqueue adds a job for the document unless one is already queued or
+// running, in which case the existing job is returned.
+func (r *JobRepository) Enqueue(ctx context.Context, documentID, maxAttempts int, now time.Time) (*models.Job, error) {
+	return r.enqueue(ctx, r.db.db, documentID, maxAttempts, now)
+}
+
+// EnqueueTx is Enqueue as part of the transaction tx.
+func (r *JobRepository) EnqueueTx(ctx context.Context, tx *sql.Tx, documentID, maxAttempts int, now time.Time) (*models.Job, error) {
+	return r.enqueue(ctx, tx, documentID, maxAttempts, now)
+}
+
+func (r *JobRepository) enqueue(ctx context.Context, q querier, documentID, maxAttempts int, now time.Time) (*models.Job, error) {
+	now = now.UTC()
+	query := `
+		INSERT OR IGNORE INTO jobs (document_id, status, attempts, max_attempts, next_run_at, created_at, updated_at)
+		VALUES (?, ?, 0, ?, ?, ?, ?)
+	`
+
+	if _, err := q.ExecContext(ctx, query, documentID, models.JobStatusQueued, maxAttempts, now, now, now); err != nil {
+		return nil, dbError("failed to enqueue job", err)
+	}
+
+	row := q.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE document_id = ? AND status IN (?, ?)`,
+		documentID, models.JobStatusQueued, models.JobStatusRunning)
+
+	job, err := scanJob(row)
+	if err != nil {
+		return nil, dbError("failed to load enqueued job", err)
+	}
+
+	return job, nil
+}
+
+// ClaimNext leases the next runnable job to owner and counts the attempt.
+// A job is runnable when it is queued and due, or running with an expired
+// lease (its worker crashed). Running jobs whose lease expired on their
+// last attempt are failed instead, and their document IDs are returned so
+// the documents can be marked failed too. The claim is a single
+// UPDATE ... RETURNING statement, so two workers never get the same job.
+func (r *JobRepository) ClaimNext(ctx context.Context, owner string, lease time.Duration, now time.Time) (*models.Job, []int, error) {
+	now = now.UTC()
+
+	expired, err := r.failExpired(ctx, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query := `
+		UPDATE jobs
+		SET status = ?, attempts = attempts + 1, lease_owner = ?, lease_expires_at = ?, updated_at = ?
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE (status = ? AND next_run_at <= ?) OR (status = ? AND lease_expires_at <= ?)
+			ORDER BY next_run_at ASC, id ASC LIMIT 1
+		)
+		RETURNING ` + jobColumns
+
+	row := r.db.db.QueryRowContext(ctx, query,
+		models.JobStatusRunning, owner, now.Add(lease), now,
+		models.JobStatusQueued, now, models.JobStatusRunning, now)
+
+	job, err := scanJob(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, expired, nil
+		}
+		return nil, expired, dbError("failed to claim job", err)
+	}
+
+	return job, expired, nil
+}
+
+func (r *JobRepository) failExpired(ctx context.Context, now time.Time) ([]int, error) {
+	query := `
+		UPDATE jobs
+		SET status = ?, last_error = ?, lease_owner = NULL, lease_expires_at = NULL, updated_at = ?, finished_at = ?
+		WHERE status = ? AND lease_expires_at <= ? AND attempts >= max_attempts
+		RETURNING document_id
+	`
+
+	rows, err := r.db.db.QueryContext(ctx, query,
+		models.JobStatusFailed, "worker lease expired on the last attempt", now, now,
+		models.JobStatusRunning, now)
+	if err != nil {
+		return nil, dbError("failed to expire jobs", err)
+	}
+	defer rows.Close()
+
+	var documentIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, dbError("failed to scan expired job", err)
+		}
+		documentIDs = append(documentIDs, id)
+	}
+
+	return documentIDs, rows.Err()
+}
+
+// ExpireLeases ends the lease of every running job, so the next claim
+// takes them over (or fails them, on their last attempt) as if their
+// workers had crashed. It returns the number of jobs affected.
+func (r *JobRepository) ExpireLeases(ctx context.Context, now time.Time) (int, error) {
+	now = now.UTC()
+	query := `UPDATE jobs SET lease_expires_at = ?, updated_at = ? WHERE status = ? AND lease_expires_at > ?`
+
+	result, err := r.db.db.ExecContext(ctx, query, now, now, models.JobStatusRunning, now)
+	if err != nil {
+		return 0, dbError("failed to expire job leases", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, dbError("failed to get affected rows", err)
+	}
+
+	return int(count), nil
+}
+
+// ExtendLease pushes the lease of a running job forward. Workers call it
+// periodically while processing so long documents are not reclaimed.
+func (r *JobRepository) ExtendLease(ctx context.Context, id int, owner string, lease time.Duration, now time.Time) error {
+	now = now.UTC()
+	query := `UPDATE jobs SET lease_expires_at = ?, updated_at = ? WHERE id = ? AND status = ? AND lease_owner = ?`
+
+	return r.execOwned(ctx, query, "failed to extend job lease", now.Add(lease), now, id, models.JobStatusRunning, owner)
+}
+
+// Complete marks a running job as succeeded.
+func (r *JobRepository) Complete(ctx context.Context, id int, owner string, now time.Time) error {
+	now = now.UTC()
+	query := `
+		UPDATE jobs SET status = ?, last_error = NULL, lease_owner = NULL, lease_expires_at = NULL, updated_at = ?, finished_at = ?
+		WHERE id = ? AND status = ? AND lease_owner = ?
+	`
+
+	return r.execOwned(ctx, query, "failed to complete job", models.JobStatusSucceeded, now, now, id, models.JobStatusRunning, owner)
+}
+
+// Retry puts a running job back in the queue to run again at nextRunAt.
+func (r *JobRepository) Retry(ctx context.Context, id int, owner, reason string, nextRunAt, now time.Time) error {
+	now = now.UTC()
+	query := `
+		UPDATE jobs SET status = ?, last_error = ?, next_run_at = ?, lease_owner = NULL, lease_expires_at = NULL, updated_at = ?
+		WHERE id = ? AND status = ? AND lease_owner = ?
+	`
+
+	return r.execOwned(ctx, query, "failed to reschedule job", models.JobStatusQueued, reason, nextRunAt.UTC(), now, id, models.JobStatusRunning, owner)
+}
+
+// Fail marks a running job as permanently failed.
+func (r *JobRepository) Fail(ctx context.Context, id int, owner, reason string, now time.Time) error {
+	now = now.UTC()
+	query := `
+		UPDATE jobs SET status = ?, last_error = ?, lease_owner = NULL, lease_expires_at = NULL, updated_at = ?, finished_at = ?
+		WHERE id = ? AND status = ? AND lease_owner = ?
+	`
+
+	return r.execOwned(ctx, query, "failed to fail job", models.JobStatusFailed, reason, now, now, id, models.JobStatusRunning, owner)
+}
+
+// Release gives a running job back to the queue without counting the
+// attempt, e.g. when the worker is shutting down.
+func (r *JobRepository) Release(ctx context.Context, id int, owner string, now time.Time) error {
+	now = now.UTC()
+	query := `
+		UPDATE jobs SET status = ?, attempts = MAX(attempts - 1, 0), next_run_at = ?, lease_owner = NULL, lease_expires_at = NULL, updated_at = ?
+		WHERE id = ? AND status = ? AND lease_owner = ?
+	`
+
+	return r.execOwned(ctx, query, "failed to release job", models.JobStatusQueued, now, now, id, models.JobStatusRunning, owner)
+}
+
+// Postpone gives a running job back to the queue without counting the
+// attempt and runs it again at nextRunAt, e.g. while a dependency is down.
+func (r *JobRepository) Postpone(ctx context.Context, id int, owner, reason string, nextRunAt, now time.Time) error {
+	now = now.UTC()
+	query := `
+		UPDATE jobs SET status = ?, attempts = MAX(attempts - 1, 0), last_error = ?, next_run_at = ?, lease_owner = NULL, lease_expires_at = NULL, updated_at = ?
+		WHERE id = ? AND status = ? AND lease_owner = ?
+	`
+
+	return r.execOwned(ctx, query, "failed to postpone job", models.JobStatusQueued, reason, nextRunAt.UTC(), now, id, models.JobStatusRunning, owner)
+}
+
+func (r *JobRepository) execOwned(ctx context.Context, query, errMessage string, args ...interface{}) error {
+	result, err := r.db.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return dbError(errMessage, err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return dbError("failed to get affected rows", err)
+	}
+	if count == 0 {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+// ListByDocument returns every job ever created for a document, oldest
+// first.
+func (r *JobRepository) ListByDocument(ctx context.Context, documentID int) ([]*models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE document_id = ? ORDER BY created_at ASC, id ASC`
+
+	rows, err := r.db.db.QueryContext(ctx, query, documentID)
+	if err != nil {
+		return nil, dbError("failed to query jobs", err)
+	}
+	defer rows.Close()
+
+	jobs := []*models.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, dbError("failed to scan job", err)
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// DocumentsWithoutActiveJob returns the IDs of documents that still need
+// processing (pending or processing) but have no queued or running job,
+// e.g. documents uploaded before the job queue existed.
+func (r *JobRepository) DocumentsWithoutActiveJob(ctx context.Context) ([]int, error) {
+	query := `
+		SELECT d.id FROM documents d
+		WHERE d.status IN (?, ?)
+		AND NOT EXISTS (SELECT 1 FROM jobs j WHERE j.document_id = d.id AND j.status IN (?, ?))
+		ORDER BY d.uploaded_at ASC, d.id ASC
+	`
+
+	rows, err := r.db.db.QueryContext(ctx, query,
+		models.DocumentStatusPending, models.DocumentStatusProcessing,
+		models.JobStatusQueued, models.JobStatusRunning)
+	if err != nil {
+		return nil, dbError("failed to query documents without jobs", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, dbError("failed to scan document id", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func scanJob(row rowScanner) (*models.Job, error) {
+	var job models.Job
+	var lastError, leaseOwner sql.NullString
+	var leaseExpiresAt, finishedAt sql.NullTime
+
+	err := row.Scan(&job.ID, &job.DocumentID, &job.Status, &job.Attempts, &job.MaxAttempts, &lastError, &job.NextRunAt,
+		&leaseOwner, &leaseExpiresAt, &job.CreatedAt, &job.UpdatedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	job.LastError = lastError.String
+	job.LeaseOwner = leaseOwner.String
+	if leaseExpiresAt.Valid {
+		job.LeaseExpiresAt = &leaseExpiresAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+
+	return &job, nil
+}
@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// KeywordIndex is a full-text index of chunk text in the SQLite FTS5
+// table chunks_fts, searched with BM25. It catches exact terms such as
+// drug names, acronyms and section numbers that embeddings blur. The
+// table is shared by all knowledge bases; ForKnowledgeBase scopes searches
+// to one of them.
+type KeywordIndex struct {
+	db              *Database
+	knowledgeBaseID int
+}
+
+func NewKeywordIndex(db *Database) *KeywordIndex {
+	return &KeywordIndex{db: db}
+}
+
+// ForKnowledgeBase returns a view of the index whose searches only match
+// chunks of documents in the given knowledge base.
+func (k *KeywordIndex) ForKnowledgeBase(id int) *KeywordIndex {
+	return &KeywordIndex{db: k.db, knowledgeBaseID: id}
+}
+
+// IndexChunks adds chunks to the index, replacing any with the same IDs.
+func (k *KeywordIndex) IndexChunks(ctx context.Context, chunks []DocumentChunk) error {
+	tx, err := k.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError("failed to begin keyword indexing", err)
+	}
+	defer tx.Rollback()
+
+	for _, chunk := range chunks {
+		metadata, err := json.Marshal(chunk.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to encode chunk metadata: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM chunks_fts WHERE chunk_id = ?`, chunk.ID); err != nil {
+			return dbError("failed to replace indexed chunk", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO chunks_fts (content, chunk_id, document_id, chunk_index, metadata) VALUES (?, ?, ?, ?, ?)`,
+			chunk.Content, chunk.ID, chunk.DocumentID, chunk.ChunkIndex, string(metadata))
+		if err != nil {
+			return dbError("failed to index chunk", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dbError("failed to commit keyword indexing", err)
+	}
+	return nil
+}
+
+func (k *KeywordIndex) DeleteByDocumentID(ctx context.Context, documentID int) error {
+	if _, err := k.db.db.ExecContext(ctx, `DELETE FROM chunks_fts WHERE document_id = ?`, documentID); err != nil {
+		return dbError("failed to delete indexed chunks", err)
+	}
+	return nil
+}
+
+// Search returns the chunks that best match the words of query, best
+// first. Score is the negated BM25 rank: higher is better, but it is not
+// bounded and only comparable within one query. Only chunks matching
+// filter, which may be nil, are considered.
+func (k *KeywordIndex) Search(ctx context.Context, query string, limit int, filter *SearchFilter) ([]SearchResult, error) {
+	// SQLite treats a negative LIMIT as no limit at all.
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, nil
+	}
+
+	where := "chunks_fts MATCH ?"
+	args := []interface{}{match}
+	if k.knowledgeBaseID != 0 {
+		where += " AND document_id IN (SELECT id FROM documents WHERE knowledge_base_id = ?)"
+		args = append(args, k.knowledgeBaseID)
+	}
+	if condition, filterArgs := filter.sqlWhere(); condition != "" {
+		where += " AND " + condition
+		args = append(args, filterArgs...)
+	}
+	args = append(args, limit)
+
+	rows, err := k.db.db.QueryContext(ctx, `
+		SELECT chunk_id, content, document_id, chunk_index, metadata, bm25(chunks_fts)
+		FROM chunks_fts WHERE `+where+`
+		ORDER BY bm25(chunks_fts) LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, dbError("failed to search keyword index", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var result SearchResult
+		var metadata string
+		var rank float64
+
+		if err := rows.Scan(&result.ID, &result.Content, &result.DocumentID, &result.ChunkIndex, &metadata, &rank); err != nil {
+			return nil, dbError("failed to scan keyword match", err)
+		}
+		if err := json.Unmarshal([]byte(metadata), &result.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to decode chunk metadata: %w", err)
+		}
+		result.Score = float32(-rank)
+
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// ftsQuery turns free text into an FTS5 query that matches any of its
+// words. Each word is quoted as a phrase, so FTS5 syntax in user input is
+// never interpreted and "4.2.1" still matches the adjacent tokens 4 2 1.
+func ftsQuery(text string) string {
+	var phrases []string
+	seen := make(map[string]bool)
+
+	for _, word := range strings.Fields(text) {
+		if !strings.ContainsFunc(word, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) {
+			continue
+		}
+
+		key := strings.ToLower(word)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		phrases = append(phrases, `"`+strings.ReplaceAll(word, `"`, `""`)+`"`)
+	}
+
+	return strings.Join(phrases, " OR ")
+}
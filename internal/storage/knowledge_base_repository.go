@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"rag-therapist/pkg/models"
+)
+
+var (
+	ErrKnowledgeBaseNotFound = newError(ErrNotFound, "knowledge base not found")
+	ErrKnowledgeBaseExists   = newError(ErrDuplicate, "a knowledge base with this name already exists")
+	ErrKnowledgeBaseNotEmpty = newError(ErrConflict, "knowledge base still has documents")
+	ErrDefaultKnowledgeBase  = newError(ErrConflict, "the default knowledge base cannot be deleted")
+)
+
+const knowledgeBaseColumns = `id, name, description, collection_name, embedding_model, embedding_dimensions,
+	chunk_strategy, chunk_size, chunk_overlap, is_default, created_at, updated_at`
+
+type KnowledgeBaseRepository struct {
+	db *Database
+}
+
+func NewKnowledgeBaseRepository(db *Database) *KnowledgeBaseRepository {
+	return &KnowledgeBaseRepository{db: db}
+}
+
+// Insert stores a new knowledge base. Unless kb.CollectionName is set, the
+// collection is named after the new ID, so it never changes on rename.
+func (r *KnowledgeBaseRepository) Insert(ctx context.Context, kb *models.KnowledgeBase) error {
+	tx, err := r.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError("failed to begin knowledge base insert", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO knowledge_bases (name, description, collection_name, embedding_model, embedding_dimensions,
+			chunk_strategy, chunk_size, chunk_overlap, is_default, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, kb.Name, kb.Description, kb.CollectionName, kb.EmbeddingModel, kb.EmbeddingDimensions,
+		kb.ChunkStrategy, kb.ChunkSize, kb.ChunkOverlap, kb.IsDefault, now, now)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrKnowledgeBaseExists
+		}
+		return dbError("failed to insert knowledge base", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return dbError("failed to get last insert id", err)
+	}
+
+	collectionName := kb.CollectionName
+	if collectionName == "" {
+		collectionName = fmt.Sprintf("kb_%d_chunks", id)
+		if _, err := tx.ExecContext(ctx, `UPDATE knowledge_bases SET collection_name = ? WHERE id = ?`, collectionName, id); err != nil {
+			return dbError("failed to name knowledge base collection", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dbError("failed to commit knowledge base insert", err)
+	}
+
+	kb.ID = int(id)
+	kb.CollectionName = collectionName
+	kb.CreatedAt = now
+	kb.UpdatedAt = now
+	return nil
+}
+
+func (r *KnowledgeBaseRepository) GetByID(ctx context.Context, id int) (*models.KnowledgeBase, error) {
+	row := r.db.db.QueryRowContext(ctx, `SELECT `+knowledgeBaseColumns+` FROM knowledge_bases WHERE id = ?`, id)
+	return r.scanOne(row)
+}
+
+// GetDefault returns the knowledge base used when a request names none.
+func (r *KnowledgeBaseRepository) GetDefault(ctx context.Context) (*models.KnowledgeBase, error) {
+	row := r.db.db.QueryRowContext(ctx, `SELECT `+knowledgeBaseColumns+` FROM knowledge_bases WHERE is_default = 1`)
+	return r.scanOne(row)
+}
+
+func (r *KnowledgeBaseRepository) scanOne(row *sql.Row) (*models.KnowledgeBase, error) {
+	kb, err := scanKnowledgeBase(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrKnowledgeBaseNotFound
+	}
+	if err != nil {
+		return nil, dbError("failed to scan knowledge base", err)
+	}
+	return kb, nil
+}
+
+func (r *KnowledgeBaseRepository) List(ctx context.Context) ([]*models.KnowledgeBase, error) {
+	rows, err := r.db.db.QueryContext(ctx, `SELECT `+knowledgeBaseColumns+` FROM knowledge_bases ORDER BY id ASC`)
+	if err != nil {
+		return nil, dbError("failed to query knowledge bases", err)
+	}
+	defer rows.Close()
+
+	var bases []*models.KnowledgeBase
+	for rows.Next() {
+		kb, err := scanKnowledgeBase(rows)
+		if err != nil {
+			return nil, dbError("failed to scan knowledge base", err)
+		}
+		bases = append(bases, kb)
+	}
+
+	return bases, rows.Err()
+}
+
+// Update saves the name, description and chunking settings. The
+// collection and embedding settings are fixed once chunks exist.
+func (r *KnowledgeBaseRepository) Update(ctx context.Context, kb *models.KnowledgeBase) error {
+	now := time.Now().UTC()
+	result, err := r.db.db.ExecContext(ctx, `
+		UPDATE knowledge_bases
+		SET name = ?, description = ?, chunk_strategy = ?, chunk_size = ?, chunk_overlap = ?, updated_at = ?
+		WHERE id = ?
+	`, kb.Name, kb.Description, kb.ChunkStrategy, kb.ChunkSize, kb.ChunkOverlap, now, kb.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrKnowledgeBaseExists
+		}
+		return dbError("failed to update knowledge base", err)
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrKnowledgeBaseNotFound
+	}
+
+	kb.UpdatedAt = now
+	return nil
+}
+
+// Delete removes an empty, non-default knowledge base.
+func (r *KnowledgeBaseRepository) Delete(ctx context.Context, id int) error {
+	result, err := r.db.db.ExecContext(ctx, `
+		DELETE FROM knowledge_bases
+		WHERE id = ? AND is_default = 0 AND NOT EXISTS (SELECT 1 FROM documents WHERE knowledge_base_id = ?)
+	`, id, id)
+	if err != nil {
+		return dbError("failed to delete knowledge base", err)
+	}
+
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	// Nothing was deleted; find out why.
+	kb, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if kb.IsDefault {
+		return ErrDefaultKnowledgeBase
+	}
+	return ErrKnowledgeBaseNotEmpty
+}
+
+// AdoptOrphanDocuments assigns documents without a knowledge base, which
+// were uploaded before knowledge bases existed, to the given one.
+func (r *KnowledgeBaseRepository) AdoptOrphanDocuments(ctx context.Context, id int) (int, error) {
+	result, err := r.db.db.ExecContext(ctx, `UPDATE documents SET knowledge_base_id = ? WHERE knowledge_base_id IS NULL`, id)
+	if err != nil {
+		return 0, dbError("failed to assign documents to knowledge base", err)
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func scanKnowledgeBase(row rowScanner) (*models.KnowledgeBase, error) {
+	var kb models.KnowledgeBase
+
+	err := row.Scan(&kb.ID, &kb.Name, &kb.Description, &kb.CollectionName, &kb.EmbeddingModel, &kb.EmbeddingDimensions,
+		&kb.ChunkStrategy, &kb.ChunkSize, &kb.ChunkOverlap, &kb.IsDefault, &kb.CreatedAt, &kb.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kb, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
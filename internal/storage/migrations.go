@@ -0,0 +1,284 @@
+package storage
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.sql$`)
+
+// ErrSchemaTooNew is returned when the database has migrations applied
+// that this build does not know about. Running against it could corrupt
+// data written by the newer version.
+var ErrSchemaTooNew = errors.New("database schema is newer than this application")
+
+// migrationChecks run inside a migration's transaction before its SQL, by
+// version. They stop migrations that cannot be applied to the data as it
+// is, explaining what to fix.
+var migrationChecks = map[int]func(tx *sql.Tx) error{
+	9: checkDuplicateDocuments,
+}
+
+// Migration is one versioned schema change, loaded from
+// migrations/NNNN_name.sql.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// MigrationState is a known migration and when it was applied, if it was.
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Migrations returns the embedded migrations ordered by version. Versions
+// must be contiguous from 1.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	var migrations []Migration
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migrations = append(migrations, Migration{Version: version, Name: match[2], SQL: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be contiguous from 1, found %d at position %d", m.Version, i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// initSchemaVersion creates the schema_version table, adopts databases
+// created before migrations existed and refuses schemas newer than the
+// embedded migrations.
+func (d *Database) initSchemaVersion() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME NOT NULL
+	);
+	`
+	if _, err := d.db.Exec(query); err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	if err := d.adoptLegacySchema(migrations); err != nil {
+		return err
+	}
+
+	version, err := d.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("%w: database is at version %d, this build knows up to %d", ErrSchemaTooNew, version, len(migrations))
+	}
+
+	return nil
+}
+
+// adoptLegacySchema records the migrations that a database created by the
+// old CREATE TABLE IF NOT EXISTS setup already has, so they are not run
+// twice.
+func (d *Database) adoptLegacySchema(migrations []Migration) error {
+	version, err := d.SchemaVersion()
+	if err != nil || version > 0 {
+		return err
+	}
+
+	hasDocuments, err := d.tableExists("documents")
+	if err != nil || !hasDocuments {
+		return err
+	}
+
+	adopted := migrations[:1]
+	hasErrorMessage, err := d.columnExists("documents", "error_message")
+	if err != nil {
+		return err
+	}
+	if hasErrorMessage {
+		adopted = migrations[:2]
+	}
+
+	now := time.Now().UTC()
+	for _, m := range adopted {
+		if _, err := d.db.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`, m.Version, m.Name, now); err != nil {
+			return fmt.Errorf("failed to record existing schema: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// SchemaVersion returns the version of the last applied migration, or 0
+// for an empty database.
+func (d *Database) SchemaVersion() (int, error) {
+	var version int
+	if err := d.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// MigrationStatus lists every known migration with the time it was
+// applied, or nil if it is pending.
+func (d *Database) MigrationStatus() ([]MigrationState, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(`SELECT version, applied_at FROM schema_version`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_version: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_version: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query schema_version: %w", err)
+	}
+
+	states := make([]MigrationState, len(migrations))
+	for i, m := range migrations {
+		states[i] = MigrationState{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := applied[m.Version]; ok {
+			states[i].AppliedAt = &appliedAt
+		}
+	}
+
+	return states, nil
+}
+
+// Migrate applies pending migrations in order, each in its own
+// transaction together with its schema_version row, and returns the ones
+// it applied.
+func (d *Database) Migrate() ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := d.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range migrations[version:] {
+		if err := d.applyMigration(m); err != nil {
+			return applied, err
+		}
+		applied = append(applied, m)
+	}
+
+	return applied, nil
+}
+
+func (d *Database) applyMigration(m Migration) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin migration %04d: %w", m.Version, err)
+	}
+	defer tx.Rollback()
+
+	if check := migrationChecks[m.Version]; check != nil {
+		if err := check(tx); err != nil {
+			return fmt.Errorf("migration %04d_%s cannot be applied: %w", m.Version, m.Name, err)
+		}
+	}
+
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`, m.Version, m.Name, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record migration %04d: %w", m.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %04d: %w", m.Version, err)
+	}
+
+	return nil
+}
+
+// checkDuplicateDocuments refuses the unique content index while a
+// knowledge base holds the same file more than once, which concurrent
+// uploads could cause before the index existed. It names the copies, all
+// but the oldest of each file, so they can be deleted first.
+func checkDuplicateDocuments(tx *sql.Tx) error {
+	rows, err := tx.Query(`
+		SELECT id FROM documents
+		WHERE id NOT IN (SELECT MIN(id) FROM documents GROUP BY knowledge_base_id, content_hash)
+		ORDER BY id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to look for duplicate documents: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("failed to scan duplicate document: %w", err)
+		}
+		ids = append(ids, strconv.Itoa(id))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to look for duplicate documents: %w", err)
+	}
+
+	if len(ids) > 0 {
+		return fmt.Errorf("documents %s are copies of files uploaded earlier to the same knowledge base; "+
+			"delete them with the previous version (DELETE /documents/{id}) and start again", strings.Join(ids, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS documents (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	file_name TEXT NOT NULL,
+	file_path TEXT NOT NULL UNIQUE,
+	file_size INTEGER NOT NULL,
+	content_hash TEXT NOT NULL,
+	uploaded_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	processed_at DATETIME,
+	status TEXT NOT NULL DEFAULT 'pending'
+);
+
+CREATE INDEX IF NOT EXISTS idx_documents_status ON documents(status);
+CREATE INDEX IF NOT EXISTS idx_documents_uploaded_at ON documents(uploaded_at);
+CREATE INDEX IF NOT EXISTS idx_documents_content_hash ON documents(content_hash);
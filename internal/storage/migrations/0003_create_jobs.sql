@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS jobs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	status TEXT NOT NULL DEFAULT 'queued',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL,
+	last_error TEXT,
+	next_run_at DATETIME NOT NULL,
+	lease_owner TEXT,
+	lease_expires_at DATETIME,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	finished_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_document_id ON jobs(document_id);
+CREATE INDEX IF NOT EXISTS idx_jobs_status_next_run_at ON jobs(status, next_run_at);
+-- At most one queued or running job per document.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_active_document ON jobs(document_id) WHERE status IN ('queued', 'running');
@@ -0,0 +1,10 @@
+-- Full-text index of chunk text for BM25 keyword search. It mirrors the
+-- chunks in the vector store and is kept in sync by VectorService.
+CREATE VIRTUAL TABLE IF NOT EXISTS chunks_fts USING fts5(
+	content,
+	chunk_id UNINDEXED,
+	document_id UNINDEXED,
+	chunk_index UNINDEXED,
+	metadata UNINDEXED,
+	tokenize = 'porter unicode61'
+);
@@ -0,0 +1 @@
+ALTER TABLE documents ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
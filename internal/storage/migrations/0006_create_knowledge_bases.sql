@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS knowledge_bases (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	description TEXT NOT NULL DEFAULT '',
+	collection_name TEXT NOT NULL,
+	embedding_model TEXT NOT NULL,
+	embedding_dimensions INTEGER NOT NULL DEFAULT 0,
+	chunk_strategy TEXT NOT NULL,
+	chunk_size INTEGER NOT NULL,
+	chunk_overlap INTEGER NOT NULL,
+	is_default INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+
+-- At most one default knowledge base.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_knowledge_bases_default ON knowledge_bases(is_default) WHERE is_default = 1;
+
+-- Documents uploaded before knowledge bases existed are assigned to the
+-- default knowledge base when it is created on startup.
+ALTER TABLE documents ADD COLUMN knowledge_base_id INTEGER REFERENCES knowledge_bases(id);
+CREATE INDEX IF NOT EXISTS idx_documents_knowledge_base_id ON documents(knowledge_base_id);
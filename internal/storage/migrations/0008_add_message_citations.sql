@@ -0,0 +1,2 @@
+-- citations lists the [n] references parsed from an assistant message.
+ALTER TABLE messages ADD COLUMN citations TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,5 @@
+-- Concurrent uploads of the same file could both pass the duplicate check
+-- before either was inserted. checkDuplicateDocuments stops this migration
+-- while such copies exist, since only the application can delete them
+-- together with their files and vectors.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_documents_knowledge_base_content_hash ON documents(knowledge_base_id, content_hash);
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewDatabaseAppliesAllMigrations(t *testing.T) {
+	database, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer database.Close()
+
+	migrations, _ := Migrations()
+	version, err := database.SchemaVersion()
+	if err != nil {
+		t.Fatalf("SchemaVersion failed: %v", err)
+	}
+	if version != len(migrations) {
+		t.Errorf("expected schema version %d, got %d", len(migrations), version)
+	}
+
+	applied, err := database.Migrate()
+	if err != nil || len(applied) != 0 {
+		t.Errorf("expected nothing left to migrate, got %v, %v", applied, err)
+	}
+}
+
+func TestOpenDatabaseAdoptsLegacySchema(t *testing.T) {
+	dataDir := t.TempDir()
+
+	// The schema created before migrations existed.
+	raw, err := sql.Open("sqlite", filepath.Join(dataDir, "rag-therapist.db"))
+	if err != nil {
+		t.Fatalf("sql.Open failed: %v", err)
+	}
+	_, err = raw.Exec(`CREATE TABLE documents (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		file_name TEXT NOT NULL,
+		file_path TEXT NOT NULL UNIQUE,
+		file_size INTEGER NOT NULL,
+		content_hash TEXT NOT NULL,
+		uploaded_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		processed_at DATETIME,
+		status TEXT NOT NULL DEFAULT 'pending'
+	)`)
+	raw.Close()
+	if err != nil {
+		t.Fatalf("failed to create legacy schema: %v", err)
+	}
+
+	database, err := OpenDatabase(dataDir)
+	if err != nil {
+		t.Fatalf("OpenDatabase failed: %v", err)
+	}
+	defer database.Close()
+
+	states, err := database.MigrationStatus()
+	if err != nil {
+		t.Fatalf("MigrationStatus failed: %v", err)
+	}
+	if states[0].AppliedAt == nil || states[1].AppliedAt != nil {
+		t.Fatalf("expected only the first migration to be adopted, got %+v", states)
+	}
+
+	if _, err := database.Migrate(); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if ok, _ := database.columnExists("documents", "error_message"); !ok {
+		t.Error("expected error_message column after migrating")
+	}
+}
+
+func TestOpenDatabaseRefusesNewerSchema(t *testing.T) {
+	dataDir := t.TempDir()
+
+	database, err := NewDatabase(dataDir)
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	_, err = database.db.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (999, 'from_the_future', CURRENT_TIMESTAMP)`)
+	database.Close()
+	if err != nil {
+		t.Fatalf("failed to insert future version: %v", err)
+	}
+
+	if _, err := OpenDatabase(dataDir); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("expected ErrSchemaTooNew, got %v", err)
+	}
+}
+
+func TestUniqueContentMigrationRefusesDuplicates(t *testing.T) {
+	database, err := OpenDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenDatabase failed: %v", err)
+	}
+	defer database.Close()
+
+	migrations, _ := Migrations()
+	for _, m := range migrations[:8] {
+		if err := database.applyMigration(m); err != nil {
+			t.Fatalf("applyMigration %d failed: %v", m.Version, err)
+		}
+	}
+
+	// Two concurrent uploads of the same file, and an unrelated one.
+	_, err = database.db.Exec(`
+		INSERT INTO knowledge_bases (name, collection_name, embedding_model, chunk_strategy, chunk_size, chunk_overlap, created_at, updated_at)
+		VALUES ('default', 'chunks', 'test-embedding', 'recursive', 1000, 200, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
+		INSERT INTO documents (knowledge_base_id, file_name, file_path, file_size, content_hash) VALUES
+			(1, 'a.pdf', 'a1.pdf', 1, 'same'),
+			(1, 'a.pdf', 'a2.pdf', 1, 'same'),
+			(1, 'b.pdf', 'b.pdf', 1, 'other');
+	`)
+	if err != nil {
+		t.Fatalf("failed to insert documents: %v", err)
+	}
+
+	_, err = database.Migrate()
+	if err == nil || !strings.Contains(err.Error(), "documents 2 are copies") {
+		t.Fatalf("expected the migration to name document 2, got %v", err)
+	}
+	if version, _ := database.SchemaVersion(); version != 8 {
+		t.Errorf("expected the schema to stay at version 8, got %d", version)
+	}
+
+	var count int
+	database.db.QueryRow(`SELECT COUNT(*) FROM documents WHERE content_hash = 'same'`).Scan(&count)
+	if count != 2 {
+		t.Errorf("expected the documents to be left alone, found %d copies", count)
+	}
+
+	if _, err := database.db.Exec(`DELETE FROM documents WHERE id = 2`); err != nil {
+		t.Fatalf("failed to delete the copy: %v", err)
+	}
+	if _, err := database.Migrate(); err != nil {
+		t.Fatalf("Migrate failed after deleting the copy: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// DefaultMMRLambda keeps the ranking by relevance alone, i.e. no
+// diversification.
+const DefaultMMRLambda = 1.0
+
+// MMR re-ranks a candidate set this many times the requested size, with a
+// minimum, like the rankings in HybridSearch.
+const (
+	mmrCandidateFactor = 4
+	mmrMinCandidates   = 20
+)
+
+// ValidateMMRLambda checks that lambda lies in [0, 1].
+func ValidateMMRLambda(lambda float64) error {
+	if lambda < 0 || lambda > 1 {
+		return fmt.Errorf("mmr lambda must be between 0 and 1")
+	}
+	return nil
+}
+
+// DiverseSearch is HybridSearch with maximal marginal relevance re-ranking.
+// It takes a larger candidate set and fetches the candidates' embeddings,
+// then repeatedly picks the candidate with the highest
+//
+//	lambda * relevance - (1 - lambda) * max similarity to the picked ones
+//
+// where relevance is the hybrid score in 0..1 and similarity the cosine
+// similarity of the chunk embeddings, counted from 0. Lambda 1 ranks by
+// relevance only; lower values favour chunks unlike those already picked,
+// so a passage repeated in a document fills one slot instead of all of
+// them. Results keep their hybrid score and are returned in the order
+// they were picked.
+func (vs *VectorService) DiverseSearch(ctx context.Context, queryText string, queryEmbedding []float32, limit int, weights HybridWeights, filter *SearchFilter, lambda float64) ([]SearchResult, error) {
+	if err := ValidateMMRLambda(lambda); err != nil {
+		return nil, err
+	}
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+	if lambda == 1 {
+		return vs.HybridSearch(ctx, queryText, queryEmbedding, limit, weights, filter)
+	}
+
+	ctx, cancel := vs.withTimeout(ctx)
+	defer cancel()
+
+	candidates := limit * mmrCandidateFactor
+	if candidates < mmrMinCandidates {
+		candidates = mmrMinCandidates
+	}
+
+	results, err := vs.HybridSearch(ctx, queryText, queryEmbedding, candidates, weights, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) <= 1 {
+		return results, nil
+	}
+
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	embeddings, err := vs.store.GetEmbeddings(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return maximalMarginalRelevance(results, embeddings, limit, lambda), nil
+}
+
+// maximalMarginalRelevance picks limit of the candidates greedily. A
+// candidate without an embedding counts as unlike every other.
+func maximalMarginalRelevance(candidates []SearchResult, embeddings map[string][]float32, limit int, lambda float64) []SearchResult {
+	remaining := append([]SearchResult(nil), candidates...)
+	// redundancy[i] is the highest similarity of remaining[i] to a pick.
+	redundancy := make([]float64, len(remaining))
+
+	var picked []SearchResult
+	for len(picked) < limit && len(remaining) > 0 {
+		best, bestScore := 0, 0.0
+		for i, candidate := range remaining {
+			score := lambda*float64(candidate.Score) - (1-lambda)*redundancy[i]
+			if i == 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		choice := remaining[best]
+		picked = append(picked, choice)
+		remaining = append(remaining[:best], remaining[best+1:]...)
+		redundancy = append(redundancy[:best], redundancy[best+1:]...)
+
+		chosen, ok := embeddings[choice.ID]
+		if !ok {
+			continue
+		}
+		for i, candidate := range remaining {
+			embedding, ok := embeddings[candidate.ID]
+			if !ok || len(embedding) != len(chosen) {
+				continue
+			}
+			similarity := 1 - float64(DistanceCosine.distance(chosen, embedding))
+			if similarity > redundancy[i] {
+				redundancy[i] = similarity
+			}
+		}
+	}
+
+	return picked
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func newMMRTestService(t *testing.T) *VectorService {
+	t.Helper()
+	ctx := context.Background()
+
+	store := openEmbeddedStore(t, t.TempDir())
+	vs := NewVectorService(store)
+
+	// The same passage is repeated three times; the last chunk covers
+	// another aspect of the topic.
+	chunks := []string{
+		"Sleep restriction limits the time in bed.",
+		"Sleep restriction limits the time in bed.",
+		"Sleep restriction limits the time in bed.",
+		"Stimulus control ties the bed to sleep.",
+	}
+	embeddings := [][]float32{{1, 0}, {1, 0}, {1, 0.01}, {0.6, 0.8}}
+	if err := vs.StoreDocumentChunks(ctx, 1, chunks, embeddings, nil); err != nil {
+		t.Fatalf("StoreDocumentChunks failed: %v", err)
+	}
+	return vs
+}
+
+func TestDiverseSearchSkipsRepeatedPassages(t *testing.T) {
+	ctx := context.Background()
+	vs := newMMRTestService(t)
+	query := []float32{1, 0}
+
+	relevant, err := vs.DiverseSearch(ctx, "", query, 2, HybridWeights{Vector: 1}, nil, 1)
+	if err != nil {
+		t.Fatalf("DiverseSearch failed: %v", err)
+	}
+	if len(relevant) != 2 || relevant[1].ChunkIndex == 3 {
+		t.Fatalf("expected lambda 1 to rank by relevance only, got %+v", relevant)
+	}
+
+	diverse, err := vs.DiverseSearch(ctx, "", query, 2, HybridWeights{Vector: 1}, nil, 0.5)
+	if err != nil {
+		t.Fatalf("DiverseSearch failed: %v", err)
+	}
+	if len(diverse) != 2 || diverse[0].ChunkIndex != 0 || diverse[1].ChunkIndex != 3 {
+		t.Errorf("expected the repeated passage once and then the other chunk, got %+v", diverse)
+	}
+	if diverse[1].Score >= diverse[0].Score {
+		t.Errorf("expected results to keep their hybrid scores, got %+v", diverse)
+	}
+}
+
+func TestDiverseSearchValidatesLambda(t *testing.T) {
+	ctx := context.Background()
+	vs := newMMRTestService(t)
+
+	for _, lambda := range []float64{-0.1, 1.5} {
+		if _, err := vs.DiverseSearch(ctx, "", []float32{1, 0}, 2, HybridWeights{Vector: 1}, nil, lambda); err == nil {
+			t.Errorf("expected lambda %v to be rejected", lambda)
+		}
+	}
+}
+
+func TestMaximalMarginalRelevanceWithoutEmbeddings(t *testing.T) {
+	candidates := []SearchResult{{ID: "a", Score: 0.9}, {ID: "b", Score: 0.8}, {ID: "c", Score: 0.7}}
+
+	picked := maximalMarginalRelevance(candidates, nil, 2, 0.3)
+	if len(picked) != 2 || picked[0].ID != "a" || picked[1].ID != "b" {
+		t.Errorf("expected relevance order without embeddings, got %+v", picked)
+	}
+}
@@ -0,0 +1,30 @@
+package storage
+
+import "time"
+
+// RetryPolicy controls how often a failed ingestion job is retried and how
+// long it waits between attempts.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   30 * time.Second,
+	MaxDelay:    15 * time.Minute,
+}
+
+// Backoff returns the delay before the next attempt after attempt failed:
+// BaseDelay doubled for every earlier failure, capped at MaxDelay.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
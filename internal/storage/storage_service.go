@@ -1,18 +1,65 @@
 package storage
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"io"
+	"os"
 	"time"
 
 	"rag-therapist/pkg/models"
 )
 
+// DefaultQueryTimeout bounds every StorageService operation on the
+// database.
+const DefaultQueryTimeout = 10 * time.Second
+
 type StorageService struct {
-	fileStorage *FileStorage
-	docRepo     *DocumentRepository
+	database     *Database
+	fileStorage  *FileStorage
+	docRepo      *DocumentRepository
+	jobRepo      *JobRepository
+	kbRepo       *KnowledgeBaseRepository
+	convRepo     *ConversationRepository
+	retryPolicy  RetryPolicy
+	queryTimeout time.Duration
+}
+
+type Option func(*StorageService)
+
+// WithRetryPolicy sets how failed ingestion jobs are retried.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(s *StorageService) {
+		s.retryPolicy = policy
+	}
+}
+
+// WithQueryTimeout sets how long an operation may take before its
+// database queries are cancelled. Zero or less turns the timeout off.
+func WithQueryTimeout(timeout time.Duration) Option {
+	return func(s *StorageService) {
+		s.queryTimeout = timeout
+	}
+}
+
+// WithMaxDocumentSize sets the largest upload StoreDocument accepts, in
+// bytes. Zero or less turns the limit off.
+func WithMaxDocumentSize(size int64) Option {
+	return func(s *StorageService) {
+		s.fileStorage.maxSize = size
+	}
 }
 
-func NewStorageService(dataDir string) (*StorageService, error) {
+// WithDocumentCheck sets a check, such as ingest.CheckPDF, that every
+// upload must pass before StoreDocument keeps it.
+func WithDocumentCheck(check DocumentCheck) Option {
+	return func(s *StorageService) {
+		s.fileStorage.check = check
+	}
+}
+
+func NewStorageService(dataDir string, opts ...Option) (*StorageService, error) {
 	database, err := NewDatabase(dataDir)
 	if err != nil {
 		return nil, err
@@ -20,72 +67,496 @@ func NewStorageService(dataDir string) (*StorageService, error) {
 
 	fileStorage, err := NewFileStorage(dataDir)
 	if err != nil {
+		database.Close()
 		return nil, err
 	}
 
-	docRepo := NewDocumentRepository(database)
+	s := &StorageService{
+		database:     database,
+		fileStorage:  fileStorage,
+		docRepo:      NewDocumentRepository(database),
+		jobRepo:      NewJobRepository(database),
+		kbRepo:       NewKnowledgeBaseRepository(database),
+		convRepo:     NewConversationRepository(database),
+		retryPolicy:  DefaultRetryPolicy,
+		queryTimeout: DefaultQueryTimeout,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
 
-	return &StorageService{
-		fileStorage: fileStorage,
-		docRepo:     docRepo,
-	}, nil
+	return s, nil
 }
 
-func (s *StorageService) StoreDocument(fileName string, content io.Reader) (*models.Document, error) {
+// StoreDocument saves an upload into a knowledge base and queues it for
+// processing. tags are normalized with NormalizeTags. fileName is kept as
+// the document's name only, cut to MaxDocumentNameLength bytes; the file
+// on disk gets a sanitized name.
+// Uploads that are not PDFs, too large or fail the document check are
+// errors in the ErrInvalid category. Re-uploading a file
+// that the knowledge base already holds returns the existing document,
+// unchanged, together with ErrDuplicateDocument.
+func (s *StorageService) StoreDocument(ctx context.Context, knowledgeBaseID int, fileName string, content io.Reader, tags []string) (*models.Document, error) {
+	if _, err := s.GetKnowledgeBase(ctx, knowledgeBaseID); err != nil {
+		return nil, err
+	}
+
 	filePath, contentHash, fileSize, err := s.fileStorage.SaveDocument(fileName, content)
 	if err != nil {
 		return nil, err
 	}
 
-	existing, err := s.docRepo.GetByContentHash(contentHash)
-	if err == nil {
-		s.fileStorage.DeleteDocument(filePath)
-		return existing, nil
-	}
+	// Reading a large upload may take longer than the timeout, so it only
+	// starts now.
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
 	doc := &models.Document{
-		FileName:    fileName,
-		FilePath:    filePath,
-		FileSize:    fileSize,
-		ContentHash: contentHash,
-		UploadedAt:  time.Now(),
-		Status:      models.DocumentStatusPending,
+		KnowledgeBaseID: knowledgeBaseID,
+		FileName:        truncateFileName(fileName, MaxDocumentNameLength),
+		FilePath:        filePath,
+		FileSize:        fileSize,
+		ContentHash:     contentHash,
+		UploadedAt:      time.Now(),
+		Status:          models.DocumentStatusPending,
+		Tags:            NormalizeTags(tags),
 	}
 
-	if err := s.docRepo.Insert(doc); err != nil {
+	// The database refuses the duplicate, so two concurrent uploads of the
+	// same file cannot both be stored. The document and its job are written
+	// in one transaction, so a stored document always has a job.
+	err = s.database.inTx(ctx, func(tx *sql.Tx) error {
+		if err := s.docRepo.InsertTx(ctx, tx, doc); err != nil {
+			return err
+		}
+
+		_, err := s.jobRepo.EnqueueTx(ctx, tx, doc.ID, s.retryPolicy.MaxAttempts, time.Now())
+		return err
+	})
+	if err != nil {
 		s.fileStorage.DeleteDocument(filePath)
-		return nil, err
+		if !errors.Is(err, ErrDuplicateDocument) {
+			return nil, err
+		}
+
+		existing, lookupErr := s.docRepo.GetByContentHash(ctx, contentHash, knowledgeBaseID)
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		return existing, ErrDuplicateDocument
 	}
 
 	return doc, nil
 }
 
-func (s *StorageService) GetDocument(id int) (*models.Document, error) {
-	return s.docRepo.GetByID(id)
+func (s *StorageService) GetDocument(ctx context.Context, id int) (*models.Document, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.docRepo.GetByID(ctx, id)
+}
+
+// ListDocuments returns a page of documents in a knowledge base, or in all
+// knowledge bases when knowledgeBaseID is 0.
+func (s *StorageService) ListDocuments(ctx context.Context, knowledgeBaseID, limit, offset int) ([]*models.Document, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.docRepo.List(ctx, knowledgeBaseID, limit, offset)
+}
+
+func (s *StorageService) CountDocuments(ctx context.Context, knowledgeBaseID int) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.docRepo.Count(ctx, knowledgeBaseID)
+}
+
+// CountDocumentsByStatus counts the documents of all knowledge bases per
+// status.
+func (s *StorageService) CountDocumentsByStatus(ctx context.Context) (map[string]int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.docRepo.CountByStatus(ctx)
+}
+
+func (s *StorageService) UpdateDocumentStatus(ctx context.Context, id int, status string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+	return s.docRepo.UpdateStatus(ctx, id, status, &now)
+}
+
+// MarkDocumentFailed records why a document could not be processed.
+func (s *StorageService) MarkDocumentFailed(ctx context.Context, id int, reason string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.docRepo.MarkFailed(ctx, id, reason, time.Now())
+}
+
+// RequeueDocument puts a document back into the pending state and queues
+// a new processing job for it, in one transaction.
+func (s *StorageService) RequeueDocument(ctx context.Context, id int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.database.inTx(ctx, func(tx *sql.Tx) error {
+		if err := s.docRepo.UpdateStatusTx(ctx, tx, id, models.DocumentStatusPending, nil); err != nil {
+			return err
+		}
+
+		_, err := s.jobRepo.EnqueueTx(ctx, tx, id, s.retryPolicy.MaxAttempts, time.Now())
+		return err
+	})
+}
+
+// ClaimJob leases the next runnable job to owner for the lease duration
+// and moves its document to processing. It returns nil, nil when there is
+// nothing to do.
+func (s *StorageService) ClaimJob(ctx context.Context, owner string, lease time.Duration) (*models.Job, *models.Document, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	job, expired, err := s.jobRepo.ClaimNext(ctx, owner, lease, time.Now())
+	for _, documentID := range expired {
+		if markErr := s.docRepo.MarkFailed(ctx, documentID, "processing did not finish before the worker lease expired", time.Now()); markErr != nil && err == nil {
+			err = markErr
+		}
+	}
+	if err != nil || job == nil {
+		return nil, nil, err
+	}
+
+	if err := s.docRepo.UpdateStatus(ctx, job.DocumentID, models.DocumentStatusProcessing, nil); err != nil {
+		return nil, nil, err
+	}
+
+	doc, err := s.docRepo.GetByID(ctx, job.DocumentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return job, doc, nil
 }
 
-func (s *StorageService) ListDocuments(limit, offset int) ([]*models.Document, error) {
-	return s.docRepo.List(limit, offset)
+// ExtendJobLease keeps a claimed job leased to its owner. It returns
+// ErrLeaseLost if another worker has taken the job over.
+func (s *StorageService) ExtendJobLease(ctx context.Context, job *models.Job, lease time.Duration) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.jobRepo.ExtendLease(ctx, job.ID, job.LeaseOwner, lease, time.Now())
 }
 
-func (s *StorageService) UpdateDocumentStatus(id int, status string) error {
+// CompleteJob records a successful run and marks the document completed.
+func (s *StorageService) CompleteJob(ctx context.Context, job *models.Job) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if err := s.jobRepo.Complete(ctx, job.ID, job.LeaseOwner, time.Now()); err != nil {
+		return err
+	}
+
+	return s.UpdateDocumentStatus(ctx, job.DocumentID, models.DocumentStatusCompleted)
+}
+
+// FailJob records a failed run. Retryable failures are rescheduled with
+// exponential backoff while the job has attempts left; otherwise the job
+// and its document are marked failed. It reports whether the job will be
+// retried.
+func (s *StorageService) FailJob(ctx context.Context, job *models.Job, reason string, retryable bool) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	now := time.Now()
-	return s.docRepo.UpdateStatus(id, status, &now)
+
+	if retryable && job.Attempts < job.MaxAttempts {
+		nextRunAt := now.Add(s.retryPolicy.Backoff(job.Attempts))
+		if err := s.jobRepo.Retry(ctx, job.ID, job.LeaseOwner, reason, nextRunAt, now); err != nil {
+			return false, err
+		}
+		return true, s.docRepo.MarkRetrying(ctx, job.DocumentID, reason)
+	}
+
+	if err := s.jobRepo.Fail(ctx, job.ID, job.LeaseOwner, reason, now); err != nil {
+		return false, err
+	}
+	return false, s.docRepo.MarkFailed(ctx, job.DocumentID, reason, now)
+}
+
+// ReleaseJob hands a claimed job back to the queue without counting the
+// attempt, for work interrupted by a shutdown.
+func (s *StorageService) ReleaseJob(ctx context.Context, job *models.Job) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if err := s.jobRepo.Release(ctx, job.ID, job.LeaseOwner, time.Now()); err != nil {
+		return err
+	}
+
+	return s.docRepo.UpdateStatus(ctx, job.DocumentID, models.DocumentStatusPending, nil)
+}
+
+// PostponeJob hands a claimed job back to the queue to run again after
+// delay, without counting the attempt, for work that could not start
+// because a dependency such as the vector store is down.
+func (s *StorageService) PostponeJob(ctx context.Context, job *models.Job, reason string, delay time.Duration) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+	if err := s.jobRepo.Postpone(ctx, job.ID, job.LeaseOwner, reason, now.Add(delay), now); err != nil {
+		return err
+	}
+
+	return s.docRepo.MarkRetrying(ctx, job.DocumentID, reason)
+}
+
+// ListDocumentJobs returns the processing history of a document, oldest
+// job first.
+func (s *StorageService) ListDocumentJobs(ctx context.Context, documentID int) ([]*models.Job, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.docRepo.GetByID(ctx, documentID); err != nil {
+		return nil, err
+	}
+
+	return s.jobRepo.ListByDocument(ctx, documentID)
+}
+
+// ExpireJobLeases ends the leases of jobs that are still running, so they
+// are reclaimed right away instead of after their lease runs out. The
+// server is the only user of its database, so at startup every running
+// job belongs to a previous run that crashed or was killed, and its
+// document would otherwise stay processing (and undeletable) meanwhile.
+func (s *StorageService) ExpireJobLeases(ctx context.Context) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.jobRepo.ExpireLeases(ctx, time.Now())
+}
+
+// RecoverDocumentJobs queues a job for every document that still needs
+// processing but has none, such as documents uploaded before the job
+// queue existed. Jobs left running by a previous run are handled by
+// ExpireJobLeases.
+func (s *StorageService) RecoverDocumentJobs(ctx context.Context) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	ids, err := s.jobRepo.DocumentsWithoutActiveJob(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := s.RequeueDocument(ctx, id); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(ids), nil
 }
 
-func (s *StorageService) GetPendingDocuments() ([]*models.Document, error) {
-	return s.docRepo.GetByStatus(models.DocumentStatusPending)
+func (s *StorageService) GetPendingDocuments(ctx context.Context) ([]*models.Document, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.docRepo.GetByStatus(ctx, models.DocumentStatusPending)
 }
 
-func (s *StorageService) DeleteDocument(id int) error {
-	doc, err := s.docRepo.GetByID(id)
+// DeleteDocument removes a document and its file. A document that is
+// being processed is kept and ErrDocumentProcessing is returned.
+func (s *StorageService) DeleteDocument(ctx context.Context, id int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	doc, err := s.docRepo.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	if err := s.fileStorage.DeleteDocument(doc.FilePath); err != nil {
+	// The row goes first: a document being processed is kept, file and all.
+	if err := s.docRepo.Delete(ctx, id); err != nil {
 		return err
 	}
 
-	return s.docRepo.Delete(id)
+	if err := s.fileStorage.DeleteDocument(doc.FilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// EnsureDefaultKnowledgeBase returns the default knowledge base, creating
+// it from template if there is none yet. Documents uploaded before
+// knowledge bases existed are assigned to it.
+func (s *StorageService) EnsureDefaultKnowledgeBase(ctx context.Context, template models.KnowledgeBase) (*models.KnowledgeBase, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	kb, err := s.kbRepo.GetDefault(ctx)
+	if errors.Is(err, ErrKnowledgeBaseNotFound) {
+		kb = &template
+		kb.IsDefault = true
+		err = s.kbRepo.Insert(ctx, kb)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.kbRepo.AdoptOrphanDocuments(ctx, kb.ID); err != nil {
+		return nil, err
+	}
+
+	return kb, nil
+}
+
+func (s *StorageService) CreateKnowledgeBase(ctx context.Context, kb *models.KnowledgeBase) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	kb.IsDefault = false
+	return s.kbRepo.Insert(ctx, kb)
+}
+
+func (s *StorageService) GetKnowledgeBase(ctx context.Context, id int) (*models.KnowledgeBase, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.kbRepo.GetByID(ctx, id)
+}
+
+func (s *StorageService) DefaultKnowledgeBase(ctx context.Context) (*models.KnowledgeBase, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.kbRepo.GetDefault(ctx)
+}
+
+func (s *StorageService) ListKnowledgeBases(ctx context.Context) ([]*models.KnowledgeBase, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.kbRepo.List(ctx)
+}
+
+// UpdateKnowledgeBase saves the name, description and chunking settings of
+// kb. New chunking settings apply to documents processed afterwards.
+func (s *StorageService) UpdateKnowledgeBase(ctx context.Context, kb *models.KnowledgeBase) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.kbRepo.Update(ctx, kb)
+}
+
+// DeleteKnowledgeBase removes a knowledge base. It fails with
+// ErrKnowledgeBaseNotEmpty while documents remain and with
+// ErrDefaultKnowledgeBase for the default one; the caller drops the
+// vector collection.
+func (s *StorageService) DeleteKnowledgeBase(ctx context.Context, id int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.kbRepo.Delete(ctx, id)
+}
+
+// CreateConversation starts an empty conversation with the given title.
+func (s *StorageService) CreateConversation(ctx context.Context, title string) (*models.Conversation, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	conv := &models.Conversation{Title: title}
+	if err := s.convRepo.Insert(ctx, conv); err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+func (s *StorageService) GetConversation(ctx context.Context, id int) (*models.Conversation, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.convRepo.GetByID(ctx, id)
+}
+
+// ListConversations returns a page of conversations, most recently active
+// first.
+func (s *StorageService) ListConversations(ctx context.Context, limit, offset int) ([]*models.Conversation, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.convRepo.List(ctx, limit, offset)
+}
+
+func (s *StorageService) CountConversations(ctx context.Context) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.convRepo.Count(ctx)
+}
+
+func (s *StorageService) RenameConversation(ctx context.Context, id int, title string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.convRepo.Rename(ctx, id, title)
+}
+
+// DeleteConversation removes a conversation and all of its messages.
+func (s *StorageService) DeleteConversation(ctx context.Context, id int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.convRepo.Delete(ctx, id)
+}
+
+// AddMessages appends messages to a conversation atomically, so a
+// question is never stored without its answer.
+func (s *StorageService) AddMessages(ctx context.Context, conversationID int, messages ...*models.Message) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.convRepo.AddMessages(ctx, conversationID, messages...)
+}
+
+// ListMessages returns the last limit messages of a conversation, oldest
+// first, or all of them when limit is 0.
+func (s *StorageService) ListMessages(ctx context.Context, conversationID, limit int) ([]*models.Message, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.convRepo.ListMessages(ctx, conversationID, limit)
+}
+
+// KeywordIndex returns the full-text index of chunk text kept in the
+// database.
+func (s *StorageService) KeywordIndex() *KeywordIndex {
+	return NewKeywordIndex(s.database)
+}
+
+// withTimeout bounds ctx by the query timeout.
+func (s *StorageService) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
+
+// Ping checks that the database answers queries.
+func (s *StorageService) Ping(ctx context.Context) error {
+	return s.database.Ping(ctx)
+}
+
+// CheckUploadDir checks that uploads can be written to the data directory.
+func (s *StorageService) CheckUploadDir() error {
+	return s.fileStorage.CheckWritable()
+}
+
+func (s *StorageService) Close() error {
+	return s.database.Close()
 }
\ No newline at end of file
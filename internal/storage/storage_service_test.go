@@ -0,0 +1,788 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"rag-therapist/pkg/models"
+)
+
+func newTestStorage(t *testing.T, opts ...Option) *StorageService {
+	t.Helper()
+	ctx := context.Background()
+
+	s, err := NewStorageService(t.TempDir(), opts...)
+	if err != nil {
+		t.Fatalf("NewStorageService failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	if _, err := s.EnsureDefaultKnowledgeBase(ctx, testKnowledgeBase("default")); err != nil {
+		t.Fatalf("EnsureDefaultKnowledgeBase failed: %v", err)
+	}
+	return s
+}
+
+func testKnowledgeBase(name string) models.KnowledgeBase {
+	return models.KnowledgeBase{
+		Name:           name,
+		EmbeddingModel: "test-embedding",
+		ChunkStrategy:  "recursive",
+		ChunkSize:      1000,
+		ChunkOverlap:   200,
+	}
+}
+
+func storeTestDocument(t *testing.T, s *StorageService, name string) *models.Document {
+	t.Helper()
+	ctx := context.Background()
+
+	kb, err := s.DefaultKnowledgeBase(ctx)
+	if err != nil {
+		t.Fatalf("DefaultKnowledgeBase failed: %v", err)
+	}
+
+	doc, err := s.StoreDocument(ctx, kb.ID, name, strings.NewReader("%PDF-1.4 content of "+name), nil)
+	if err != nil {
+		t.Fatalf("StoreDocument failed: %v", err)
+	}
+	return doc
+}
+
+func claimTestJob(t *testing.T, s *StorageService, owner string, lease time.Duration) (*models.Job, *models.Document) {
+	t.Helper()
+	ctx := context.Background()
+
+	job, doc, err := s.ClaimJob(ctx, owner, lease)
+	if err != nil {
+		t.Fatalf("ClaimJob failed: %v", err)
+	}
+	return job, doc
+}
+
+func TestClaimJobLeasesEachJobOnce(t *testing.T) {
+	s := newTestStorage(t)
+	first := storeTestDocument(t, s, "first.pdf")
+	second := storeTestDocument(t, s, "second.pdf")
+
+	for i, want := range []int{first.ID, second.ID} {
+		job, doc := claimTestJob(t, s, fmt.Sprintf("worker-%d", i), time.Minute)
+		if job == nil || doc.ID != want {
+			t.Fatalf("expected to claim document %d, got job %+v", want, job)
+		}
+		if job.Attempts != 1 || job.Status != models.JobStatusRunning {
+			t.Errorf("expected running job on attempt 1, got %q attempt %d", job.Status, job.Attempts)
+		}
+		if doc.Status != models.DocumentStatusProcessing {
+			t.Errorf("expected claimed document to be processing, got %q", doc.Status)
+		}
+	}
+
+	if job, _ := claimTestJob(t, s, "worker-2", time.Minute); job != nil {
+		t.Errorf("expected nothing left to claim, got job %d", job.ID)
+	}
+}
+
+func TestFailJobRetriesUntilAttemptsRunOut(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, WithRetryPolicy(RetryPolicy{MaxAttempts: 2}))
+	doc := storeTestDocument(t, s, "flaky.pdf")
+
+	job, _ := claimTestJob(t, s, "worker", time.Minute)
+	retrying, err := s.FailJob(ctx, job, "embedding API unavailable", true)
+	if err != nil || !retrying {
+		t.Fatalf("expected a retry, got retrying=%v err=%v", retrying, err)
+	}
+
+	stored, _ := s.GetDocument(ctx, doc.ID)
+	if stored.Status != models.DocumentStatusPending || stored.ErrorMessage != "embedding API unavailable" {
+		t.Errorf("expected pending document with the error, got %q %q", stored.Status, stored.ErrorMessage)
+	}
+
+	job, _ = claimTestJob(t, s, "worker", time.Minute)
+	if job == nil || job.Attempts != 2 {
+		t.Fatalf("expected the job back on attempt 2, got %+v", job)
+	}
+	retrying, err = s.FailJob(ctx, job, "embedding API unavailable", true)
+	if err != nil || retrying {
+		t.Fatalf("expected no retry after the last attempt, got retrying=%v err=%v", retrying, err)
+	}
+
+	stored, _ = s.GetDocument(ctx, doc.ID)
+	if stored.Status != models.DocumentStatusFailed {
+		t.Errorf("expected failed document, got %q", stored.Status)
+	}
+
+	jobs, err := s.ListDocumentJobs(ctx, doc.ID)
+	if err != nil {
+		t.Fatalf("ListDocumentJobs failed: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].Status != models.JobStatusFailed || jobs[0].LastError != "embedding API unavailable" {
+		t.Errorf("unexpected job history: %+v", jobs)
+	}
+}
+
+func TestFailJobSchedulesBackoff(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: 2 * time.Hour}))
+	doc := storeTestDocument(t, s, "later.pdf")
+
+	job, _ := claimTestJob(t, s, "worker", time.Minute)
+	before := time.Now()
+	if _, err := s.FailJob(ctx, job, "timeout", true); err != nil {
+		t.Fatalf("FailJob failed: %v", err)
+	}
+
+	if job, _ := claimTestJob(t, s, "worker", time.Minute); job != nil {
+		t.Errorf("expected the retry not to be due yet, claimed job %d", job.ID)
+	}
+
+	jobs, _ := s.ListDocumentJobs(ctx, doc.ID)
+	if len(jobs) != 1 || jobs[0].NextRunAt.Before(before.Add(time.Hour-time.Second)) {
+		t.Errorf("expected next run about an hour out, got %+v", jobs)
+	}
+}
+
+func TestPostponeJobKeepsAttempts(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, WithRetryPolicy(RetryPolicy{MaxAttempts: 1, BaseDelay: time.Hour}))
+	doc := storeTestDocument(t, s, "queued.pdf")
+
+	job, _ := claimTestJob(t, s, "worker", time.Minute)
+	if err := s.PostponeJob(ctx, job, "vector store unavailable", 0); err != nil {
+		t.Fatalf("PostponeJob failed: %v", err)
+	}
+
+	got, _ := s.GetDocument(ctx, doc.ID)
+	if got.Status != models.DocumentStatusPending || got.ErrorMessage != "vector store unavailable" {
+		t.Errorf("expected the document to stay pending with the reason, got %+v", got)
+	}
+
+	job, _ = claimTestJob(t, s, "worker", time.Minute)
+	if job == nil || job.Attempts != 1 {
+		t.Fatalf("expected the postponed job to be claimable as its first attempt, got %+v", job)
+	}
+	if job.LastError != "vector store unavailable" {
+		t.Errorf("expected the reason to be kept on the job, got %q", job.LastError)
+	}
+}
+
+func TestPermanentFailureAndReprocessHistory(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	doc := storeTestDocument(t, s, "encrypted.pdf")
+
+	job, _ := claimTestJob(t, s, "worker", time.Minute)
+	if retrying, err := s.FailJob(ctx, job, "PDF is encrypted", false); err != nil || retrying {
+		t.Fatalf("expected a permanent failure, got retrying=%v err=%v", retrying, err)
+	}
+
+	if err := s.RequeueDocument(ctx, doc.ID); err != nil {
+		t.Fatalf("RequeueDocument failed: %v", err)
+	}
+	if err := s.RequeueDocument(ctx, doc.ID); err != nil {
+		t.Fatalf("RequeueDocument failed: %v", err)
+	}
+
+	jobs, _ := s.ListDocumentJobs(ctx, doc.ID)
+	if len(jobs) != 2 {
+		t.Fatalf("expected a failed job and one queued job, got %+v", jobs)
+	}
+	if jobs[0].Status != models.JobStatusFailed || jobs[1].Status != models.JobStatusQueued {
+		t.Errorf("unexpected job statuses %q, %q", jobs[0].Status, jobs[1].Status)
+	}
+}
+
+func TestExpiredLeaseIsReclaimed(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	storeTestDocument(t, s, "slow.pdf")
+
+	// A lease in the past simulates a worker that crashed mid-job.
+	crashed, _ := claimTestJob(t, s, "crashed", -time.Second)
+
+	job, _ := claimTestJob(t, s, "survivor", time.Minute)
+	if job == nil || job.ID != crashed.ID || job.Attempts != 2 {
+		t.Fatalf("expected job %d to be reclaimed on attempt 2, got %+v", crashed.ID, job)
+	}
+
+	if err := s.CompleteJob(ctx, crashed); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("expected ErrLeaseLost for the old owner, got %v", err)
+	}
+	if err := s.CompleteJob(ctx, job); err != nil {
+		t.Errorf("CompleteJob failed: %v", err)
+	}
+}
+
+func TestExpiredLeaseOnLastAttemptFailsDocument(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	doc := storeTestDocument(t, s, "crashes.pdf")
+
+	claimTestJob(t, s, "crashed", -time.Second)
+	if job, _ := claimTestJob(t, s, "survivor", time.Minute); job != nil {
+		t.Fatalf("expected no job to claim, got %+v", job)
+	}
+
+	stored, _ := s.GetDocument(ctx, doc.ID)
+	if stored.Status != models.DocumentStatusFailed {
+		t.Errorf("expected failed document, got %q", stored.Status)
+	}
+}
+
+func TestExpireJobLeases(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	doc := storeTestDocument(t, s, "interrupted.pdf")
+
+	// A long lease simulates a job left running when the server was killed.
+	crashed, _ := claimTestJob(t, s, "previous-run", time.Hour)
+	if job, _ := claimTestJob(t, s, "next-run", time.Minute); job != nil {
+		t.Fatalf("expected the leased job not to be claimable, got %+v", job)
+	}
+
+	expired, err := s.ExpireJobLeases(ctx)
+	if err != nil {
+		t.Fatalf("ExpireJobLeases failed: %v", err)
+	}
+	if expired != 1 {
+		t.Errorf("expected 1 expired lease, got %d", expired)
+	}
+
+	job, claimed := claimTestJob(t, s, "next-run", time.Minute)
+	if job == nil || job.ID != crashed.ID || claimed.ID != doc.ID {
+		t.Fatalf("expected job %d to be reclaimed, got %+v", crashed.ID, job)
+	}
+	if err := s.CompleteJob(ctx, job); err != nil {
+		t.Fatalf("CompleteJob failed: %v", err)
+	}
+	if err := s.DeleteDocument(ctx, doc.ID); err != nil {
+		t.Errorf("expected the completed document to be deletable, got %v", err)
+	}
+}
+
+func TestRecoverDocumentJobs(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	kb, _ := s.DefaultKnowledgeBase(ctx)
+
+	// Documents written before the job queue existed have no job.
+	doc := &models.Document{
+		KnowledgeBaseID: kb.ID,
+		FileName:        "legacy.pdf",
+		FilePath:        "legacy.pdf",
+		ContentHash:     "legacy",
+		UploadedAt:      time.Now(),
+		Status:          models.DocumentStatusProcessing,
+	}
+	if err := s.docRepo.Insert(ctx, doc); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	storeTestDocument(t, s, "queued.pdf")
+
+	recovered, err := s.RecoverDocumentJobs(ctx)
+	if err != nil {
+		t.Fatalf("RecoverDocumentJobs failed: %v", err)
+	}
+	if recovered != 1 {
+		t.Errorf("expected 1 recovered document, got %d", recovered)
+	}
+
+	stored, _ := s.GetDocument(ctx, doc.ID)
+	if stored.Status != models.DocumentStatusPending {
+		t.Errorf("expected recovered document to be pending, got %q", stored.Status)
+	}
+}
+
+func TestDocumentAndJobAreWrittenTogether(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	kb, _ := s.DefaultKnowledgeBase(ctx)
+	failed := storeTestDocument(t, s, "failed.pdf")
+	if err := s.MarkDocumentFailed(ctx, failed.ID, "unreadable"); err != nil {
+		t.Fatalf("MarkDocumentFailed failed: %v", err)
+	}
+
+	// Make every job insert fail after the document statement succeeded.
+	_, err := s.database.db.ExecContext(ctx, `
+		CREATE TRIGGER refuse_jobs BEFORE INSERT ON jobs
+		BEGIN SELECT RAISE(ABORT, 'job queue unavailable'); END
+	`)
+	if err != nil {
+		t.Fatalf("failed to create trigger: %v", err)
+	}
+
+	if _, err := s.StoreDocument(ctx, kb.ID, "orphan.pdf", strings.NewReader("%PDF-1.4 orphan"), nil); err == nil {
+		t.Fatal("expected StoreDocument to fail")
+	}
+	if count, _ := s.CountDocuments(ctx, kb.ID); count != 1 {
+		t.Errorf("expected the document insert to be rolled back, found %d documents", count)
+	}
+	documentsDir := filepath.Join(s.fileStorage.dataDir, "documents")
+	if entries, _ := os.ReadDir(documentsDir); len(entries) != 1 {
+		t.Errorf("expected the uploaded file to be removed, found %d files", len(entries))
+	}
+
+	if err := s.RequeueDocument(ctx, failed.ID); err == nil {
+		t.Fatal("expected RequeueDocument to fail")
+	}
+	stored, _ := s.GetDocument(ctx, failed.ID)
+	if stored.Status != models.DocumentStatusFailed {
+		t.Errorf("expected the status update to be rolled back, got %q", stored.Status)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := policy.Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %v, expected %v", attempt, got, want)
+		}
+	}
+}
+
+func TestKnowledgeBases(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	defaultKB, err := s.DefaultKnowledgeBase(ctx)
+	if err != nil {
+		t.Fatalf("DefaultKnowledgeBase failed: %v", err)
+	}
+	if !defaultKB.IsDefault || defaultKB.CollectionName == "" {
+		t.Errorf("unexpected default knowledge base %+v", defaultKB)
+	}
+
+	again, err := s.EnsureDefaultKnowledgeBase(ctx, testKnowledgeBase("other"))
+	if err != nil || again.ID != defaultKB.ID {
+		t.Fatalf("expected the existing default knowledge base, got %+v, %v", again, err)
+	}
+
+	handouts := testKnowledgeBase("handouts")
+	if err := s.CreateKnowledgeBase(ctx, &handouts); err != nil {
+		t.Fatalf("CreateKnowledgeBase failed: %v", err)
+	}
+	if handouts.CollectionName != fmt.Sprintf("kb_%d_chunks", handouts.ID) {
+		t.Errorf("unexpected collection name %q", handouts.CollectionName)
+	}
+
+	duplicate := testKnowledgeBase("handouts")
+	if err := s.CreateKnowledgeBase(ctx, &duplicate); !errors.Is(err, ErrKnowledgeBaseExists) {
+		t.Errorf("expected ErrKnowledgeBaseExists, got %v", err)
+	}
+
+	// The same file may be uploaded into two knowledge bases.
+	first := storeTestDocument(t, s, "leaflet.pdf")
+	second, err := s.StoreDocument(ctx, handouts.ID, "leaflet.pdf", strings.NewReader("%PDF-1.4 content of leaflet.pdf"), nil)
+	if err != nil {
+		t.Fatalf("StoreDocument failed: %v", err)
+	}
+	if second.ID == first.ID || second.KnowledgeBaseID != handouts.ID {
+		t.Errorf("expected a separate document in the handouts knowledge base, got %+v", second)
+	}
+
+	if count, _ := s.CountDocuments(ctx, handouts.ID); count != 1 {
+		t.Errorf("expected 1 document in handouts, got %d", count)
+	}
+	if count, _ := s.CountDocuments(ctx, 0); count != 2 {
+		t.Errorf("expected 2 documents in total, got %d", count)
+	}
+
+	if err := s.DeleteKnowledgeBase(ctx, handouts.ID); !errors.Is(err, ErrKnowledgeBaseNotEmpty) {
+		t.Errorf("expected ErrKnowledgeBaseNotEmpty, got %v", err)
+	}
+	if err := s.DeleteKnowledgeBase(ctx, defaultKB.ID); !errors.Is(err, ErrDefaultKnowledgeBase) {
+		t.Errorf("expected ErrDefaultKnowledgeBase, got %v", err)
+	}
+
+	if err := s.DeleteDocument(ctx, second.ID); err != nil {
+		t.Fatalf("DeleteDocument failed: %v", err)
+	}
+	if err := s.DeleteKnowledgeBase(ctx, handouts.ID); err != nil {
+		t.Fatalf("DeleteKnowledgeBase failed: %v", err)
+	}
+	if _, err := s.GetKnowledgeBase(ctx, handouts.ID); !errors.Is(err, ErrKnowledgeBaseNotFound) {
+		t.Errorf("expected ErrKnowledgeBaseNotFound, got %v", err)
+	}
+}
+
+func TestConversations(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	conv, err := s.CreateConversation(ctx, "Sleep hygiene")
+	if err != nil {
+		t.Fatalf("CreateConversation failed: %v", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		question := &models.Message{Role: models.MessageRoleUser, Content: fmt.Sprintf("question %d", i)}
+		answer := &models.Message{
+			Role:      models.MessageRoleAssistant,
+			Content:   fmt.Sprintf("answer %d", i),
+			Sources:   []models.MessageSource{{DocumentID: 1, ChunkID: "1_0", RelevanceScore: 0.5, Cited: true}},
+			Citations: []models.Citation{{Number: 1, DocumentID: 1, ChunkID: "1_0", FileName: "a.pdf", Page: 2, Quote: "quoted"}},
+		}
+		if err := s.AddMessages(ctx, conv.ID, question, answer); err != nil {
+			t.Fatalf("AddMessages failed: %v", err)
+		}
+		if question.ID == 0 || answer.ID <= question.ID {
+			t.Errorf("expected messages to get increasing IDs, got %d and %d", question.ID, answer.ID)
+		}
+	}
+
+	recent, err := s.ListMessages(ctx, conv.ID, 2)
+	if err != nil {
+		t.Fatalf("ListMessages failed: %v", err)
+	}
+	if len(recent) != 2 || recent[0].Content != "question 3" || recent[1].Content != "answer 3" {
+		t.Errorf("expected the last exchange oldest first, got %+v", recent)
+	}
+	if recent[0].Sources != nil || len(recent[1].Sources) != 1 || recent[1].Sources[0].ChunkID != "1_0" {
+		t.Errorf("unexpected sources %+v, %+v", recent[0].Sources, recent[1].Sources)
+	}
+	if recent[0].Citations != nil || len(recent[1].Citations) != 1 || recent[1].Citations[0].Quote != "quoted" || !recent[1].Sources[0].Cited {
+		t.Errorf("unexpected citations %+v, %+v", recent[0].Citations, recent[1].Citations)
+	}
+
+	other, err := s.CreateConversation(ctx, "Other")
+	if err != nil {
+		t.Fatalf("CreateConversation failed: %v", err)
+	}
+	if err := s.RenameConversation(ctx, conv.ID, "Sleep"); err != nil {
+		t.Fatalf("RenameConversation failed: %v", err)
+	}
+
+	conversations, err := s.ListConversations(ctx, 10, 0)
+	if err != nil {
+		t.Fatalf("ListConversations failed: %v", err)
+	}
+	if len(conversations) != 2 || conversations[0].ID != conv.ID || conversations[0].Title != "Sleep" || conversations[0].MessageCount != 6 {
+		t.Errorf("expected the renamed conversation first, got %+v", conversations)
+	}
+	if conversations[1].ID != other.ID || conversations[1].MessageCount != 0 {
+		t.Errorf("unexpected second conversation %+v", conversations[1])
+	}
+
+	if err := s.DeleteConversation(ctx, conv.ID); err != nil {
+		t.Fatalf("DeleteConversation failed: %v", err)
+	}
+	if _, err := s.GetConversation(ctx, conv.ID); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("expected ErrConversationNotFound, got %v", err)
+	}
+	if messages, _ := s.ListMessages(ctx, conv.ID, 0); len(messages) != 0 {
+		t.Errorf("expected messages to be deleted with the conversation, got %d", len(messages))
+	}
+	if err := s.AddMessages(ctx, conv.ID, &models.Message{Role: models.MessageRoleUser, Content: "late"}); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("expected ErrConversationNotFound, got %v", err)
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	if err := s.Ping(ctx); err != nil {
+		t.Errorf("Ping failed: %v", err)
+	}
+	if err := s.CheckUploadDir(); err != nil {
+		t.Errorf("CheckUploadDir failed: %v", err)
+	}
+
+	storeTestDocument(t, s, "a.pdf")
+	failed := storeTestDocument(t, s, "b.pdf")
+	if err := s.MarkDocumentFailed(ctx, failed.ID, "corrupt"); err != nil {
+		t.Fatalf("MarkDocumentFailed failed: %v", err)
+	}
+
+	counts, err := s.CountDocumentsByStatus(ctx)
+	if err != nil {
+		t.Fatalf("CountDocumentsByStatus failed: %v", err)
+	}
+	if counts[models.DocumentStatusPending] != 1 || counts[models.DocumentStatusFailed] != 1 {
+		t.Errorf("expected one pending and one failed document, got %v", counts)
+	}
+
+	s.Close()
+	if err := s.Ping(ctx); err == nil {
+		t.Error("expected Ping to fail on a closed database")
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	s := newTestStorage(t)
+	doc := storeTestDocument(t, s, "a.pdf")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.GetDocument(ctx, doc.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled for a cancelled request, got %v", err)
+	}
+
+	WithQueryTimeout(time.Nanosecond)(s)
+	if _, err := s.GetDocument(context.Background(), doc.ID); !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrUnavailable) {
+		t.Errorf("expected context.DeadlineExceeded and ErrUnavailable after the query timeout, got %v", err)
+	}
+
+	WithQueryTimeout(0)(s)
+	if _, err := s.GetDocument(context.Background(), doc.ID); err != nil {
+		t.Errorf("expected no timeout when it is turned off, got %v", err)
+	}
+}
+
+func TestErrorCategories(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	first := storeTestDocument(t, s, "a.pdf")
+
+	again, err := s.StoreDocument(ctx, first.KnowledgeBaseID, "copy.pdf", strings.NewReader("%PDF-1.4 content of a.pdf"), nil)
+	if !errors.Is(err, ErrDuplicateDocument) || !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("expected ErrDuplicateDocument, got %v", err)
+	}
+	if again == nil || again.ID != first.ID {
+		t.Errorf("expected the existing document with a duplicate, got %+v", again)
+	}
+	if count, _ := s.CountDocuments(ctx, 0); count != 1 {
+		t.Errorf("expected the duplicate not to be stored, got %d documents", count)
+	}
+
+	if _, err := s.GetDocument(ctx, 999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a missing document, got %v", err)
+	}
+	if _, err := s.GetConversation(ctx, 999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a missing conversation, got %v", err)
+	}
+	if err := s.DeleteKnowledgeBase(ctx, first.KnowledgeBaseID); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected ErrConflict when deleting the default knowledge base, got %v", err)
+	}
+}
+
+func TestStoreDocumentValidation(t *testing.T) {
+	errEncrypted := errors.New("PDF is encrypted")
+	s := newTestStorage(t, WithMaxDocumentSize(64), WithDocumentCheck(func(path string) error {
+		content, err := os.ReadFile(path)
+		if err == nil && strings.Contains(string(content), "/Encrypt") {
+			return errEncrypted
+		}
+		return err
+	}))
+	ctx := context.Background()
+
+	kb, err := s.DefaultKnowledgeBase(ctx)
+	if err != nil {
+		t.Fatalf("DefaultKnowledgeBase failed: %v", err)
+	}
+
+	tests := map[string]struct {
+		content string
+		want    error
+	}{
+		"not a pdf":        {"plain text", ErrUnsupportedDocument},
+		"empty":            {"", ErrUnsupportedDocument},
+		"header not first": {"plain text %PDF-1.4", ErrUnsupportedDocument},
+		"too large":        {"%PDF-1.4 " + strings.Repeat("x", 64), ErrDocumentTooLarge},
+		"encrypted":        {"%PDF-1.4 /Encrypt", errEncrypted},
+	}
+	for name, tt := range tests {
+		_, err := s.StoreDocument(ctx, kb.ID, "upload.pdf", strings.NewReader(tt.content), nil)
+		if !errors.Is(err, tt.want) || !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected %v in the ErrInvalid category, got %v", name, tt.want, err)
+		}
+	}
+
+	documentsDir := filepath.Join(s.fileStorage.dataDir, "documents")
+	if entries, _ := os.ReadDir(documentsDir); len(entries) != 0 {
+		t.Errorf("expected rejected uploads not to be kept, found %d files", len(entries))
+	}
+
+	doc, err := s.StoreDocument(ctx, kb.ID, `..\..\évil name.pdf`, strings.NewReader("%PDF-1.4 fine"), nil)
+	if err != nil {
+		t.Fatalf("StoreDocument failed: %v", err)
+	}
+	if doc.FileName != `..\..\évil name.pdf` {
+		t.Errorf("expected the original file name to be kept, got %q", doc.FileName)
+	}
+	if filepath.Dir(doc.FilePath) != documentsDir || !strings.HasSuffix(doc.FilePath, "__vil_name.pdf") {
+		t.Errorf("expected a sanitized file in the documents directory, got %q", doc.FilePath)
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := map[string]string{
+		"guide.pdf":                       "guide.pdf",
+		"../../etc/passwd":                "passwd",
+		`C:\Users\me\cv.pdf`:              "cv.pdf",
+		"..":                              defaultFileName,
+		"":                                defaultFileName,
+		".hidden.pdf":                     "hidden.pdf",
+		"a b;rm -rf.pdf":                  "a_b_rm_-rf.pdf",
+		strings.Repeat("x", 200) + ".pdf": strings.Repeat("x", maxFileNameLength-4) + ".pdf",
+	}
+	for name, want := range tests {
+		if got := sanitizeFileName(name); got != want {
+			t.Errorf("sanitizeFileName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestLooksLikePDF(t *testing.T) {
+	tests := map[string]bool{
+		"%PDF-1.7\n":             true,
+		"\xEF\xBB\xBF%PDF-1.4":   true,
+		"\r\n  %PDF-1.4":         true,
+		"\xEF\xBB\xBF\n%PDF-1.4": true,
+		"<html>%PDF-1.4</html>":  false,
+		"%PDF":                   false,
+		"\x00%PDF-1.4":           false,
+		"":                       false,
+	}
+	for head, want := range tests {
+		if got := looksLikePDF([]byte(head)); got != want {
+			t.Errorf("looksLikePDF(%q) = %v, want %v", head, got, want)
+		}
+	}
+}
+
+func TestTruncateFileName(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		want  string
+	}{
+		{"short.pdf", 20, "short.pdf"},
+		{"a-rather-long-name.pdf", 12, "a-rather.pdf"},
+		{"ééééé.pdf", 9, "éé.pdf"},
+		{"name." + strings.Repeat("x", 20), 10, "name.xxxxx"},
+	}
+	for _, tt := range tests {
+		if got := truncateFileName(tt.name, tt.limit); got != tt.want {
+			t.Errorf("truncateFileName(%q, %d) = %q, want %q", tt.name, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestStoreDocumentCapsFileName(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	kb, _ := s.DefaultKnowledgeBase(ctx)
+
+	name := strings.Repeat("é", MaxDocumentNameLength) + ".pdf"
+	doc, err := s.StoreDocument(ctx, kb.ID, name, strings.NewReader("%PDF-1.4 long name"), nil)
+	if err != nil {
+		t.Fatalf("StoreDocument failed: %v", err)
+	}
+
+	stored, _ := s.GetDocument(ctx, doc.ID)
+	if len(stored.FileName) > MaxDocumentNameLength || !strings.HasSuffix(stored.FileName, "é.pdf") {
+		t.Errorf("expected the name cut to %d bytes keeping its extension, got %d bytes: %q",
+			MaxDocumentNameLength, len(stored.FileName), stored.FileName)
+	}
+}
+
+func TestDeleteProcessingDocument(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	doc := storeTestDocument(t, s, "busy.pdf")
+
+	job, _ := claimTestJob(t, s, "worker", time.Minute)
+	if err := s.DeleteDocument(ctx, doc.ID); !errors.Is(err, ErrDocumentProcessing) || !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrDocumentProcessing while the document is processed, got %v", err)
+	}
+	if _, err := s.GetDocument(ctx, doc.ID); err != nil {
+		t.Errorf("expected the document to be kept, got %v", err)
+	}
+	if _, err := os.Stat(doc.FilePath); err != nil {
+		t.Errorf("expected the file to be kept, got %v", err)
+	}
+
+	if err := s.CompleteJob(ctx, job); err != nil {
+		t.Fatalf("CompleteJob failed: %v", err)
+	}
+	if err := s.DeleteDocument(ctx, doc.ID); err != nil {
+		t.Fatalf("DeleteDocument failed: %v", err)
+	}
+	if err := s.DeleteDocument(ctx, doc.ID); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("expected ErrDocumentNotFound after the delete, got %v", err)
+	}
+}
+
+func TestStoreDocumentConcurrentDuplicates(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	kb, err := s.DefaultKnowledgeBase(ctx)
+	if err != nil {
+		t.Fatalf("DefaultKnowledgeBase failed: %v", err)
+	}
+
+	const uploads = 8
+	type result struct {
+		doc *models.Document
+		err error
+	}
+	results := make(chan result, uploads)
+	for i := 0; i < uploads; i++ {
+		go func() {
+			doc, err := s.StoreDocument(ctx, kb.ID, fmt.Sprintf("copy-%d.pdf", i), strings.NewReader("%PDF-1.4 same content"), nil)
+			results <- result{doc, err}
+		}()
+	}
+
+	stored := 0
+	var ids []int
+	for i := 0; i < uploads; i++ {
+		r := <-results
+		switch {
+		case r.err == nil:
+			stored++
+		case !errors.Is(r.err, ErrDuplicateDocument):
+			t.Fatalf("expected ErrDuplicateDocument for a copy, got %v", r.err)
+		}
+		ids = append(ids, r.doc.ID)
+	}
+	if stored != 1 {
+		t.Fatalf("expected exactly one upload to be stored, got %d", stored)
+	}
+	for _, id := range ids {
+		if id != ids[0] {
+			t.Errorf("expected every upload to return the stored document, got ids %v", ids)
+			break
+		}
+	}
+
+	if count, err := s.CountDocuments(ctx, kb.ID); err != nil || count != 1 {
+		t.Errorf("expected one document, got %d, %v", count, err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(s.fileStorage.dataDir, "documents"))
+	if len(entries) != 1 {
+		t.Errorf("expected the copies' files to be removed, found %d files", len(entries))
+	}
+}
+
+func TestUpdateMissingDocument(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	doc := storeTestDocument(t, s, "gone.pdf")
+	if err := s.DeleteDocument(ctx, doc.ID); err != nil {
+		t.Fatalf("DeleteDocument failed: %v", err)
+	}
+
+	updates := map[string]error{
+		"UpdateStatus": s.UpdateDocumentStatus(ctx, doc.ID, models.DocumentStatusCompleted),
+		"MarkFailed":   s.MarkDocumentFailed(ctx, doc.ID, "broken"),
+		"MarkRetrying": s.docRepo.MarkRetrying(ctx, doc.ID, "later"),
+		"Requeue":      s.RequeueDocument(ctx, doc.ID),
+	}
+	for name, err := range updates {
+		if !errors.Is(err, ErrDocumentNotFound) {
+			t.Errorf("%s: expected ErrDocumentNotFound, got %v", name, err)
+		}
+	}
+}
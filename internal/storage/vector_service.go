@@ -1,44 +1,80 @@
 package storage
 
 import (
+	"context"
 	"fmt"
+	"time"
 )
 
 const DefaultCollectionName = "document_chunks"
 
+// DefaultVectorTimeout bounds every VectorService operation on the vector
+// store and keyword index.
+const DefaultVectorTimeout = 30 * time.Second
+
 type VectorService struct {
-	store *VectorStore
+	store    VectorStore
+	keywords *KeywordIndex
+	timeout  time.Duration
 }
 
-func NewVectorService(chromaURL string) (*VectorService, error) {
-	store, err := NewVectorStore(chromaURL)
-	if err != nil {
-		return nil, err
+type VectorServiceOption func(*VectorService)
+
+// WithKeywordIndex keeps a full-text index of every stored chunk, which
+// enables keyword matching in HybridSearch.
+func WithKeywordIndex(index *KeywordIndex) VectorServiceOption {
+	return func(vs *VectorService) {
+		vs.keywords = index
 	}
+}
 
-	// Ensure the default collection exists
-	if err := store.EnsureCollection(DefaultCollectionName); err != nil {
-		return nil, fmt.Errorf("failed to ensure collection: %w", err)
+// WithVectorTimeout sets how long an operation may take before its calls
+// to the vector store are cancelled. Zero or less turns the timeout off.
+func WithVectorTimeout(timeout time.Duration) VectorServiceOption {
+	return func(vs *VectorService) {
+		vs.timeout = timeout
 	}
+}
+
+func NewVectorService(store VectorStore, opts ...VectorServiceOption) *VectorService {
+	vs := &VectorService{
+		store:   store,
+		timeout: DefaultVectorTimeout,
+	}
+	for _, opt := range opts {
+		opt(vs)
+	}
+	return vs
+}
 
-	return &VectorService{
-		store: store,
-	}, nil
+func (vs *VectorService) StoreDocumentChunks(ctx context.Context, documentID int, chunks []string, embeddings [][]float32, metadata map[string]string) error {
+	return vs.StoreChunksWithMetadata(ctx, documentID, chunks, embeddings, metadata, nil)
 }
 
-func (vs *VectorService) StoreDocumentChunks(documentID int, chunks []string, embeddings [][]float32, metadata map[string]string) error {
+// StoreChunksWithMetadata is StoreDocumentChunks with additional metadata
+// per chunk (e.g. page numbers); chunkMetadata[i] is merged over the shared
+// metadata for chunk i. chunkMetadata may be nil.
+func (vs *VectorService) StoreChunksWithMetadata(ctx context.Context, documentID int, chunks []string, embeddings [][]float32, metadata map[string]string, chunkMetadata []map[string]string) error {
 	if len(chunks) != len(embeddings) {
 		return fmt.Errorf("chunks and embeddings length mismatch")
 	}
+	if chunkMetadata != nil && len(chunkMetadata) != len(chunks) {
+		return fmt.Errorf("chunks and chunk metadata length mismatch")
+	}
 
 	var documentChunks []DocumentChunk
 	for i, chunk := range chunks {
-		chunkID := fmt.Sprintf("doc_%d_chunk_%d", documentID, i)
+		chunkID := GenerateChunkID(documentID, i)
 		
 		// Create chunk metadata
-		chunkMetadata := make(map[string]string)
+		chunkMeta := make(map[string]string)
 		for k, v := range metadata {
-			chunkMetadata[k] = v
+			chunkMeta[k] = v
+		}
+		if chunkMetadata != nil {
+			for k, v := range chunkMetadata[i] {
+				chunkMeta[k] = v
+			}
 		}
 		
 		documentChunk := DocumentChunk{
@@ -46,25 +82,91 @@ func (vs *VectorService) StoreDocumentChunks(documentID int, chunks []string, em
 			Content:    chunk,
 			DocumentID: documentID,
 			ChunkIndex: i,
-			Metadata:   chunkMetadata,
+			Metadata:   chunkMeta,
 		}
 		
 		documentChunks = append(documentChunks, documentChunk)
 	}
 
-	return vs.store.AddChunks(documentChunks, embeddings)
+	ctx, cancel := vs.withTimeout(ctx)
+	defer cancel()
+
+	if err := vs.store.AddChunks(ctx, documentChunks, embeddings); err != nil {
+		return err
+	}
+
+	if vs.keywords != nil {
+		return vs.keywords.IndexChunks(ctx, documentChunks)
+	}
+	return nil
 }
 
-func (vs *VectorService) SearchRelevantChunks(queryEmbedding []float32, limit int) ([]SearchResult, error) {
-	return vs.store.SearchSimilar(queryEmbedding, limit)
+// SearchRelevantChunks returns the chunks closest to queryEmbedding among
+// those matching filter; a nil filter searches everything.
+func (vs *VectorService) SearchRelevantChunks(ctx context.Context, queryEmbedding []float32, limit int, filter *SearchFilter) ([]SearchResult, error) {
+	ctx, cancel := vs.withTimeout(ctx)
+	defer cancel()
+
+	return vs.store.SearchSimilar(ctx, queryEmbedding, limit, filter)
 }
 
-func (vs *VectorService) DeleteDocumentChunks(documentID int) error {
-	return vs.store.DeleteByDocumentID(documentID)
+// GetChunks returns the chunks of a document with ChunkIndex in
+// [fromIndex, toIndex], ordered by ChunkIndex.
+func (vs *VectorService) GetChunks(ctx context.Context, documentID, fromIndex, toIndex int) ([]DocumentChunk, error) {
+	ctx, cancel := vs.withTimeout(ctx)
+	defer cancel()
+
+	return vs.store.GetChunks(ctx, documentID, fromIndex, toIndex)
 }
 
-func (vs *VectorService) GetStats() (map[string]interface{}, error) {
-	return vs.store.GetCollectionInfo()
+func (vs *VectorService) DeleteDocumentChunks(ctx context.Context, documentID int) error {
+	ctx, cancel := vs.withTimeout(ctx)
+	defer cancel()
+
+	if err := vs.store.DeleteByDocumentID(ctx, documentID); err != nil {
+		return err
+	}
+
+	if vs.keywords != nil {
+		return vs.keywords.DeleteByDocumentID(ctx, documentID)
+	}
+	return nil
+}
+
+func (vs *VectorService) GetStats(ctx context.Context) (map[string]interface{}, error) {
+	ctx, cancel := vs.withTimeout(ctx)
+	defer cancel()
+
+	return vs.store.GetCollectionInfo(ctx)
+}
+
+// Heartbeat checks that the vector store backend is reachable.
+func (vs *VectorService) Heartbeat(ctx context.Context) error {
+	ctx, cancel := vs.withTimeout(ctx)
+	defer cancel()
+
+	return vs.store.Heartbeat(ctx)
+}
+
+// Drop deletes the collection and closes the store. Keyword index rows
+// are removed with their documents.
+func (vs *VectorService) Drop(ctx context.Context) error {
+	ctx, cancel := vs.withTimeout(ctx)
+	defer cancel()
+
+	return vs.store.Drop(ctx)
+}
+
+func (vs *VectorService) Close() error {
+	return vs.store.Close()
+}
+
+// withTimeout bounds ctx by the operation timeout.
+func (vs *VectorService) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if vs.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, vs.timeout)
 }
 
 // Helper function to generate chunk ID
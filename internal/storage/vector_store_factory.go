@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	VectorStoreChroma   = "chroma"
+	VectorStoreEmbedded = "embedded"
+)
+
+// VectorStoreConfig selects the backend OpenVectorStore opens collections
+// on.
+type VectorStoreConfig struct {
+	// Backend is VectorStoreChroma or VectorStoreEmbedded.
+	Backend string
+	// Distance is the metric new collections are created with, as accepted
+	// by ParseDistanceMetric.
+	Distance  string
+	ChromaURL string
+	// Dir holds the files of the embedded backend.
+	Dir string
+}
+
+// OpenVectorStore opens a collection on the configured backend, creating
+// it with the configured metric if needed. A Chroma store is returned even
+// while the server is down; its calls then fail with
+// ErrVectorStoreUnavailable until it is back.
+func OpenVectorStore(ctx context.Context, cfg VectorStoreConfig, collection string) (VectorStore, error) {
+	metric, err := ParseDistanceMetric(cfg.Distance)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vector distance: %w", err)
+	}
+
+	switch strings.ToLower(cfg.Backend) {
+	case VectorStoreChroma:
+		store, err := NewChromaVectorStore(cfg.ChromaURL)
+		if err != nil {
+			return nil, err
+		}
+		// An unreachable Chroma is not fatal: the store connects once the
+		// server is up, so the server can start before Chroma does. The
+		// store logs the outage itself.
+		err = store.EnsureCollection(ctx, collection, metric)
+		if err != nil && !errors.Is(err, ErrVectorStoreUnavailable) {
+			return nil, fmt.Errorf("failed to ensure collection: %w", err)
+		}
+		return store, nil
+
+	case VectorStoreEmbedded:
+		return NewEmbeddedVectorStore(cfg.Dir, collection, metric)
+
+	default:
+		return nil, fmt.Errorf("unknown vector store %q (expected %q or %q)", cfg.Backend, VectorStoreChroma, VectorStoreEmbedded)
+	}
+}
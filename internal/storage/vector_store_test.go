@@ -1,36 +1,75 @@
 package storage
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
+
+	chroma "github.com/amikos-tech/chroma-go"
+	chhttp "github.com/amikos-tech/chroma-go/pkg/commons/http"
+	"github.com/amikos-tech/chroma-go/types"
 )
 
-func TestVectorStoreOperations(t *testing.T) {
-	// Skip test if no Chroma URL is provided
-	chromaURL := os.Getenv("CHROMA_URL")
-	if chromaURL == "" {
-		chromaURL = "http://localhost:8000"
-	}
+// vectorStoreBackends returns a constructor for each VectorStore
+// implementation. The Chroma backend is skipped when no server is
+// reachable.
+func vectorStoreBackends() map[string]func(t *testing.T) VectorStore {
+	ctx := context.Background()
+	return map[string]func(t *testing.T) VectorStore{
+		VectorStoreChroma: func(t *testing.T) VectorStore {
+			chromaURL := os.Getenv("CHROMA_URL")
+			if chromaURL == "" {
+				chromaURL = "http://localhost:8000"
+			}
 
-	// Create vector store
-	vs, err := NewVectorStore(chromaURL)
-	if err != nil {
-		t.Skipf("Skipping test: failed to connect to Chroma at %s: %v", chromaURL, err)
-	}
+			vs, err := NewChromaVectorStore(chromaURL)
+			if err != nil {
+				t.Fatalf("Failed to create Chroma client: %v", err)
+			}
+			if err := vs.Heartbeat(context.Background()); err != nil {
+				t.Skipf("Skipping test: failed to connect to Chroma at %s: %v", chromaURL, err)
+			}
 
-	// Test collection creation
-	testCollectionName := "test_collection_" + time.Now().Format("20060102_150405")
-	err = vs.EnsureCollection(testCollectionName)
-	if err != nil {
-		t.Fatalf("Failed to create collection: %v", err)
+			testCollectionName := "test_collection_" + time.Now().Format("20060102_150405.000000")
+			if err := vs.EnsureCollection(ctx, testCollectionName, DistanceL2); err != nil {
+				t.Fatalf("Failed to create collection: %v", err)
+			}
+
+			// Clean up collection after test
+			t.Cleanup(func() {
+				vs.DeleteCollection(ctx, testCollectionName)
+			})
+			return vs
+		},
+		VectorStoreEmbedded: func(t *testing.T) VectorStore {
+			vs, err := NewEmbeddedVectorStore(t.TempDir(), "test_collection", DistanceL2)
+			if err != nil {
+				t.Fatalf("Failed to create embedded vector store: %v", err)
+			}
+
+			t.Cleanup(func() {
+				vs.Close()
+			})
+			return vs
+		},
 	}
+}
 
-	// Clean up collection after test
-	defer func() {
-		vs.DeleteCollection(testCollectionName)
-	}()
+func TestVectorStoreOperations(t *testing.T) {
+	for name, open := range vectorStoreBackends() {
+		t.Run(name, func(t *testing.T) {
+			testVectorStoreOperations(t, open(t))
+		})
+	}
+}
 
+func testVectorStoreOperations(t *testing.T, vs VectorStore) {
+	ctx := context.Background()
 	// Test data
 	chunks := []DocumentChunk{
 		{
@@ -56,14 +95,14 @@ func TestVectorStoreOperations(t *testing.T) {
 	}
 
 	// Test adding chunks
-	err = vs.AddChunks(chunks, embeddings)
+	err := vs.AddChunks(ctx, chunks, embeddings)
 	if err != nil {
 		t.Fatalf("Failed to add chunks: %v", err)
 	}
 
 	// Test search
 	queryEmbedding := []float32{0.15, 0.25, 0.35, 0.45, 0.55}
-	results, err := vs.SearchSimilar(queryEmbedding, 2)
+	results, err := vs.SearchSimilar(ctx, queryEmbedding, 2, nil)
 	if err != nil {
 		t.Fatalf("Failed to search: %v", err)
 	}
@@ -77,8 +116,25 @@ func TestVectorStoreOperations(t *testing.T) {
 		t.Logf("Result %d: ID=%s, Score=%.3f, Content=%s", i, result.ID, result.Score, result.Content[:50]+"...")
 	}
 
+	// Test lookup by document and chunk index range
+	neighbors, err := vs.GetChunks(ctx, 1, 1, 3)
+	if err != nil {
+		t.Fatalf("Failed to get chunks: %v", err)
+	}
+	if len(neighbors) != 1 || neighbors[0].ID != "test_2" || neighbors[0].ChunkIndex != 1 || neighbors[0].Metadata["topic"] != "ml" {
+		t.Fatalf("Expected chunk test_2, got %+v", neighbors)
+	}
+
+	all, err := vs.GetChunks(ctx, 1, 0, 1)
+	if err != nil {
+		t.Fatalf("Failed to get chunks: %v", err)
+	}
+	if len(all) != 2 || all[0].ID != "test_1" || all[1].ID != "test_2" {
+		t.Fatalf("Expected both chunks in index order, got %+v", all)
+	}
+
 	// Test collection info
-	info, err := vs.GetCollectionInfo()
+	info, err := vs.GetCollectionInfo(ctx)
 	if err != nil {
 		t.Fatalf("Failed to get collection info: %v", err)
 	}
@@ -89,13 +145,13 @@ func TestVectorStoreOperations(t *testing.T) {
 	}
 
 	// Test deletion
-	err = vs.DeleteChunks([]string{"test_1"})
+	err = vs.DeleteChunks(ctx, []string{"test_1"})
 	if err != nil {
 		t.Fatalf("Failed to delete chunk: %v", err)
 	}
 
 	// Verify deletion
-	info, err = vs.GetCollectionInfo()
+	info, err = vs.GetCollectionInfo(ctx)
 	if err != nil {
 		t.Fatalf("Failed to get collection info after deletion: %v", err)
 	}
@@ -109,16 +165,15 @@ func TestVectorStoreOperations(t *testing.T) {
 }
 
 func TestVectorService(t *testing.T) {
-	chromaURL := os.Getenv("CHROMA_URL")
-	if chromaURL == "" {
-		chromaURL = "http://localhost:8000"
-	}
-
-	vs, err := NewVectorService(chromaURL)
-	if err != nil {
-		t.Skipf("Skipping test: failed to connect to Chroma at %s: %v", chromaURL, err)
+	for name, open := range vectorStoreBackends() {
+		t.Run(name, func(t *testing.T) {
+			testVectorService(t, NewVectorService(open(t)))
+		})
 	}
+}
 
+func testVectorService(t *testing.T, vs *VectorService) {
+	ctx := context.Background()
 	// Test storing document chunks
 	documentID := 999 // Use a test document ID
 	chunks := []string{
@@ -134,19 +189,19 @@ func TestVectorService(t *testing.T) {
 		"author":   "test_author",
 	}
 
-	err = vs.StoreDocumentChunks(documentID, chunks, embeddings, metadata)
+	err := vs.StoreDocumentChunks(ctx, documentID, chunks, embeddings, metadata)
 	if err != nil {
 		t.Fatalf("Failed to store document chunks: %v", err)
 	}
 
 	// Clean up after test
 	defer func() {
-		vs.DeleteDocumentChunks(documentID)
+		vs.DeleteDocumentChunks(ctx, documentID)
 	}()
 
 	// Test searching
 	queryEmbedding := []float32{0.2, 0.3, 0.4}
-	results, err := vs.SearchRelevantChunks(queryEmbedding, 5)
+	results, err := vs.SearchRelevantChunks(ctx, queryEmbedding, 5, nil)
 	if err != nil {
 		t.Fatalf("Failed to search chunks: %v", err)
 	}
@@ -169,7 +224,7 @@ func TestVectorService(t *testing.T) {
 	}
 
 	// Test stats
-	stats, err := vs.GetStats()
+	stats, err := vs.GetStats(ctx)
 	if err != nil {
 		t.Fatalf("Failed to get stats: %v", err)
 	}
@@ -177,4 +232,94 @@ func TestVectorService(t *testing.T) {
 	t.Logf("Collection stats: %+v", stats)
 
 	t.Log("Vector service test completed successfully")
-}
\ No newline at end of file
+}
+
+func TestChromaVectorStoreWhileUnreachable(t *testing.T) {
+	ctx := context.Background()
+	// A closed server refuses connections like a Chroma that is not up yet.
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	cfg := VectorStoreConfig{Backend: VectorStoreChroma, Distance: "cosine", ChromaURL: server.URL}
+	store, err := OpenVectorStore(ctx, cfg, "unreachable")
+	if err != nil {
+		t.Fatalf("expected the store to open while Chroma is down, got %v", err)
+	}
+
+	if _, err := store.SearchSimilar(ctx, []float32{1, 0}, 5, nil); !errors.Is(err, ErrVectorStoreUnavailable) {
+		t.Errorf("expected ErrVectorStoreUnavailable from a search, got %v", err)
+	}
+	if err := store.AddChunks(ctx, nil, nil); !errors.Is(err, ErrVectorStoreUnavailable) {
+		t.Errorf("expected ErrVectorStoreUnavailable from an insert, got %v", err)
+	}
+	if err := store.Heartbeat(context.Background()); !errors.Is(err, ErrVectorStoreUnavailable) {
+		t.Errorf("expected ErrVectorStoreUnavailable from the heartbeat, got %v", err)
+	}
+}
+
+func TestChromaNeedsReconnect(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"no response", &chhttp.ChromaError{Message: "connection refused"}, true},
+		{"unavailable", &chhttp.ChromaError{ErrorCode: http.StatusServiceUnavailable}, true},
+		{"bad gateway", &chhttp.ChromaError{ErrorCode: http.StatusBadGateway}, true},
+		{"collection gone", &chhttp.ChromaError{ErrorCode: http.StatusNotFound, ErrorID: "NotFoundError"}, true},
+		{"invalid collection", &chhttp.ChromaError{ErrorCode: http.StatusBadRequest, ErrorID: "InvalidCollection"}, true},
+		{"bad filter", &chhttp.ChromaError{ErrorCode: http.StatusBadRequest, ErrorID: "ValueError"}, false},
+		{"wrapped", fmt.Errorf("query: %w", &chhttp.ChromaError{ErrorCode: http.StatusGatewayTimeout}), true},
+		{"client side", errors.New("invalid where clause"), false},
+	}
+
+	for _, tt := range tests {
+		if got := needsReconnect(tt.err); got != tt.want {
+			t.Errorf("%s: needsReconnect() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChromaUnavailable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"no response", &chhttp.ChromaError{Message: "connection refused"}, true},
+		{"server error", &chhttp.ChromaError{ErrorCode: http.StatusInternalServerError}, true},
+		{"unavailable", &chhttp.ChromaError{ErrorCode: http.StatusServiceUnavailable}, true},
+		{"invalid name", &chhttp.ChromaError{ErrorCode: http.StatusBadRequest, ErrorID: "ValueError"}, false},
+		{"unauthorized", fmt.Errorf("create: %w", &chhttp.ChromaError{ErrorCode: http.StatusUnauthorized}), false},
+		{"transport", errors.New("dial tcp: connection refused"), true},
+	}
+
+	for _, tt := range tests {
+		if got := chromaUnavailable(tt.err); got != tt.want {
+			t.Errorf("%s: chromaUnavailable() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChromaCollectionMetric(t *testing.T) {
+	tests := map[string]struct {
+		metadata map[string]interface{}
+		want     DistanceMetric
+	}{
+		"cosine":   {map[string]interface{}{types.HNSWSpace: "cosine"}, DistanceCosine},
+		"ip":       {map[string]interface{}{types.HNSWSpace: "ip"}, DistanceInnerProduct},
+		"no space": {nil, DistanceL2},
+	}
+
+	for name, tt := range tests {
+		got, err := collectionMetric(&chroma.Collection{Name: "chunks", Metadata: tt.metadata})
+		if err != nil || got != tt.want {
+			t.Errorf("%s: collectionMetric() = %q, %v, want %q", name, got, err, tt.want)
+		}
+	}
+
+	collection := &chroma.Collection{Name: "chunks", Metadata: map[string]interface{}{types.HNSWSpace: "manhattan"}}
+	if _, err := collectionMetric(collection); err == nil {
+		t.Error("expected an error for an unsupported metric")
+	}
+}
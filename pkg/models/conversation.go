@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// Conversation is a chat session. Its messages are sent back to the LLM
+// as history so follow-up questions can refer to earlier turns.
+type Conversation struct {
+	ID           int       `json:"id" db:"id"`
+	Title        string    `json:"title" db:"title"`
+	MessageCount int       `json:"message_count" db:"message_count"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Message is one turn of a conversation.
+type Message struct {
+	ID             int    `json:"id" db:"id"`
+	ConversationID int    `json:"conversation_id" db:"conversation_id"`
+	Role           string `json:"role" db:"role"` // "user", "assistant"
+	Content        string `json:"content" db:"content"`
+	// StandaloneQuestion is the follow-up rewritten without references to
+	// earlier turns, as used for retrieval. Only set on user messages.
+	StandaloneQuestion string          `json:"standalone_question,omitempty" db:"standalone_question"`
+	Sources            []MessageSource `json:"sources,omitempty" db:"sources"`     // assistant messages only
+	Citations          []Citation      `json:"citations,omitempty" db:"citations"` // assistant messages only
+	CreatedAt          time.Time       `json:"created_at" db:"created_at"`
+}
+
+const (
+	MessageRoleUser      = "user"
+	MessageRoleAssistant = "assistant"
+)
+
+// MessageSource is a chunk an answer was generated from. Cited is false
+// for sources the answer does not refer to.
+type MessageSource struct {
+	DocumentID     int     `json:"document_id"`
+	ChunkID        string  `json:"chunk_id"`
+	RelevanceScore float32 `json:"relevance_score"`
+	Similarity     float32 `json:"similarity"`
+	Cited          bool    `json:"cited"`
+}
+
+// Citation is a reference like [2] in an answer, resolved to the context
+// excerpt it points to. Quote is text copied verbatim from the excerpt:
+// the words the answer quoted, or else the sentence that best matches the
+// cited sentence of the answer. Page and PageEnd locate the chunk holding
+// the quote; PageEnd is only set when the chunk spans several pages.
+type Citation struct {
+	Number     int    `json:"number"`
+	DocumentID int    `json:"document_id"`
+	ChunkID    string `json:"chunk_id"`
+	FileName   string `json:"file_name"`
+	Page       int    `json:"page,omitempty"`
+	PageEnd    int    `json:"page_end,omitempty"`
+	Quote      string `json:"quote"`
+}
@@ -3,14 +3,17 @@ package models
 import "time"
 
 type Document struct {
-	ID          int       `json:"id" db:"id"`
-	FileName    string    `json:"file_name" db:"file_name"`
-	FilePath    string    `json:"file_path" db:"file_path"`
-	FileSize    int64     `json:"file_size" db:"file_size"`
-	ContentHash string    `json:"content_hash" db:"content_hash"`
-	UploadedAt  time.Time `json:"uploaded_at" db:"uploaded_at"`
-	ProcessedAt *time.Time `json:"processed_at,omitempty" db:"processed_at"`
-	Status      string    `json:"status" db:"status"` // "pending", "processing", "completed", "failed"
+	ID              int        `json:"id" db:"id"`
+	KnowledgeBaseID int        `json:"knowledge_base_id" db:"knowledge_base_id"`
+	FileName        string     `json:"file_name" db:"file_name"`
+	FilePath        string     `json:"file_path" db:"file_path"`
+	FileSize        int64      `json:"file_size" db:"file_size"`
+	ContentHash     string     `json:"content_hash" db:"content_hash"`
+	UploadedAt      time.Time  `json:"uploaded_at" db:"uploaded_at"`
+	ProcessedAt     *time.Time `json:"processed_at,omitempty" db:"processed_at"`
+	Status          string     `json:"status" db:"status"`                         // "pending", "processing", "completed", "failed"
+	ErrorMessage    string     `json:"error_message,omitempty" db:"error_message"` // why processing failed
+	Tags            []string   `json:"tags,omitempty" db:"tags"`
 }
 
 const (
@@ -18,4 +21,4 @@ const (
 	DocumentStatusProcessing = "processing"
 	DocumentStatusCompleted  = "completed"
 	DocumentStatusFailed     = "failed"
-)
\ No newline at end of file
+)
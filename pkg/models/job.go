@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Job is a request to process a document. Failed attempts are retried
+// with backoff until the job succeeds or runs out of attempts; every
+// upload and reprocess adds a job, so a document's jobs are its history.
+type Job struct {
+	ID             int        `json:"id" db:"id"`
+	DocumentID     int        `json:"document_id" db:"document_id"`
+	Status         string     `json:"status" db:"status"` // "queued", "running", "succeeded", "failed"
+	Attempts       int        `json:"attempts" db:"attempts"`
+	MaxAttempts    int        `json:"max_attempts" db:"max_attempts"`
+	LastError      string     `json:"last_error,omitempty" db:"last_error"`
+	NextRunAt      time.Time  `json:"next_run_at" db:"next_run_at"`
+	LeaseOwner     string     `json:"lease_owner,omitempty" db:"lease_owner"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty" db:"lease_expires_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// KnowledgeBase is a separately searchable corpus. Its documents are
+// chunked and embedded with its own settings and stored in its own vector
+// collection.
+type KnowledgeBase struct {
+	ID                  int       `json:"id" db:"id"`
+	Name                string    `json:"name" db:"name"`
+	Description         string    `json:"description" db:"description"`
+	CollectionName      string    `json:"collection_name" db:"collection_name"`
+	EmbeddingModel      string    `json:"embedding_model" db:"embedding_model"`
+	EmbeddingDimensions int       `json:"embedding_dimensions" db:"embedding_dimensions"` // 0 = the model's native size
+	ChunkStrategy       string    `json:"chunk_strategy" db:"chunk_strategy"`
+	ChunkSize           int       `json:"chunk_size" db:"chunk_size"`
+	ChunkOverlap        int       `json:"chunk_overlap" db:"chunk_overlap"`
+	IsDefault           bool      `json:"is_default" db:"is_default"` // used when a request names no knowledge base
+	CreatedAt           time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at" db:"updated_at"`
+}